@@ -50,6 +50,10 @@ func NewChannelState(channelName string, channel *libnet.Channel) *ChannelState
 type SessionState struct {
 	ClientID   string
 	LastPing int64
+	//登录时客户端带的协议版本
+	Version int
+	//登录时客户端带的语言, 错误提示按这个语言返回
+	Locale string
 }
 
 func NewSessionState(cid string, lastPing int64) *SessionState {
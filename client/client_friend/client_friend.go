@@ -7,10 +7,14 @@ import (
 	"goProject/libnet"
 	"goProject/log"
 	"goProject/protocol"
+	"time"
 )
 
 var InputConfFile = flag.String("conf_file", "client.json", "input conf file name")
 
+//等待服务器回复的时间
+const callTimeout = 5 * time.Second
+
 func init() {
 	flag.Set("alsologtostderr", "true")
 	flag.Set("log_dir", "false")
@@ -34,23 +38,24 @@ func main() {
 		panic(err)
 	}
 
-	smsg := protocol.NewCmdSimple(protocol.REQ_MSG_SERVER_CMD)
+	gatewayClient.EnableCall(protocol.CmdCallProtocol{}, func(msg interface{}) {
+		log.Info(msg)
+	})
 
-	if err = gatewayClient.Send(smsg); err != nil {
-		log.Error(err.Error())
-	}
-
-	var rmsg protocol.CmdResponse
+	smsg := protocol.NewCmdSimple(protocol.REQ_MSG_SERVER_CMD)
 
-	if err := gatewayClient.Receive(&rmsg); err != nil {
-		log.Error(err.Error())
+	resp, err := gatewayClient.Call(smsg, callTimeout)
+	if err != nil {
+		panic(err)
 	}
+	rmsg := resp.(*protocol.CmdResponse)
 	log.Info(rmsg)
 
 	msgServerClient, err := libnet.Connect("tcp", rmsg.GetArgs()[0], libnet.Packet(libnet.Uint16BE, libnet.Json()))
 	if err != nil {
 		panic(err)
 	}
+	gatewayClient.Close()
 
 	smsg = protocol.NewCmdSimple(protocol.SEND_CLIENT_ID_CMD)
 
@@ -62,25 +67,23 @@ func main() {
 
 	smsg.AddArg(myID)
 
+	//服务器推送的消息和未等待的回复
+	msgServerClient.EnableCall(protocol.CmdCallProtocol{}, func(msg interface{}) {
+		parseProtocol(*msg.(*protocol.CmdResponse), msgServerClient, myID)
+	})
+
 	//告诉服务器我的ID
-	err = msgServerClient.Send(smsg)
+	resp, err = msgServerClient.Call(smsg, callTimeout)
 	if err != nil {
 		log.Error(err.Error())
+	} else {
+		log.Info(resp)
 	}
 
 	go heartBeat(cfg, msgServerClient)
 
 	var input string
 
-	go func() {
-		for {
-			if err := msgServerClient.Receive(&rmsg); err != nil {
-				break
-			}
-			parseProtocol(rmsg, msgServerClient, myID)
-		}
-	}()
-
 	for {
 		//获取操作
 		fmt.Print("Command (add,newadd,del,list,logout,alive,token) : ")
@@ -7,11 +7,15 @@ import (
 	"goProject/libnet"
 	"goProject/log"
 	"goProject/protocol"
+	"time"
 	// "strconv"
 )
 
 var InputConfFile = flag.String("conf_file", "client.json", "input conf file name")
 
+//等待服务器回复的时间
+const callTimeout = 5 * time.Second
+
 func init() {
 	flag.Set("alsologtostderr", "true")
 	flag.Set("log_dir", "false")
@@ -35,34 +39,24 @@ func main() {
 		panic(err)
 	}
 
-	//	go func() {
-	//		var msg protocol.CmdSimple
-	//		for {
-	//			if err := session.Receive(&msg); err != nil {
-	//				break
-	//			}
-	//			log.Info(msg)
-
-	//		}
-	//	}()
+	gatewayClient.EnableCall(protocol.CmdCallProtocol{}, func(msg interface{}) {
+		log.Info(msg)
+	})
 
 	smsg := protocol.NewCmdSimple(protocol.REQ_MSG_SERVER_CMD)
 
-	if err = gatewayClient.Send(smsg); err != nil {
-		log.Error(err.Error())
-	}
-
-	var rmsg protocol.CmdResponse
-
-	if err := gatewayClient.Receive(&rmsg); err != nil {
-		log.Error(err.Error())
+	resp, err := gatewayClient.Call(smsg, callTimeout)
+	if err != nil {
+		panic(err)
 	}
+	rmsg := resp.(*protocol.CmdResponse)
 	log.Info(rmsg)
 
 	msgServerClient, err := libnet.Connect("tcp", rmsg.GetArgs()[0], libnet.Packet(libnet.Uint16BE, libnet.Json()))
 	if err != nil {
 		panic(err)
 	}
+	gatewayClient.Close()
 
 	smsg = protocol.NewCmdSimple(protocol.SEND_CLIENT_ID_CMD)
 	// smsg = protocol.NewCmdSimple(protocol.SEND_PING_CMD)
@@ -84,27 +78,23 @@ func main() {
 
 	smsg.AddArg(myID)
 
+	//服务器推送的消息和未等待的回复
+	msgServerClient.EnableCall(protocol.CmdCallProtocol{}, func(msg interface{}) {
+		parseProtocol(*msg.(*protocol.CmdResponse), msgServerClient, myID)
+	})
+
 	//告诉服务器我的ID
-	err = msgServerClient.Send(smsg)
+	resp, err = msgServerClient.Call(smsg, callTimeout)
 	if err != nil {
 		log.Error(err.Error())
+	} else {
+		log.Info(resp)
 	}
 
 	go heartBeat(cfg, msgServerClient)
 
 	var input string
 
-	go func() {
-		//var msg string
-		for {
-			if err := msgServerClient.Receive(&rmsg); err != nil {
-				break
-			}
-			// fmt.Printf("%s\n", rmsg)
-			parseProtocol(rmsg, msgServerClient, myID)
-		}
-	}()
-
 	for {
 
 		fmt.Print("send the id you want to talk :")
@@ -0,0 +1,111 @@
+package dispatcher
+
+import (
+	"goProject/protocol"
+)
+
+//---------------------------------------------------------------------------
+// 频率限制的类别, 每个会话每类命令分别计数, 配置中按类别名设置每秒的命令数
+//---------------------------------------------------------------------------
+const (
+	//不限制, router和monitor发来的命令
+	RATE_NONE = ""
+	//心跳、退出和ack
+	RATE_CONTROL = "Control"
+	//登录
+	RATE_LOGIN = "Login"
+	//单聊和群聊消息
+	RATE_MESSAGE = "Message"
+	//查询
+	RATE_QUERY = "Query"
+	//群组和好友的修改
+	RATE_MANAGE = "Manage"
+)
+
+//命令的元数据, 所有服务器共用
+type Command struct {
+	Name string
+	//拒绝时回复的命令, 为空时不回复
+	RespCmd string
+	//需要先登录
+	Login bool
+	//旧格式obj最少的参数个数, 带data的由ParsePayload校验
+	MinArgs int
+	Rate    string
+}
+
+var commands = make(map[string]*Command)
+
+//登记命令, 服务器只处理登记过的命令, 新命令登记后所有服务器都能识别
+func Register(command Command) {
+	commands[command.Name] = &command
+}
+
+func Lookup(name string) (*Command, bool) {
+	command, ok := commands[name]
+	return command, ok
+}
+
+func init() {
+	//router
+	Register(Command{Name: protocol.SUBSCRIBE_CHANNEL_CMD, MinArgs: 2})
+	Register(Command{Name: protocol.ROUTE_MSG_CMD, MinArgs: protocol.ROUTE_MSG_CMD_ARGS_NUM})
+
+	//登录
+	Register(Command{Name: protocol.SEND_CLIENT_ID_CMD, RespCmd: protocol.RESP_CLIENT_ID_CMD,
+		MinArgs: protocol.SEND_CLIENT_ID_CMD_ARGS_NUM, Rate: RATE_LOGIN})
+	Register(Command{Name: protocol.SEND_TOKEN_CMD, RespCmd: protocol.RESP_TOKEN_CMD,
+		MinArgs: 1, Rate: RATE_LOGIN})
+	Register(Command{Name: protocol.SEND_PING_CMD, RespCmd: protocol.RESP_PONG_CMD,
+		Login: true, Rate: RATE_CONTROL})
+	Register(Command{Name: protocol.SEND_LOGOUT_CMD, RespCmd: protocol.RESP_LOGOUT_CMD,
+		Login: true, Rate: RATE_CONTROL})
+
+	//单聊
+	Register(Command{Name: protocol.SEND_MESSAGE_P2P_CMD, RespCmd: protocol.RESP_MESSAGE_P2P_CMD,
+		Login: true, MinArgs: protocol.SEND_MESSAGE_P2P_CMD_ARGS_NUM, Rate: RATE_MESSAGE})
+	Register(Command{Name: protocol.SEND_NOTIFY_P2P_CMD, RespCmd: protocol.RESP_NOTIFY_P2P_CMD,
+		Login: true, MinArgs: protocol.SEND_MESSAGE_P2P_CMD_ARGS_NUM, Rate: RATE_MESSAGE})
+	Register(Command{Name: protocol.P2P_ACK_CMD,
+		Login: true, MinArgs: protocol.P2P_ACK_CMD_ARGS_NUM, Rate: RATE_CONTROL})
+	Register(Command{Name: protocol.SEND_CLIENT_ONLINE_STATUS, RespCmd: protocol.RESP_CLIENT_ONLINE_STATUS,
+		Login: true, MinArgs: protocol.SEND_CLIENT_ONLINE_STATUS_ARGS_NUM, Rate: RATE_QUERY})
+	Register(Command{Name: protocol.SEND_GET_TOKEN, RespCmd: protocol.RESP_GET_TOKEN,
+		Login: true, MinArgs: protocol.SEND_GET_TOKEN_ARGS_NUM, Rate: RATE_QUERY})
+
+	//群组
+	Register(Command{Name: protocol.SEND_CREATE_TOPIC_CMD, RespCmd: protocol.RESP_CREATE_TOPIC_CMD,
+		Login: true, MinArgs: protocol.SEND_CREATE_TOPIC_CMD_ARGS_NUM, Rate: RATE_MANAGE})
+	Register(Command{Name: protocol.SEND_JOIN_TOPIC_CMD, RespCmd: protocol.RESP_JOIN_TOPIC_CMD,
+		Login: true, MinArgs: protocol.SEND_JOIN_TOPIC_CMD_ARGS_NUM, Rate: RATE_MANAGE})
+	Register(Command{Name: protocol.SEND_INVITE_TOPIC_CMD, RespCmd: protocol.RESP_INVITE_TOPIC_CMD,
+		Login: true, MinArgs: protocol.SEND_INVITE_TOPIC_CMD_ARGS_NUM, Rate: RATE_MANAGE})
+	Register(Command{Name: protocol.SEND_LEAVE_TOPIC_CMD, RespCmd: protocol.RESP_LEAVE_TOPIC_CMD,
+		Login: true, MinArgs: protocol.SEND_LEAVE_TOPIC_CMD_ARGS_NUM, Rate: RATE_MANAGE})
+	Register(Command{Name: protocol.SEND_LIST_TOPIC_CMD, RespCmd: protocol.RESP_LIST_TOPIC_CMD,
+		Login: true, Rate: RATE_QUERY})
+	Register(Command{Name: protocol.SEND_TOPIC_MEMBERS_LIST_CMD, RespCmd: protocol.RESP_TOPIC_MEMBERS_LIST_CMD,
+		Login: true, MinArgs: protocol.SEND_TOPIC_MEMBERS_LIST_CMD_ARGS_NUM, Rate: RATE_QUERY})
+	Register(Command{Name: protocol.SEND_MESSAGE_TOPIC_CMD, RespCmd: protocol.RESP_MESSAGE_TOPIC_CMD,
+		Login: true, MinArgs: protocol.SEND_MESSAGE_TOPIC_CMD_ARGS_NUM, Rate: RATE_MESSAGE})
+	Register(Command{Name: protocol.SEND_NOTIFY_TOPIC_CMD, RespCmd: protocol.RESP_NOTIFY_TOPIC_CMD,
+		Login: true, MinArgs: protocol.SEND_MESSAGE_TOPIC_CMD_ARGS_NUM, Rate: RATE_MESSAGE})
+	Register(Command{Name: protocol.TOPIC_ACK_CMD,
+		Login: true, MinArgs: protocol.TOPIC_ACK_CMD_ARGS_NUM, Rate: RATE_CONTROL})
+
+	//好友
+	Register(Command{Name: protocol.SEND_VIEW_FRIENDS_CMD, RespCmd: protocol.RESP_VIEW_FRIENDS_CMD,
+		Login: true, Rate: RATE_QUERY})
+	Register(Command{Name: protocol.SEND_ADD_FRIEND_CMD, RespCmd: protocol.RESP_ADD_FRIEND_CMD,
+		Login: true, MinArgs: protocol.SEND_ADD_FRIEND_CMD_ARGS_NUM, Rate: RATE_MANAGE})
+	Register(Command{Name: protocol.SEND_DEL_FRIEND_CMD, RespCmd: protocol.RESP_DEL_FRIEND_CMD,
+		Login: true, MinArgs: protocol.SEND_DEL_FRIEND_CMD_ARGS_NUM, Rate: RATE_MANAGE})
+	Register(Command{Name: protocol.SEND_ASK_CMD, RespCmd: protocol.RESP_ASK_CMD,
+		Login: true, MinArgs: protocol.SEND_ASK_CMD_ARGS_NUM, Rate: RATE_MANAGE})
+	Register(Command{Name: protocol.SEND_REACT_CMD, RespCmd: protocol.RESP_REACT_CMD,
+		Login: true, MinArgs: protocol.SEND_REACT_CMD_ARGS_NUM, Rate: RATE_MANAGE})
+
+	//同步
+	Register(Command{Name: protocol.SEND_SYNC_CMD, RespCmd: protocol.RESP_SYNC_CMD,
+		Login: true, Rate: RATE_QUERY})
+}
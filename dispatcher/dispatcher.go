@@ -0,0 +1,134 @@
+package dispatcher
+
+import (
+	"goProject/info"
+	"goProject/log"
+	"goProject/protocol"
+	"sync"
+	"time"
+)
+
+//session为各服务器自己的会话类型, msg_server为*libnet.Session
+type Handler func(cmd protocol.Cmd, session interface{}) error
+
+//按命令名分发到服务器登记的处理函数, 分发前按命令的元数据检查登录、参数个数和频率
+type Dispatcher struct {
+	handlers map[string]Handler
+	//会话是否已登录
+	loggedIn func(session interface{}) bool
+	//拒绝命令时回复客户端
+	reject func(session interface{}, cmd protocol.Cmd, respCmd string, code int)
+
+	//每个会话每类命令每秒的个数, 没有配置的类别不限制
+	rates    map[string]int
+	mutex    sync.Mutex
+	limiters map[interface{}]map[string]*bucket
+}
+
+func NewDispatcher(loggedIn func(session interface{}) bool,
+	reject func(session interface{}, cmd protocol.Cmd, respCmd string, code int)) *Dispatcher {
+	return &Dispatcher{
+		handlers: make(map[string]Handler),
+		loggedIn: loggedIn,
+		reject:   reject,
+		limiters: make(map[interface{}]map[string]*bucket),
+	}
+}
+
+//设置频率限制, 键为RATE_*的类别名. 设置了限制时会话断开后要调用Forget
+func (self *Dispatcher) SetRates(rates map[string]int) {
+	self.rates = rates
+}
+
+//登记命令的处理函数, 命令要先用Register登记. 在Dispatch之前调用
+func (self *Dispatcher) Handle(name string, handler Handler) {
+	if _, ok := Lookup(name); !ok {
+		panic("dispatcher: unregistered command " + name)
+	}
+	self.handlers[name] = handler
+}
+
+//检查并处理命令, 返回处理函数的错误
+func (self *Dispatcher) Dispatch(cmd protocol.Cmd, session interface{}) error {
+	command, ok := Lookup(cmd.GetCmdName())
+	if !ok {
+		log.Info("unknown command: ", cmd.GetCmdName())
+		self.reject(session, cmd, protocol.RESP_ERROR_CMD, info.CODE_ILLEGAL_REQUEST)
+		return nil
+	}
+	handler, ok := self.handlers[command.Name]
+	if !ok {
+		log.Info("unsupported command: ", command.Name)
+		self.reject(session, cmd, protocol.RESP_ERROR_CMD, info.CODE_UNSUPPORTED_COMMAND)
+		return nil
+	}
+
+	code := info.CODE_OK
+	switch {
+	case command.Login && !self.loggedIn(session):
+		code = info.CODE_YOU_HAVE_NOT_LANDED
+	case !hasData(cmd) && len(cmd.GetArgs()) < command.MinArgs:
+		code = info.CODE_NOT_ENOUGH_ARGUMENTS
+	case !self.allow(session, command.Rate):
+		code = info.CODE_TOO_MANY_REQUESTS
+	}
+	if code != info.CODE_OK {
+		log.Info(command.Name, " rejected: ", info.Message(info.DEFAULT_LOCALE, code))
+		if command.RespCmd != "" {
+			self.reject(session, cmd, command.RespCmd, code)
+		}
+		return nil
+	}
+
+	return handler(cmd, session)
+}
+
+//会话断开后清除它的频率计数
+func (self *Dispatcher) Forget(session interface{}) {
+	self.mutex.Lock()
+	delete(self.limiters, session)
+	self.mutex.Unlock()
+}
+
+//协议版本2的命令参数在data中
+func hasData(cmd protocol.Cmd) bool {
+	simple, ok := cmd.(*protocol.CmdSimple)
+	return ok && simple.Data != nil
+}
+
+//令牌桶, 每秒补充rate个, 最多rate个
+type bucket struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+func (self *Dispatcher) allow(session interface{}, rate string) bool {
+	limit := self.rates[rate]
+	if rate == RATE_NONE || limit <= 0 {
+		return true
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	buckets := self.limiters[session]
+	if buckets == nil {
+		buckets = make(map[string]*bucket)
+		self.limiters[session] = buckets
+	}
+	now := time.Now()
+	b := buckets[rate]
+	if b == nil {
+		b = &bucket{tokens: float64(limit), lastRefill: now}
+		buckets[rate] = b
+	}
+	b.tokens += now.Sub(b.lastRefill).Seconds() * float64(limit)
+	if b.tokens > float64(limit) {
+		b.tokens = float64(limit)
+	}
+	b.lastRefill = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
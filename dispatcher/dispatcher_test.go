@@ -0,0 +1,131 @@
+package dispatcher
+
+import (
+	"goProject/info"
+	"goProject/protocol"
+	"testing"
+
+	"github.com/funny/unitest"
+)
+
+type testSession struct {
+	loggedIn bool
+}
+
+type rejection struct {
+	respCmd string
+	code    int
+}
+
+type dispatcherTest struct {
+	*Dispatcher
+	handled  []string
+	rejected []rejection
+}
+
+func newDispatcherTest() *dispatcherTest {
+	test := &dispatcherTest{}
+	test.Dispatcher = NewDispatcher(func(session interface{}) bool {
+		return session.(*testSession).loggedIn
+	}, func(session interface{}, cmd protocol.Cmd, respCmd string, code int) {
+		test.rejected = append(test.rejected, rejection{respCmd, code})
+	})
+	handler := func(cmd protocol.Cmd, session interface{}) error {
+		test.handled = append(test.handled, cmd.GetCmdName())
+		return nil
+	}
+	test.Handle(protocol.SEND_CLIENT_ID_CMD, handler)
+	test.Handle(protocol.SEND_MESSAGE_P2P_CMD, handler)
+	test.Handle(protocol.SEND_PING_CMD, handler)
+	return test
+}
+
+func newCmd(name string, args ...string) *protocol.CmdSimple {
+	cmd := protocol.NewCmdSimple(name)
+	for _, arg := range args {
+		cmd.AddArg(arg)
+	}
+	return cmd
+}
+
+// Return the last rejection, or CODE_OK when the command was handled.
+func (test *dispatcherTest) dispatch(t *testing.T, cmd protocol.Cmd, session *testSession) rejection {
+	handled, rejected := len(test.handled), len(test.rejected)
+	unitest.NotError(t, test.Dispatch(cmd, session))
+	if len(test.handled) > handled {
+		unitest.Pass(t, len(test.rejected) == rejected)
+		return rejection{code: info.CODE_OK}
+	}
+	unitest.Pass(t, len(test.rejected) == rejected+1)
+	return test.rejected[len(test.rejected)-1]
+}
+
+func Test_Dispatch_Login(t *testing.T) {
+	test := newDispatcherTest()
+	session := &testSession{}
+
+	r := test.dispatch(t, newCmd(protocol.SEND_MESSAGE_P2P_CMD, "hello", "uid2"), session)
+	unitest.Pass(t, r.code == info.CODE_YOU_HAVE_NOT_LANDED)
+	unitest.Pass(t, r.respCmd == protocol.RESP_MESSAGE_P2P_CMD)
+
+	//登录命令不用先登录
+	r = test.dispatch(t, newCmd(protocol.SEND_CLIENT_ID_CMD, "uid1"), session)
+	unitest.Pass(t, r.code == info.CODE_OK)
+
+	session.loggedIn = true
+	r = test.dispatch(t, newCmd(protocol.SEND_MESSAGE_P2P_CMD, "hello", "uid2"), session)
+	unitest.Pass(t, r.code == info.CODE_OK)
+}
+
+func Test_Dispatch_MinArgs(t *testing.T) {
+	test := newDispatcherTest()
+	session := &testSession{loggedIn: true}
+
+	r := test.dispatch(t, newCmd(protocol.SEND_MESSAGE_P2P_CMD, "hello"), session)
+	unitest.Pass(t, r.code == info.CODE_NOT_ENOUGH_ARGUMENTS)
+	unitest.Pass(t, r.respCmd == protocol.RESP_MESSAGE_P2P_CMD)
+
+	//带data的不检查obj个数
+	cmd := newCmd(protocol.SEND_MESSAGE_P2P_CMD)
+	cmd.Version = protocol.PROTOCOL_VERSION_TYPED
+	cmd.Data = map[string]interface{}{"msg": "hello", "to_id": "uid2"}
+	r = test.dispatch(t, cmd, session)
+	unitest.Pass(t, r.code == info.CODE_OK)
+}
+
+func Test_Dispatch_Rate(t *testing.T) {
+	test := newDispatcherTest()
+	test.SetRates(map[string]int{RATE_MESSAGE: 2})
+	session := &testSession{loggedIn: true}
+	other := &testSession{loggedIn: true}
+
+	for i := 0; i < 2; i++ {
+		r := test.dispatch(t, newCmd(protocol.SEND_MESSAGE_P2P_CMD, "hello", "uid2"), session)
+		unitest.Pass(t, r.code == info.CODE_OK)
+	}
+	r := test.dispatch(t, newCmd(protocol.SEND_MESSAGE_P2P_CMD, "hello", "uid2"), session)
+	unitest.Pass(t, r.code == info.CODE_TOO_MANY_REQUESTS)
+
+	//其他类别和其他会话分别计数
+	r = test.dispatch(t, newCmd(protocol.SEND_PING_CMD), session)
+	unitest.Pass(t, r.code == info.CODE_OK)
+	r = test.dispatch(t, newCmd(protocol.SEND_MESSAGE_P2P_CMD, "hello", "uid2"), other)
+	unitest.Pass(t, r.code == info.CODE_OK)
+
+	test.Forget(session)
+	r = test.dispatch(t, newCmd(protocol.SEND_MESSAGE_P2P_CMD, "hello", "uid2"), session)
+	unitest.Pass(t, r.code == info.CODE_OK)
+}
+
+func Test_Dispatch_Unknown(t *testing.T) {
+	test := newDispatcherTest()
+	session := &testSession{loggedIn: true}
+
+	r := test.dispatch(t, newCmd("no_such_command"), session)
+	unitest.Pass(t, r.code == info.CODE_ILLEGAL_REQUEST)
+	unitest.Pass(t, r.respCmd == protocol.RESP_ERROR_CMD)
+
+	//登记过但这个服务器没有处理函数
+	r = test.dispatch(t, newCmd(protocol.SEND_CREATE_TOPIC_CMD, "t1"), session)
+	unitest.Pass(t, r.code == info.CODE_UNSUPPORTED_COMMAND)
+}
@@ -54,6 +54,20 @@ func handleSession(gw *Gateway, session *libnet.Session) {
 	}
 }
 
+func serve(cfg *GatewayConfig) (*libnet.Server, error) {
+	//超过MaxPacketSize的包断开连接,0不限制
+	codecType := libnet.PacketLimit(libnet.Uint16BE, cfg.MaxPacketSize, libnet.JsonOrMsgPack())
+	if !cfg.TLS.Enable {
+		return libnet.Serve(cfg.TransportProtocols, cfg.Listen, codecType)
+	}
+
+	tlsConfig, err := cfg.TLS.ServerConfig()
+	if err != nil {
+		return nil, err
+	}
+	return libnet.ServeTLS(cfg.TransportProtocols, cfg.Listen, tlsConfig, codecType)
+}
+
 func main() {
 	version()
 	fmt.Printf("built on %s\n", BuildTime())
@@ -68,7 +82,7 @@ func main() {
 	gw := NewGateway(cfg)
 
 	//gw.server, err = libnet.Serve(cfg.TransportProtocols, cfg.Listen, libnet.Json())
-	gw.server, err = libnet.Serve(cfg.TransportProtocols, cfg.Listen, libnet.Packet(libnet.Uint16BE, libnet.Json()))
+	gw.server, err = serve(cfg)
 	if err != nil {
 		panic(err)
 	}
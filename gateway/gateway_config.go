@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"goProject/libnet"
 	"goProject/log"
 	"os"
 	"time"
@@ -13,6 +14,8 @@ type GatewayConfig struct {
 	EtcdServer              string
 	ServiceDiscoveryTimeout time.Duration
 	Listen                  string
+	TLS                     libnet.TLSConfig
+	MaxPacketSize           int
 	LogFile                 string
 	MsgServerList           []string
 	MsgServerNum            int
@@ -45,11 +45,14 @@ func (self *ProtoProc) procReqMsgServer(cmd *protocol.CmdSimple, session *libnet
 	return err
 }
 
+//选连接数最少的msg_server,过载的不选,全部过载时在所有里面选
 func SelectServer(msgServerList []MsgServerInfo) MsgServerInfo {
 	var msgServer MsgServerInfo
 	msgServer = msgServerList[0]
 	for _, i := range msgServerList {
-		if i.SessionNum < msgServer.SessionNum {
+		if msgServer.Overload && !i.Overload {
+			msgServer = i
+		} else if i.Overload == msgServer.Overload && i.SessionNum < msgServer.SessionNum {
 			msgServer = i
 		}
 	}
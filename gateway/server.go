@@ -27,6 +27,7 @@ type MsgServerInfo struct {
 	Ip         string
 	CPU        int
 	SessionNum uint64
+	Overload   bool
 }
 
 func NewGateway(cfg *GatewayConfig) *Gateway {
@@ -48,7 +49,7 @@ func (self *Gateway) serviceDiscovery() {
 			self.msgServerList = []MsgServerInfo{}
 			for _, v := range self.master.Members {
 				if v.InGroup == true {
-					self.msgServerList = append(self.msgServerList, MsgServerInfo{v.IP, v.CPU, v.SessionNum})
+					self.msgServerList = append(self.msgServerList, MsgServerInfo{v.IP, v.CPU, v.SessionNum, v.Overload})
 				}
 			}
 			self.msgServerListMutex.Unlock()
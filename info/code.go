@@ -0,0 +1,184 @@
+package info
+
+import (
+	"fmt"
+	"strings"
+)
+
+//---------------------------------------------------------------------------
+// 错误码, 0为成功, 按千位分类, 已分配的值不能再改
+// 1xxx: 通用
+// 2xxx: 登录
+// 3xxx: 单聊和好友
+// 4xxx: 群组
+// 5xxx: 推送
+//---------------------------------------------------------------------------
+const (
+	CODE_OK = 0
+
+	//通用
+	CODE_ERROR                = 1000
+	CODE_NOT_ENOUGH_ARGUMENTS = 1001
+	CODE_ILLEGAL_REQUEST      = 1002
+	CODE_SERVER_BUSY          = 1003
+	CODE_UNSUPPORTED_VERSION  = 1004
+	CODE_FAILED_TO_PARSE_DATA = 1005
+	CODE_INVALID_ARGUMENTS    = 1006
+	CODE_MISSING_ARGUMENT     = 1007
+	CODE_DATABASE_ERROR       = 1008
+	CODE_ROUTE_ERROR          = 1009
+	CODE_ENCODE_ERROR         = 1010
+	CODE_SEND_MESSAGE_ERROR   = 1011
+	CODE_REPEAT_REGISTRATION  = 1012
+	CODE_UNSUPPORTED_COMMAND  = 1013
+	CODE_TOO_MANY_REQUESTS    = 1014
+
+	//登录
+	CODE_YOU_HAVE_NOT_LANDED              = 2000
+	CODE_INVALID_TOKEN                    = 2001
+	CODE_UNABLE_TO_ACCESS_THE_AUTH_SERVER = 2002
+	CODE_YOU_HAVE_TO_RE_LOGIN             = 2003
+
+	//单聊和好友
+	CODE_NO_CLIENT_INFO                = 3000
+	CODE_THIS_ID_IS_NOT_EXISTS         = 3001
+	CODE_THE_USER_CAN_NOT_BE_FOUND     = 3002
+	CODE_THE_ID_IS_ALREADY_YOUR_FRIEND = 3003
+	CODE_YOU_HAVE_NO_THIS_FRIEND       = 3004
+	CODE_YOU_HAVE_NO_FRIENDS           = 3005
+	CODE_NO_INITIATE_THIS_REQUEST      = 3006
+	CODE_THE_ASK_TYPE_IS_UNDEFINED     = 3007
+	CODE_THE_REACT_TYPE_IS_UNDEFINED   = 3008
+
+	//群组
+	CODE_CREATE_TOPIC_FAILURE         = 4000
+	CODE_TOPIC_ALREADY_EXISTS         = 4001
+	CODE_TOPIC_DOES_NOT_EXISTS        = 4002
+	CODE_YOU_HAVE_NO_TOPICS           = 4003
+	CODE_YOU_ARE_ALREADY_IN_THE_TOPIC = 4004
+	CODE_JOIN_TOPIC_FAILURE           = 4005
+	CODE_YOU_WERE_NOT_IN_TOPIC        = 4006
+	CODE_LEAVE_TOPIC_FAILURE          = 4007
+	CODE_NO_CLIENTS_IN_TOPIC          = 4008
+
+	//推送
+	CODE_UNABLE_TO_ACCESS_THE_PUSH_SERVER = 5000
+	CODE_PUSH_SERVER_ERROR                = 5001
+)
+
+const (
+	LOCALE_EN = "en"
+	LOCALE_ZH = "zh"
+	//客户端没有指定或者不支持的语言
+	DEFAULT_LOCALE = LOCALE_EN
+)
+
+//各语言的提示信息, 可以带fmt的参数
+var messages = map[string]map[int]string{
+	LOCALE_EN: {
+		CODE_ERROR:                            ERROR,
+		CODE_NOT_ENOUGH_ARGUMENTS:             NOT_ENOUGH_ARGUMENTS,
+		CODE_ILLEGAL_REQUEST:                  ILLEGAL_REQUEST,
+		CODE_SERVER_BUSY:                      SERVER_BUSY,
+		CODE_UNSUPPORTED_VERSION:              UNSUPPORTED_VERSION,
+		CODE_FAILED_TO_PARSE_DATA:             FAILED_TO_PARSE_DATA,
+		CODE_INVALID_ARGUMENTS:                INVALID_ARGUMENTS,
+		CODE_MISSING_ARGUMENT:                 MISSING_ARGUMENT,
+		CODE_DATABASE_ERROR:                   DATABASE_ERROR,
+		CODE_ROUTE_ERROR:                      ROUTE_ERROR,
+		CODE_ENCODE_ERROR:                     ENCODE_ERROR,
+		CODE_SEND_MESSAGE_ERROR:               SEND_MESSAGE_ERROR,
+		CODE_REPEAT_REGISTRATION:              REPEAT_REGISTRATION,
+		CODE_UNSUPPORTED_COMMAND:              UNSUPPORTED_COMMAND,
+		CODE_TOO_MANY_REQUESTS:                TOO_MANY_REQUESTS,
+		CODE_YOU_HAVE_NOT_LANDED:              YOU_HAVE_NOT_LANDED,
+		CODE_INVALID_TOKEN:                    INVALID_TOKEN,
+		CODE_UNABLE_TO_ACCESS_THE_AUTH_SERVER: UNABLE_TO_ACCESS_THE_AUTH_SERVER,
+		CODE_YOU_HAVE_TO_RE_LOGIN:             YOU_HAVE_TO_RE_LOGIN,
+		CODE_NO_CLIENT_INFO:                   NO_CLIENT_INFO,
+		CODE_THIS_ID_IS_NOT_EXISTS:            THIS_ID_IS_NOT_EXISTS,
+		CODE_THE_USER_CAN_NOT_BE_FOUND:        THE_USER_CAN_NOT_BE_FOUND,
+		CODE_THE_ID_IS_ALREADY_YOUR_FRIEND:    THE_ID_IS_ALREADY_YOUR_FRIEND,
+		CODE_YOU_HAVE_NO_THIS_FRIEND:          YOU_HAVE_NO_THIS_FRIEND,
+		CODE_YOU_HAVE_NO_FRIENDS:              YOU_HAVE_NO_FRIENDS,
+		CODE_NO_INITIATE_THIS_REQUEST:         NO_INITIATE_THIS_REQUEST,
+		CODE_THE_ASK_TYPE_IS_UNDEFINED:        THE_ASK_TYPE_IS_UNDEFINED,
+		CODE_THE_REACT_TYPE_IS_UNDEFINED:      THE_REACT_TYPE_IS_UNDEFINED,
+		CODE_CREATE_TOPIC_FAILURE:             CREATE_TOPIC_FAILURE,
+		CODE_TOPIC_ALREADY_EXISTS:             TOPIC_ALREADY_EXISTS,
+		CODE_TOPIC_DOES_NOT_EXISTS:            TOPIC_DOES_NOT_EXISTS,
+		CODE_YOU_HAVE_NO_TOPICS:               YOU_HAVE_NO_TOPICS,
+		CODE_YOU_ARE_ALREADY_IN_THE_TOPIC:     YOU_ARE_ALREADY_IN_THE_TOPIC,
+		CODE_JOIN_TOPIC_FAILURE:               JOIN_TOPIC_FAILURE,
+		CODE_YOU_WERE_NOT_IN_TOPIC:            YOU_WERE_NOT_IN_TOPIC,
+		CODE_LEAVE_TOPIC_FAILURE:              LEAVE_TOPIC_FAILURE,
+		CODE_NO_CLIENTS_IN_TOPIC:              NO_CLIENTS_IN_TOPIC,
+		CODE_UNABLE_TO_ACCESS_THE_PUSH_SERVER: UNABLE_TO_ACCESS_THE_PUSH_SERVER,
+		CODE_PUSH_SERVER_ERROR:                PUSH_SERVER_ERROR + "%d",
+	},
+	LOCALE_ZH: {
+		CODE_ERROR:                            "服务器错误.",
+		CODE_NOT_ENOUGH_ARGUMENTS:             "参数不足.",
+		CODE_ILLEGAL_REQUEST:                  "非法请求.",
+		CODE_SERVER_BUSY:                      "服务器繁忙, 请重新从网关获取msg_server.",
+		CODE_UNSUPPORTED_VERSION:              "不支持的协议版本.",
+		CODE_FAILED_TO_PARSE_DATA:             "数据解析失败.",
+		CODE_INVALID_ARGUMENTS:                "参数错误.",
+		CODE_MISSING_ARGUMENT:                 "参数不足, 缺少%s.",
+		CODE_DATABASE_ERROR:                   "数据库错误.",
+		CODE_ROUTE_ERROR:                      "消息转发失败.",
+		CODE_ENCODE_ERROR:                     "数据编码失败.",
+		CODE_SEND_MESSAGE_ERROR:               "消息发送失败.",
+		CODE_REPEAT_REGISTRATION:              "重复注册.",
+		CODE_UNSUPPORTED_COMMAND:              "该服务器不支持这个命令.",
+		CODE_TOO_MANY_REQUESTS:                "请求太频繁, 请稍后再试.",
+		CODE_YOU_HAVE_NOT_LANDED:              "您还没有登录.",
+		CODE_INVALID_TOKEN:                    "无效的token.",
+		CODE_UNABLE_TO_ACCESS_THE_AUTH_SERVER: "无法访问认证服务器.",
+		CODE_YOU_HAVE_TO_RE_LOGIN:             "您需要重新登录.",
+		CODE_NO_CLIENT_INFO:                   "没有用户信息.",
+		CODE_THIS_ID_IS_NOT_EXISTS:            "该ID不存在.",
+		CODE_THE_USER_CAN_NOT_BE_FOUND:        "找不到该用户.",
+		CODE_THE_ID_IS_ALREADY_YOUR_FRIEND:    "对方已经是您的好友.",
+		CODE_YOU_HAVE_NO_THIS_FRIEND:          "您没有这个好友.",
+		CODE_YOU_HAVE_NO_FRIENDS:              "您还没有好友.",
+		CODE_NO_INITIATE_THIS_REQUEST:         "对方没有发起这个请求.",
+		CODE_THE_ASK_TYPE_IS_UNDEFINED:        "未定义的请求类型.",
+		CODE_THE_REACT_TYPE_IS_UNDEFINED:      "未定义的回应类型.",
+		CODE_CREATE_TOPIC_FAILURE:             "创建群组失败.",
+		CODE_TOPIC_ALREADY_EXISTS:             "群组已经存在.",
+		CODE_TOPIC_DOES_NOT_EXISTS:            "群组不存在.",
+		CODE_YOU_HAVE_NO_TOPICS:               "您还没有加入群组.",
+		CODE_YOU_ARE_ALREADY_IN_THE_TOPIC:     "您已经在群组中.",
+		CODE_JOIN_TOPIC_FAILURE:               "加入群组失败.",
+		CODE_YOU_WERE_NOT_IN_TOPIC:            "您不在这个群组中.",
+		CODE_LEAVE_TOPIC_FAILURE:              "退出群组失败.",
+		CODE_NO_CLIENTS_IN_TOPIC:              "群组中没有成员.",
+		CODE_UNABLE_TO_ACCESS_THE_PUSH_SERVER: "无法访问推送服务器.",
+		CODE_PUSH_SERVER_ERROR:                "推送服务器错误:%d",
+	},
+}
+
+//取支持的语言, "zh-CN"、"zh_TW"都按"zh", 不支持的用DEFAULT_LOCALE
+func Locale(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		locale = locale[:i]
+	}
+	if _, ok := messages[locale]; ok {
+		return locale
+	}
+	return DEFAULT_LOCALE
+}
+
+//错误码对应的提示信息, 该语言没有的用DEFAULT_LOCALE的, 成功没有提示信息
+func Message(locale string, code int, args ...interface{}) string {
+	template, ok := messages[Locale(locale)][code]
+	if !ok {
+		template = messages[DEFAULT_LOCALE][code]
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(template, args...)
+	}
+	return template
+}
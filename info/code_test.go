@@ -0,0 +1,38 @@
+package info
+
+import (
+	"testing"
+
+	"github.com/funny/unitest"
+)
+
+func Test_Locale(t *testing.T) {
+	unitest.Pass(t, Locale("zh-CN") == LOCALE_ZH)
+	unitest.Pass(t, Locale(" ZH_tw ") == LOCALE_ZH)
+	unitest.Pass(t, Locale("en-US") == LOCALE_EN)
+	unitest.Pass(t, Locale("fr") == DEFAULT_LOCALE)
+	unitest.Pass(t, Locale("") == DEFAULT_LOCALE)
+}
+
+func Test_Message(t *testing.T) {
+	unitest.Pass(t, Message(LOCALE_EN, CODE_YOU_HAVE_NOT_LANDED) == YOU_HAVE_NOT_LANDED)
+	unitest.Pass(t, Message("zh-CN", CODE_YOU_HAVE_NOT_LANDED) == "您还没有登录.")
+	unitest.Pass(t, Message("fr", CODE_YOU_HAVE_NOT_LANDED) == YOU_HAVE_NOT_LANDED)
+	unitest.Pass(t, Message(LOCALE_EN, CODE_OK) == "")
+
+	unitest.Pass(t, Message(LOCALE_EN, CODE_MISSING_ARGUMENT, "to_id") == "There is not enough arguments, to_id is required.")
+	unitest.Pass(t, Message(LOCALE_ZH, CODE_PUSH_SERVER_ERROR, 500) == "推送服务器错误:500")
+}
+
+//每种语言都有所有错误码的提示, 错误码在所属的分类中
+func Test_Message_Codes(t *testing.T) {
+	for _, m := range messages {
+		unitest.Pass(t, len(m) == len(messages[DEFAULT_LOCALE]))
+		for code, message := range m {
+			unitest.Pass(t, code >= 1000 && code < 6000)
+			unitest.Pass(t, message != "")
+			_, ok := messages[DEFAULT_LOCALE][code]
+			unitest.Pass(t, ok)
+		}
+	}
+}
@@ -4,4 +4,14 @@ const (
 	ERROR                = "error."
 	NOT_ENOUGH_ARGUMENTS = "There is not enough arguments."
 	ILLEGAL_REQUEST      = "Illegal request."
+	SERVER_BUSY          = "Server busy, request a msg_server from the gateway again."
+	UNSUPPORTED_VERSION  = "Unsupported protocol version."
+	INVALID_ARGUMENTS    = "Invalid arguments."
+	MISSING_ARGUMENT     = "There is not enough arguments, %s is required."
+	DATABASE_ERROR       = "Database error."
+	ROUTE_ERROR          = "Unable to route the message."
+	ENCODE_ERROR         = "Failed to encode data."
+	REPEAT_REGISTRATION  = "Repeat registration."
+	UNSUPPORTED_COMMAND  = "Unsupported command."
+	TOO_MANY_REQUESTS    = "Too many requests, slow down."
 )
@@ -0,0 +1,166 @@
+package libnet
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrTooManySessions = errors.New("Too many sessions")
+	ErrAcceptRate      = errors.New("Accept rate exceeded")
+	ErrTooManyPerIP    = errors.New("Too many sessions from the IP")
+)
+
+// Limits checked by Accept, zero means no limit.
+type AdmissionLimit struct {
+	MaxSessions int
+	// accepts per second, bursts up to the same number
+	AcceptRate int
+	MaxPerIP   int
+}
+
+// How long the server reports overloaded after a session or rate limit hit.
+const overloadHold = time.Second
+
+type Admission struct {
+	limit  AdmissionLimit
+	reject func(*Session, error)
+
+	mutex      sync.Mutex
+	sessions   int
+	tokens     float64
+	lastRefill time.Time
+	perIP      map[string]int
+
+	// unix nano until which the server is overloaded
+	overloadUntil int64
+}
+
+// Limits and state shared by the servers using it, so MaxSessions and
+// MaxPerIP count the sessions of all of them and AcceptRate their accepts
+// together. Rejected connections are passed to reject in a new goroutine as
+// sessions the server doesn't track, so it can tell the client to try
+// elsewhere, and are closed when it returns. nil reject closes them at once.
+func NewAdmission(limit AdmissionLimit, reject func(session *Session, reason error)) *Admission {
+	return &Admission{
+		limit:      limit,
+		reject:     reject,
+		tokens:     float64(limit.AcceptRate),
+		lastRefill: time.Now(),
+		perIP:      make(map[string]int),
+	}
+}
+
+// Accept rejects connections over limit instead of returning them, see
+// NewAdmission. Must be called before Accept runs.
+func (server *Server) SetAdmission(limit AdmissionLimit, reject func(session *Session, reason error)) {
+	server.UseAdmission(NewAdmission(limit, reject))
+}
+
+// Like SetAdmission but with state shared with other servers.
+func (server *Server) UseAdmission(a *Admission) {
+	server.admission = a
+}
+
+// See Admission.Overloaded, false without admission control.
+func (server *Server) Overloaded() bool {
+	if server.admission == nil {
+		return false
+	}
+	return server.admission.Overloaded()
+}
+
+// True while sessions are at the limit or within a second after a
+// connection was rejected by the session or rate limit. Per IP rejects don't
+// count, a single client can't make the server look overloaded.
+func (a *Admission) Overloaded() bool {
+	if a.limit.MaxSessions > 0 {
+		a.mutex.Lock()
+		full := a.sessions >= a.limit.MaxSessions
+		a.mutex.Unlock()
+		if full {
+			return true
+		}
+	}
+	return time.Now().UnixNano() < atomic.LoadInt64(&a.overloadUntil)
+}
+
+func (server *Server) admit(conn net.Conn) error {
+	a := server.admission
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.limit.MaxSessions > 0 && a.sessions >= a.limit.MaxSessions {
+		a.overload()
+		return ErrTooManySessions
+	}
+
+	if a.limit.AcceptRate > 0 {
+		now := time.Now()
+		a.tokens += now.Sub(a.lastRefill).Seconds() * float64(a.limit.AcceptRate)
+		if a.tokens > float64(a.limit.AcceptRate) {
+			a.tokens = float64(a.limit.AcceptRate)
+		}
+		a.lastRefill = now
+		if a.tokens < 1 {
+			a.overload()
+			return ErrAcceptRate
+		}
+		a.tokens--
+	}
+
+	if a.limit.MaxPerIP > 0 {
+		ip := remoteIP(conn)
+		if a.perIP[ip] >= a.limit.MaxPerIP {
+			return ErrTooManyPerIP
+		}
+		a.perIP[ip]++
+	}
+	a.sessions++
+	return nil
+}
+
+func (server *Server) release(session *Session) {
+	a := server.admission
+	if a == nil {
+		return
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.sessions--
+	if a.limit.MaxPerIP > 0 {
+		ip := remoteIP(session.conn)
+		if a.perIP[ip]--; a.perIP[ip] <= 0 {
+			delete(a.perIP, ip)
+		}
+	}
+}
+
+func (server *Server) rejectSession(conn net.Conn, reason error) {
+	a := server.admission
+	if a.reject == nil {
+		conn.Close()
+		return
+	}
+	session := NewSession(conn, server.codecType)
+	go func() {
+		defer session.Close()
+		a.reject(session, reason)
+	}()
+}
+
+func (a *Admission) overload() {
+	atomic.StoreInt64(&a.overloadUntil, time.Now().Add(overloadHold).UnixNano())
+}
+
+func remoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,150 @@
+package libnet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funny/unitest"
+)
+
+type admissionTest struct {
+	server   *Server
+	accepted chan *Session
+	rejected chan error
+}
+
+func newAdmissionTest(t *testing.T, limit AdmissionLimit) *admissionTest {
+	server, err := Serve("tcp", "127.0.0.1:0", String(Uint16BE))
+	unitest.NotError(t, err)
+
+	test := &admissionTest{
+		server:   server,
+		accepted: make(chan *Session, 10),
+		rejected: make(chan error, 10),
+	}
+	server.SetAdmission(limit, func(session *Session, reason error) {
+		session.Send("busy")
+		test.rejected <- reason
+	})
+
+	go func() {
+		for {
+			session, err := server.Accept()
+			if err != nil {
+				return
+			}
+			test.accepted <- session
+		}
+	}()
+	return test
+}
+
+// Connect and return the server side session if the server took the
+// connection.
+func (test *admissionTest) connect(t *testing.T) (*Session, error) {
+	client, err := Connect("tcp", test.server.Listener().Addr().String(), String(Uint16BE))
+	unitest.NotError(t, err)
+
+	select {
+	case session := <-test.accepted:
+		return session, nil
+	case reason := <-test.rejected:
+		var msg string
+		unitest.NotError(t, client.Receive(&msg))
+		unitest.Pass(t, msg == "busy")
+		client.Close()
+		return nil, reason
+	case <-time.After(time.Second):
+		t.Fatal("connection neither accepted nor rejected")
+	}
+	return nil, nil
+}
+
+func Test_Admission_MaxSessions(t *testing.T) {
+	test := newAdmissionTest(t, AdmissionLimit{MaxSessions: 2})
+	defer test.server.Stop()
+
+	_, err := test.connect(t)
+	unitest.NotError(t, err)
+	session, err := test.connect(t)
+	unitest.NotError(t, err)
+	unitest.Pass(t, test.server.Overloaded())
+
+	_, err = test.connect(t)
+	unitest.Pass(t, err == ErrTooManySessions)
+
+	// room again once a session is gone
+	session.Close()
+	_, err = test.connect(t)
+	unitest.NotError(t, err)
+}
+
+func Test_Admission_AcceptRate(t *testing.T) {
+	test := newAdmissionTest(t, AdmissionLimit{AcceptRate: 2})
+	defer test.server.Stop()
+
+	_, err := test.connect(t)
+	unitest.NotError(t, err)
+	_, err = test.connect(t)
+	unitest.NotError(t, err)
+	unitest.Pass(t, !test.server.Overloaded())
+
+	_, err = test.connect(t)
+	unitest.Pass(t, err == ErrAcceptRate)
+	unitest.Pass(t, test.server.Overloaded())
+
+	time.Sleep(time.Second)
+	_, err = test.connect(t)
+	unitest.NotError(t, err)
+}
+
+func Test_Admission_MaxPerIP(t *testing.T) {
+	test := newAdmissionTest(t, AdmissionLimit{MaxPerIP: 1})
+	defer test.server.Stop()
+
+	session, err := test.connect(t)
+	unitest.NotError(t, err)
+
+	_, err = test.connect(t)
+	unitest.Pass(t, err == ErrTooManyPerIP)
+	unitest.Pass(t, !test.server.Overloaded())
+
+	session.Close()
+	_, err = test.connect(t)
+	unitest.NotError(t, err)
+}
+
+// Servers sharing an Admission count their sessions together.
+func Test_Admission_Shared(t *testing.T) {
+	test := newAdmissionTest(t, AdmissionLimit{MaxSessions: 1})
+	defer test.server.Stop()
+
+	other := &admissionTest{
+		accepted: test.accepted,
+		rejected: test.rejected,
+	}
+	server, err := Serve("tcp", "127.0.0.1:0", String(Uint16BE))
+	unitest.NotError(t, err)
+	defer server.Stop()
+	server.UseAdmission(test.server.admission)
+	other.server = server
+	go func() {
+		for {
+			session, err := server.Accept()
+			if err != nil {
+				return
+			}
+			other.accepted <- session
+		}
+	}()
+
+	session, err := test.connect(t)
+	unitest.NotError(t, err)
+	_, err = other.connect(t)
+	unitest.Pass(t, err == ErrTooManySessions)
+	unitest.Pass(t, server.Overloaded())
+
+	session.Close()
+	_, err = other.connect(t)
+	unitest.NotError(t, err)
+}
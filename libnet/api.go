@@ -1,6 +1,7 @@
 package libnet
 
 import (
+	"crypto/tls"
 	"io"
 	"net"
 	"time"
@@ -38,3 +39,27 @@ func ConnectTimeout(network, address string, timeout time.Duration, codecType Co
 	}
 	return NewSession(conn, codecType), nil
 }
+
+func ServeTLS(network, address string, config *tls.Config, codecType CodecType) (*Server, error) {
+	listener, err := tls.Listen(network, address, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(listener, codecType), nil
+}
+
+func ConnectTLS(network, address string, config *tls.Config, codecType CodecType) (*Session, error) {
+	conn, err := tls.Dial(network, address, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewSession(conn, codecType), nil
+}
+
+func ConnectTimeoutTLS(network, address string, timeout time.Duration, config *tls.Config, codecType CodecType) (*Session, error) {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, network, address, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewSession(conn, codecType), nil
+}
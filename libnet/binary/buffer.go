@@ -121,6 +121,12 @@ func (b *Buffer) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+func (b *Buffer) WriteString(s string) (int, error) {
+	i := b.Grows(len(s))
+	copy(b.Data[i:], s)
+	return len(s), nil
+}
+
 // io.ByteWriter
 func (b *Buffer) WriteByte(c byte) error {
 	i := b.Grows(1)
@@ -8,13 +8,49 @@ type PacketReader struct {
 	Spliter Spliter
 	Reader  *Reader
 	Buffer  Buffer
+	// Largest packet accepted, 0 means no limit.
+	MaxSize int
+	// buffer of the last packet read by a PoolSpliter
+	pooled *[]byte
 }
 
 func NewPacketReader(spliter Spliter, reader io.Reader) *PacketReader {
+	return NewPacketReaderLimit(spliter, 0, reader)
+}
+
+// Reading a packet larger than maxSize fails with ErrPacketTooLarge.
+func NewPacketReaderLimit(spliter Spliter, maxSize int, reader io.Reader) *PacketReader {
 	if _, ok := reader.(*Reader); !ok {
 		reader = NewReader(reader)
 	}
-	return &PacketReader{Spliter: spliter, Reader: reader.(*Reader)}
+	return &PacketReader{Spliter: spliter, Reader: reader.(*Reader), MaxSize: maxSize}
+}
+
+// The packet is only valid until the next ReadPacket or Read, spliters
+// implementing PoolSpliter read into a pooled buffer given back then.
+func (r *PacketReader) ReadPacket() []byte {
+	if r.pooled != nil {
+		PutBuffer(r.pooled)
+		r.pooled = nil
+	}
+
+	s, ok := r.Spliter.(PoolSpliter)
+	if !ok {
+		return r.Reader.ReadPacketLimit(r.Spliter, r.MaxSize)
+	}
+	if r.Reader.Error() != nil {
+		return nil
+	}
+	r.pooled = s.ReadPooled(r.Reader, r.MaxSize)
+	if r.pooled == nil {
+		return nil
+	}
+	return *r.pooled
+}
+
+// Bytes of the current packet not read yet.
+func (r *PacketReader) Len() int {
+	return len(r.Buffer.Data) - r.Buffer.ReadPos
 }
 
 func (r *PacketReader) Read(p []byte) (int, error) {
@@ -28,32 +64,110 @@ func (r *PacketReader) Read(p []byte) (int, error) {
 			return 0, err
 		}
 
-		r.Buffer.Reset(r.Reader.ReadPacket(r.Spliter))
+		r.Buffer.Reset(r.ReadPacket())
 		if r.Reader.Error() != nil {
 			return 0, r.Reader.Error()
 		}
 	}
 }
 
+// Room kept in front of the packet in PacketWriter.Buffer, so the head can
+// be put there and the packet written with a single Write.
+const packetHeadRoom = MaxVarintLen64
+
 type PacketWriter struct {
 	Spliter Spliter
 	Writer  *Writer
-	Buffer  Buffer
+	// Head room followed by the packet, from GetBuffer.
+	Buffer Buffer
+	pooled *[]byte
+	// size of the last packet, to get a big enough buffer at once
+	lastSize int
+
+	head       Buffer
+	headData   [packetHeadRoom]byte
+	headWriter Writer
 }
 
 func NewPacketWriter(spliter Spliter, writer io.Writer) *PacketWriter {
 	if _, ok := writer.(*Writer); !ok {
 		writer = NewWriter(writer)
 	}
-	return &PacketWriter{Spliter: spliter, Writer: writer.(*Writer)}
+	w := &PacketWriter{Spliter: spliter, Writer: writer.(*Writer)}
+	w.headWriter.w = &w.head
+	return w
+}
+
+// Make room for n more bytes, from the pool.
+func (w *PacketWriter) buffer(n int) {
+	if w.pooled == nil {
+		size := n
+		if size < w.lastSize {
+			size = w.lastSize
+		}
+		w.pooled = GetBuffer(packetHeadRoom + size)
+		w.Buffer.Reset((*w.pooled)[:packetHeadRoom])
+		return
+	}
+	size := len(w.Buffer.Data)
+	if size+n <= cap(w.Buffer.Data) {
+		return
+	}
+	pooled := GetBuffer(2 * (size + n))
+	copy(*pooled, w.Buffer.Data)
+	*w.pooled = w.Buffer.Data
+	PutBuffer(w.pooled)
+	w.pooled = pooled
+	w.Buffer.Reset((*pooled)[:size])
 }
 
 func (w *PacketWriter) Write(p []byte) (int, error) {
+	w.buffer(len(p))
 	return w.Buffer.Write(p)
 }
 
+func (w *PacketWriter) WriteString(s string) (int, error) {
+	w.buffer(len(s))
+	return w.Buffer.WriteString(s)
+}
+
+// io.ByteWriter
+func (w *PacketWriter) WriteByte(c byte) error {
+	w.buffer(1)
+	return w.Buffer.WriteByte(c)
+}
+
+// Write the packet and give the buffer back to the pool. The head and the
+// delimiter are put around the packet in place, so both are written in one
+// call without copying the packet.
 func (w *PacketWriter) Flush() error {
-	w.Writer.WritePacket(w.Buffer.Data, w.Spliter)
-	w.Buffer.Reset(w.Buffer.Data[0:0])
+	w.buffer(0)
+	packet := w.Buffer.Data[packetHeadRoom:]
+
+	switch s := w.Spliter.(type) {
+	case HeadSpliter:
+		w.head.Reset(w.headData[:0])
+		s.WriteHead(&w.headWriter, len(packet))
+		if n := w.head.Length(); n <= packetHeadRoom {
+			i := packetHeadRoom - n
+			copy(w.Buffer.Data[i:], w.head.Data)
+			w.Writer.WriteBytes(w.Buffer.Data[i:])
+		} else {
+			w.Writer.WritePacket(packet, s)
+		}
+	case DelimSpliter:
+		if len(packet) == 0 || packet[len(packet)-1] != s.delim {
+			w.Buffer.WriteByte(s.delim)
+		}
+		w.Writer.WriteBytes(w.Buffer.Data[packetHeadRoom:])
+	default:
+		w.Writer.WritePacket(packet, w.Spliter)
+	}
+
+	w.lastSize = len(packet)
+	*w.pooled = w.Buffer.Data
+	PutBuffer(w.pooled)
+	w.pooled = nil
+	w.Buffer.Reset(nil)
 	return w.Writer.Flush()
 }
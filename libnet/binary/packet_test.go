@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"github.com/funny/unitest"
 	"io"
+	"io/ioutil"
 	"testing"
 )
 
@@ -28,3 +29,155 @@ func Test_PacketReaderWriter(t *testing.T) {
 		unitest.Pass(t, bytes.Equal(p1, p2))
 	}
 }
+
+func Test_PacketReader_MaxSize(t *testing.T) {
+	for _, s := range allSpliters {
+		buffer := NewBuffer(nil)
+		r := NewPacketReaderLimit(s.spliter, 100, buffer)
+		w := NewPacketWriter(s.spliter, buffer)
+
+		p1 := limitPacket(100)
+		p2 := make([]byte, len(p1))
+		w.Write(p1)
+		unitest.NotError(t, w.Flush())
+
+		_, err := io.ReadFull(r, p2)
+		unitest.NotError(t, err)
+		unitest.Pass(t, bytes.Equal(p1, p2))
+
+		w.Write(limitPacket(101))
+		unitest.NotError(t, w.Flush())
+
+		_, err = r.Read(p2)
+		if err != ErrPacketTooLarge {
+			t.Fatalf("%s: got %v, want ErrPacketTooLarge", s.name, err)
+		}
+	}
+}
+
+type countWriter struct {
+	Buffer
+	writes int
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+// Head and packet go out in one Write, the same bytes the spliter writes.
+func Test_PacketWriter_OneWrite(t *testing.T) {
+	for _, s := range allSpliters {
+		for _, size := range []int{0, 1, 100, 5000} {
+			p := limitPacket(size)
+			want := NewBuffer(nil)
+			NewWriter(want).WritePacket(p, s.spliter)
+
+			cw := new(countWriter)
+			w := NewPacketWriter(s.spliter, cw)
+			for i := 0; i < 2; i++ {
+				// in small pieces, so the buffer grows
+				for j := 0; j < size; j += 64 {
+					w.Write(p[j:minInt(j+64, size)])
+				}
+				unitest.NotError(t, w.Flush())
+			}
+			if cw.writes != 2 || !bytes.Equal(cw.Data, append(want.Data, want.Data...)) {
+				t.Fatalf("%s %d: %d writes, %q", s.name, size, cw.writes, cw.Data)
+			}
+		}
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// The packet buffer is reused only after the packet was read through.
+func Test_PacketReader_Reuse(t *testing.T) {
+	buffer := NewBuffer(nil)
+	w := NewPacketWriter(SplitByUint16BE, buffer)
+	for _, p := range []string{"aaaa", "bbbb", "cccc"} {
+		w.Write([]byte(p))
+		w.Flush()
+	}
+
+	r := NewPacketReader(SplitByUint16BE, buffer)
+	p := make([]byte, 2)
+	for _, want := range []string{"aa", "aa", "bb", "bb", "cc", "cc"} {
+		_, err := io.ReadFull(r, p)
+		unitest.NotError(t, err)
+		unitest.Pass(t, string(p) == want)
+	}
+}
+
+// Endless stream of the same packet.
+type repeatReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := copy(p, r.data[r.pos:])
+	r.pos = (r.pos + n) % len(r.data)
+	return n, nil
+}
+
+func benchmarkPacketReader(b *testing.B, spliter Spliter, size int) {
+	buffer := NewBuffer(nil)
+	w := NewPacketWriter(spliter, buffer)
+	w.Write(limitPacket(size))
+	w.Flush()
+
+	r := NewPacketReader(spliter, &repeatReader{data: buffer.Data})
+	p := make([]byte, size)
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := io.ReadFull(r, p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkPacketWriter(b *testing.B, spliter Spliter, size int) {
+	w := NewPacketWriter(spliter, ioutil.Discard)
+	p := limitPacket(size)
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Write(p)
+		if err := w.Flush(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Benchmark_PacketReader_Uint16BE_256(b *testing.B) {
+	benchmarkPacketReader(b, SplitByUint16BE, 256)
+}
+
+func Benchmark_PacketReader_Uint16BE_4096(b *testing.B) {
+	benchmarkPacketReader(b, SplitByUint16BE, 4096)
+}
+
+func Benchmark_PacketReader_Line_256(b *testing.B) {
+	benchmarkPacketReader(b, SplitByLine, 256)
+}
+
+func Benchmark_PacketWriter_Uint16BE_256(b *testing.B) {
+	benchmarkPacketWriter(b, SplitByUint16BE, 256)
+}
+
+func Benchmark_PacketWriter_Uint16BE_4096(b *testing.B) {
+	benchmarkPacketWriter(b, SplitByUint16BE, 4096)
+}
+
+func Benchmark_PacketWriter_Line_256(b *testing.B) {
+	benchmarkPacketWriter(b, SplitByLine, 256)
+}
@@ -0,0 +1,54 @@
+package binary
+
+import (
+	"sync"
+)
+
+// Buffers of 64 bytes to 64K are pooled by powers of two, larger ones are
+// left to the GC.
+const (
+	minPoolShift = 6
+	maxPoolShift = 16
+)
+
+var bufferPools [maxPoolShift - minPoolShift + 1]sync.Pool
+
+func poolIndex(size int) int {
+	i := 0
+	for size > 1<<uint(minPoolShift+i) {
+		i++
+	}
+	return i
+}
+
+// Get a buffer of length size from the pool. Give it back with PutBuffer once
+// nothing refers to it anymore. Pointers to slices are pooled so Get and Put
+// don't allocate.
+func GetBuffer(size int) *[]byte {
+	if size > 1<<maxPoolShift {
+		b := make([]byte, size)
+		return &b
+	}
+	i := poolIndex(size)
+	if b, ok := bufferPools[i].Get().(*[]byte); ok {
+		*b = (*b)[:size]
+		return b
+	}
+	b := make([]byte, size, 1<<uint(minPoolShift+i))
+	return &b
+}
+
+// Give back a buffer from GetBuffer. Buffers grown by append are accepted
+// too, they go to the largest class they can hold.
+func PutBuffer(b *[]byte) {
+	c := cap(*b)
+	if c < 1<<minPoolShift || c > 1<<maxPoolShift {
+		return
+	}
+	i := poolIndex(c)
+	if c < 1<<uint(minPoolShift+i) {
+		i--
+	}
+	*b = (*b)[:0]
+	bufferPools[i].Put(b)
+}
@@ -0,0 +1,36 @@
+package binary
+
+import (
+	"github.com/funny/unitest"
+	"testing"
+)
+
+func Test_BufferPool(t *testing.T) {
+	for _, size := range []int{0, 1, 64, 65, 1000, 1 << 16} {
+		b := GetBuffer(size)
+		unitest.Pass(t, len(*b) == size)
+		unitest.Pass(t, cap(*b) >= size && cap(*b) >= 64)
+		PutBuffer(b)
+	}
+
+	// too large to pool
+	b := GetBuffer(1<<16 + 1)
+	unitest.Pass(t, len(*b) == 1<<16+1)
+	PutBuffer(b)
+
+	// a grown buffer goes to the class it can hold
+	b = GetBuffer(10)
+	*b = append(*b, make([]byte, 100)...)
+	PutBuffer(b)
+	for i := 0; i < 10; i++ {
+		b = GetBuffer(128)
+		unitest.Pass(t, cap(*b) >= 128)
+	}
+}
+
+func Benchmark_BufferPool(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		PutBuffer(GetBuffer(1000))
+	}
+}
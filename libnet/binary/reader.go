@@ -11,11 +11,15 @@ type DelimReader interface {
 }
 
 type Reader struct {
-	r   io.Reader
-	buf [MaxVarintLen64]byte
-	err error
+	r    io.Reader
+	buf  [MaxVarintLen64]byte
+	temp []byte
+	err  error
 }
 
+// Longest ReadBytesTemp kept for reuse.
+const maxTempSize = 4096
+
 func NewReader(r io.Reader) *Reader {
 	return &Reader{r: r}
 }
@@ -85,6 +89,74 @@ func (reader *Reader) Delimit(delim byte) (b []byte) {
 	return
 }
 
+// Like Delimit, but fails with ErrPacketTooLarge once limit bytes are read
+// without finding delim.
+func (reader *Reader) DelimitLimit(delim byte, limit int) (b []byte) {
+	b = reader.appendDelimit(nil, delim, limit)
+	if reader.err == ErrPacketTooLarge {
+		return nil
+	}
+	return
+}
+
+// Append bytes up to and including delim to b, limit 0 means no limit.
+func (reader *Reader) appendDelimit(b []byte, delim byte, limit int) []byte {
+	if reader.err != nil {
+		return b
+	}
+	br := reader.getByteReader()
+	for n := 0; ; n++ {
+		var c byte
+		c, reader.err = br.ReadByte()
+		if reader.err != nil {
+			return b
+		}
+		b = append(b, c)
+		if c == delim {
+			return b
+		}
+		if limit > 0 && n+1 >= limit {
+			reader.err = ErrPacketTooLarge
+			return b
+		}
+	}
+}
+
+// Like DelimitLimit, but the bytes are only valid until the next read. Lines
+// are not copied when they fit in the buffer of the underlying reader.
+func (reader *Reader) delimitTemp(delim byte, limit int) []byte {
+	if reader.err != nil {
+		return nil
+	}
+	var b []byte
+	switch r := reader.getByteReader().(type) {
+	case *bufio.Reader:
+		b, reader.err = r.ReadSlice(delim)
+		if reader.err == bufio.ErrBufferFull {
+			reader.err = nil
+			b = append(reader.temp[:0], b...)
+			if limit > 0 && len(b) >= limit {
+				reader.err = ErrPacketTooLarge
+				return nil
+			}
+			b = reader.appendDelimit(b, delim, limit-len(b))
+			reader.keepTemp(b)
+		}
+	case *Buffer:
+		b, reader.err = r.ReadBytes(delim)
+	default:
+		b = reader.appendDelimit(reader.temp[:0], delim, limit)
+		reader.keepTemp(b)
+	}
+	if reader.err == nil && limit > 0 && len(b) > limit {
+		reader.err = ErrPacketTooLarge
+	}
+	if reader.err != nil {
+		return nil
+	}
+	return b
+}
+
 func (reader *Reader) ReadPacket(spliter Spliter) (b []byte) {
 	if reader.err != nil {
 		return nil
@@ -93,6 +165,27 @@ func (reader *Reader) ReadPacket(spliter Spliter) (b []byte) {
 	return
 }
 
+// Read a packet of at most max bytes, a larger one fails with
+// ErrPacketTooLarge. Spliters not implementing LimitSpliter are checked after
+// reading the packet.
+func (reader *Reader) ReadPacketLimit(spliter Spliter, max int) (b []byte) {
+	if reader.err != nil {
+		return nil
+	}
+	if max <= 0 {
+		return spliter.Read(reader)
+	}
+	if s, ok := spliter.(LimitSpliter); ok {
+		return s.ReadLimit(reader, max)
+	}
+	b = spliter.Read(reader)
+	if reader.err == nil && len(b) > max {
+		reader.err = ErrPacketTooLarge
+		return nil
+	}
+	return
+}
+
 func (reader *Reader) ReadFull(b []byte) (n int, err error) {
 	if reader.err != nil {
 		return 0, reader.err
@@ -108,8 +201,28 @@ func (reader *Reader) ReadBytes(n int) (b []byte) {
 	return b[:nn]
 }
 
+// Like ReadBytes, but the bytes are only valid until the next ReadBytesTemp
+// or ReadString, the buffer is reused.
+func (reader *Reader) ReadBytesTemp(n int) []byte {
+	if n > maxTempSize {
+		return reader.ReadBytes(n)
+	}
+	if cap(reader.temp) < n {
+		reader.temp = make([]byte, n)
+	}
+	b := reader.temp[:n]
+	nn, _ := reader.ReadFull(b)
+	return b[:nn]
+}
+
+func (reader *Reader) keepTemp(b []byte) {
+	if cap(b) <= maxTempSize {
+		reader.temp = b
+	}
+}
+
 func (reader *Reader) ReadString(n int) string {
-	return string(reader.ReadBytes(n))
+	return string(reader.ReadBytesTemp(n))
 }
 
 func (reader *Reader) ReadUvarint() (v uint64) {
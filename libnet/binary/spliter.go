@@ -1,14 +1,29 @@
 package binary
 
 import (
+	"errors"
 	"io"
 )
 
+var ErrPacketTooLarge = errors.New("binary: packet too large")
+
 type Spliter interface {
 	Read(*Reader) []byte
 	Write(*Writer, []byte)
 }
 
+// Implemented by spliters that can refuse an oversized packet before reading
+// it. max is the largest packet accepted, 0 means no limit.
+type LimitSpliter interface {
+	ReadLimit(r *Reader, max int) []byte
+}
+
+// Implemented by spliters that can read a packet into a buffer from
+// GetBuffer, so PacketReader can reuse it. Returns nil on error.
+type PoolSpliter interface {
+	ReadPooled(r *Reader, max int) *[]byte
+}
+
 type Limiter interface {
 	Limit(io.Reader) *io.LimitedReader
 }
@@ -22,13 +37,36 @@ func SplitByDelim(delim byte) DelimSpliter {
 }
 
 func (s DelimSpliter) Read(r *Reader) []byte {
-	b := r.Delimit(s.delim)
+	return s.ReadLimit(r, 0)
+}
+
+func (s DelimSpliter) ReadLimit(r *Reader, max int) []byte {
+	var b []byte
+	if max > 0 {
+		// the delimiter is not part of the packet
+		b = r.DelimitLimit(s.delim, max+1)
+	} else {
+		b = r.Delimit(s.delim)
+	}
 	if len(b) > 0 {
 		b = b[:len(b)-1]
 	}
 	return b
 }
 
+func (s DelimSpliter) ReadPooled(r *Reader, max int) *[]byte {
+	if max > 0 {
+		max++
+	}
+	line := r.delimitTemp(s.delim, max)
+	if line == nil {
+		return nil
+	}
+	b := GetBuffer(len(line) - 1)
+	copy(*b, line)
+	return b
+}
+
 func (s DelimSpliter) Write(w *Writer, b []byte) {
 	if _, err := w.Write(b); err != nil {
 		return
@@ -44,8 +82,12 @@ type HeadSpliter struct {
 }
 
 func (s HeadSpliter) Read(r *Reader) []byte {
-	n := s.ReadHead(r)
-	if r.Error() != nil {
+	return s.ReadLimit(r, 0)
+}
+
+func (s HeadSpliter) ReadLimit(r *Reader, max int) []byte {
+	n := s.readHead(r, max)
+	if n < 0 {
 		return nil
 	}
 	b := make([]byte, n)
@@ -55,6 +97,33 @@ func (s HeadSpliter) Read(r *Reader) []byte {
 	return b
 }
 
+func (s HeadSpliter) ReadPooled(r *Reader, max int) *[]byte {
+	n := s.readHead(r, max)
+	if n < 0 {
+		return nil
+	}
+	b := GetBuffer(n)
+	if _, err := io.ReadFull(r, *b); err != nil {
+		PutBuffer(b)
+		return nil
+	}
+	return b
+}
+
+// Packet length, -1 on error.
+func (s HeadSpliter) readHead(r *Reader, max int) int {
+	n := s.ReadHead(r)
+	if r.Error() != nil {
+		return -1
+	}
+	// a 64 bits head may overflow int
+	if n < 0 || (max > 0 && n > max) {
+		r.err = ErrPacketTooLarge
+		return -1
+	}
+	return n
+}
+
 func (s HeadSpliter) Write(w *Writer, b []byte) {
 	s.WriteHead(w, len(b))
 	if w.Error() != nil {
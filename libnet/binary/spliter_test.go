@@ -251,3 +251,117 @@ func Test_Uint64LE_Spliter(t *testing.T) {
 		unitest.Pass(t, bytes.Equal(b1, b2))
 	})
 }
+
+var allSpliters = []struct {
+	name    string
+	spliter Spliter
+}{
+	{"Line", SplitByLine},
+	{"Null", SplitByNull},
+	{"Uvarint", SplitByUvarint},
+	{"Uint8", SplitByUint8},
+	{"Uint16BE", SplitByUint16BE},
+	{"Uint16LE", SplitByUint16LE},
+	{"Uint24BE", SplitByUint24BE},
+	{"Uint24LE", SplitByUint24LE},
+	{"Uint32BE", SplitByUint32BE},
+	{"Uint32LE", SplitByUint32LE},
+	{"Uint40BE", SplitByUint40BE},
+	{"Uint40LE", SplitByUint40LE},
+	{"Uint48BE", SplitByUint48BE},
+	{"Uint48LE", SplitByUint48LE},
+	{"Uint56BE", SplitByUint56BE},
+	{"Uint56LE", SplitByUint56LE},
+	{"Uint64BE", SplitByUint64BE},
+	{"Uint64LE", SplitByUint64LE},
+}
+
+// Packet of n bytes without the delimiters of the delim spliters.
+func limitPacket(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = 'a'
+	}
+	return b
+}
+
+func Test_Spliter_Limit(t *testing.T) {
+	const max = 100
+	for _, s := range allSpliters {
+		buffer := NewBuffer(nil)
+		r := NewReader(buffer)
+		w := NewWriter(buffer)
+
+		b1 := limitPacket(max)
+		w.WritePacket(b1, s.spliter)
+		w.Flush()
+		unitest.NotError(t, w.Error())
+
+		b2 := r.ReadPacketLimit(s.spliter, max)
+		if r.Error() != nil {
+			t.Fatalf("%s: %s", s.name, r.Error())
+		}
+		unitest.Pass(t, bytes.Equal(b1, b2))
+
+		w.WritePacket(limitPacket(max+1), s.spliter)
+		w.Flush()
+		unitest.NotError(t, w.Error())
+
+		b3 := r.ReadPacketLimit(s.spliter, max)
+		if r.Error() != ErrPacketTooLarge {
+			t.Fatalf("%s: got %v, want ErrPacketTooLarge", s.name, r.Error())
+		}
+		unitest.Pass(t, b3 == nil)
+	}
+}
+
+// A head claiming the largest packet it can fails without waiting for the
+// body.
+func Test_Spliter_LimitHugeHead(t *testing.T) {
+	for _, s := range allSpliters {
+		head, ok := s.spliter.(HeadSpliter)
+		if !ok {
+			continue
+		}
+		buffer := NewBuffer(nil)
+		r := NewReader(buffer)
+		w := NewWriter(buffer)
+
+		// all bits set whatever the head width
+		head.WriteHead(w, -1)
+		w.Flush()
+		unitest.NotError(t, w.Error())
+
+		r.ReadPacketLimit(s.spliter, 100)
+		if r.Error() != ErrPacketTooLarge {
+			t.Fatalf("%s: got %v", s.name, r.Error())
+		}
+	}
+}
+
+// A 64 bits head overflowing int fails even without a limit.
+func Test_Spliter_HeadOverflow(t *testing.T) {
+	buffer := NewBuffer(nil)
+	r := NewReader(buffer)
+	w := NewWriter(buffer)
+
+	w.WriteUint64BE(1 << 63)
+	w.Flush()
+	unitest.NotError(t, w.Error())
+
+	r.ReadPacket(SplitByUint64BE)
+	unitest.Pass(t, r.Error() == ErrPacketTooLarge)
+}
+
+func Test_Delim_Spliter_LimitNoDelim(t *testing.T) {
+	buffer := NewBuffer(nil)
+	r := NewReader(buffer)
+	w := NewWriter(buffer)
+
+	w.Write(limitPacket(1000))
+	w.Flush()
+	unitest.NotError(t, w.Error())
+
+	r.ReadPacketLimit(SplitByLine, 100)
+	unitest.Pass(t, r.Error() == ErrPacketTooLarge)
+}
@@ -14,6 +14,10 @@ type FlushWriter interface {
 	Flush() error
 }
 
+type StringWriter interface {
+	WriteString(s string) (n int, err error)
+}
+
 type Writer struct {
 	w   io.Writer
 	wb  [MaxVarintLen64]byte
@@ -41,7 +45,7 @@ func (writer *Writer) Error() error {
 }
 
 func (writer *Writer) Flush() error {
-	if flusher, ok := writer.w.(FlushWriter); writer.err != nil && ok {
+	if flusher, ok := writer.w.(FlushWriter); writer.err == nil && ok {
 		writer.err = flusher.Flush()
 	}
 	return writer.err
@@ -77,6 +81,13 @@ func (writer *Writer) WriteBytes(b []byte) {
 }
 
 func (writer *Writer) WriteString(s string) {
+	if writer.err != nil {
+		return
+	}
+	if w, ok := writer.w.(StringWriter); ok {
+		_, writer.err = w.WriteString(s)
+		return
+	}
 	writer.WriteBytes([]byte(s))
 }
 
@@ -0,0 +1,132 @@
+package libnet
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrCallTimeout  = errors.New("Call timeout")
+	ErrCallDisabled = errors.New("Call not enabled")
+)
+
+// How requests and responses of a protocol carry the call id.
+type CallProtocol interface {
+	// A new message for the receive loop to decode into.
+	NewMsg() interface{}
+
+	// Attach id to an outgoing request.
+	SetCallId(req interface{}, id uint64)
+
+	// The id a response carries, ok is false for messages pushed by the peer.
+	CallId(msg interface{}) (id uint64, ok bool)
+}
+
+type caller struct {
+	protocol CallProtocol
+	push     func(msg interface{})
+	lastId   uint64
+	mutex    sync.Mutex
+	pending  map[uint64]chan interface{}
+	err      error
+}
+
+// Receive in a new goroutine, handing each response to the Call waiting for
+// it and every other message to push, including responses arriving after
+// their Call timed out. The session must not be received from otherwise.
+// Must be called once, before Call.
+func (session *Session) EnableCall(protocol CallProtocol, push func(msg interface{})) {
+	session.caller = &caller{
+		protocol: protocol,
+		push:     push,
+		pending:  make(map[uint64]chan interface{}),
+	}
+	go session.callLoop()
+}
+
+func (session *Session) callLoop() {
+	c := session.caller
+	for {
+		msg := c.protocol.NewMsg()
+		if err := session.Receive(msg); err != nil {
+			c.fail(err)
+			return
+		}
+		if id, ok := c.protocol.CallId(msg); ok {
+			if wait := c.take(id); wait != nil {
+				wait <- msg
+				continue
+			}
+		}
+		c.push(msg)
+	}
+}
+
+// Send req and wait for its response. No timeout when timeout is 0. Fails
+// with the receive error when the session breaks while waiting.
+func (session *Session) Call(req interface{}, timeout time.Duration) (interface{}, error) {
+	c := session.caller
+	if c == nil {
+		return nil, ErrCallDisabled
+	}
+
+	id := atomic.AddUint64(&c.lastId, 1)
+	wait := make(chan interface{}, 1)
+	c.mutex.Lock()
+	if c.err != nil {
+		c.mutex.Unlock()
+		return nil, c.err
+	}
+	c.pending[id] = wait
+	c.mutex.Unlock()
+
+	c.protocol.SetCallId(req, id)
+	if err := session.Send(req); err != nil {
+		c.take(id)
+		return nil, err
+	}
+
+	var timeoutChan <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+
+	select {
+	case msg, ok := <-wait:
+		if !ok {
+			return nil, c.error()
+		}
+		return msg, nil
+	case <-timeoutChan:
+		c.take(id)
+		return nil, ErrCallTimeout
+	}
+}
+
+func (c *caller) take(id uint64) chan interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	wait := c.pending[id]
+	delete(c.pending, id)
+	return wait
+}
+
+func (c *caller) error() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+func (c *caller) fail(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.err = err
+	for id, wait := range c.pending {
+		close(wait)
+		delete(c.pending, id)
+	}
+}
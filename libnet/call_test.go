@@ -0,0 +1,123 @@
+package libnet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/funny/unitest"
+)
+
+type testCall struct {
+	Id   uint64 `json:"id"`
+	Body string `json:"body"`
+}
+
+type testCallProtocol struct{}
+
+func (testCallProtocol) NewMsg() interface{} {
+	return new(testCall)
+}
+
+func (testCallProtocol) SetCallId(req interface{}, id uint64) {
+	req.(*testCall).Id = id
+}
+
+func (testCallProtocol) CallId(msg interface{}) (uint64, bool) {
+	id := msg.(*testCall).Id
+	return id, id != 0
+}
+
+func callPair() (*Session, *Session) {
+	conn1, conn2 := net.Pipe()
+	codecType := Packet(Uint16BE, Json())
+	return NewSession(conn1, codecType), NewSession(conn2, codecType)
+}
+
+func Test_Call(t *testing.T) {
+	session, peer := callPair()
+	defer session.Close()
+	defer peer.Close()
+
+	pushed := make(chan string, 1)
+	session.EnableCall(testCallProtocol{}, func(msg interface{}) {
+		pushed <- msg.(*testCall).Body
+	})
+
+	// answer two requests in reverse order with a push in between
+	go func() {
+		var req1, req2 testCall
+		peer.Receive(&req1)
+		peer.Receive(&req2)
+		peer.Send(&testCall{Id: req2.Id, Body: req2.Body + " ok"})
+		peer.Send(&testCall{Body: "push"})
+		peer.Send(&testCall{Id: req1.Id, Body: req1.Body + " ok"})
+	}()
+
+	done := make(chan *testCall, 1)
+	go func() {
+		resp, err := session.Call(&testCall{Body: "first"}, time.Second)
+		unitest.NotError(t, err)
+		done <- resp.(*testCall)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	resp, err := session.Call(&testCall{Body: "second"}, time.Second)
+	unitest.NotError(t, err)
+	unitest.Pass(t, resp.(*testCall).Body == "second ok")
+	unitest.Pass(t, (<-done).Body == "first ok")
+	unitest.Pass(t, <-pushed == "push")
+}
+
+func Test_Call_Timeout(t *testing.T) {
+	session, peer := callPair()
+	defer session.Close()
+	defer peer.Close()
+
+	pushed := make(chan string, 1)
+	session.EnableCall(testCallProtocol{}, func(msg interface{}) {
+		pushed <- msg.(*testCall).Body
+	})
+
+	received := make(chan uint64, 1)
+	go func() {
+		var req testCall
+		peer.Receive(&req)
+		received <- req.Id
+	}()
+
+	_, err := session.Call(&testCall{Body: "late"}, 50*time.Millisecond)
+	unitest.Pass(t, err == ErrCallTimeout)
+
+	// a late response goes to push
+	peer.Send(&testCall{Id: <-received, Body: "late ok"})
+	unitest.Pass(t, <-pushed == "late ok")
+}
+
+func Test_Call_Closed(t *testing.T) {
+	session, peer := callPair()
+	defer session.Close()
+
+	session.EnableCall(testCallProtocol{}, func(msg interface{}) {})
+
+	go func() {
+		var req testCall
+		peer.Receive(&req)
+		peer.Close()
+	}()
+
+	_, err := session.Call(&testCall{Body: "lost"}, time.Second)
+	unitest.Pass(t, err != nil && err != ErrCallTimeout)
+
+	_, err = session.Call(&testCall{Body: "after"}, time.Second)
+	unitest.Pass(t, err != nil && err != ErrCallTimeout)
+}
+
+func Test_Call_Disabled(t *testing.T) {
+	session, peer := callPair()
+	defer session.Close()
+	defer peer.Close()
+
+	_, err := session.Call(&testCall{}, time.Second)
+	unitest.Pass(t, err == ErrCallDisabled)
+}
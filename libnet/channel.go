@@ -13,7 +13,8 @@ type BroadcastProtocol interface {
 type defaultBroadcast struct{}
 
 func (_ defaultBroadcast) Broadcast(msg interface{}, fetcher SessionFetcher) error {
-	fetcher(func(session *Session) { session.AsyncSend(msg) })
+	frame := NewFrame(msg)
+	fetcher(func(session *Session) { session.AsyncSend(frame) })
 	return nil
 }
 
@@ -46,3 +46,7 @@ func (codec *bufioCodec) Encode(msg interface{}) error {
 func (codec *bufioCodec) Decode(msg interface{}) error {
 	return codec.Codec.Decode(msg)
 }
+
+func (codec *bufioCodec) FrameState() (interface{}, bool) {
+	return frameState(codec.Codec)
+}
@@ -37,3 +37,7 @@ func (codec bytesCodec) Encode(msg interface{}) error {
 	codec.Writer.WritePacket(msg.([]byte), codec.Spliter)
 	return codec.Writer.Flush()
 }
+
+func (codec bytesCodec) FrameState() (interface{}, bool) {
+	return nil, true
+}
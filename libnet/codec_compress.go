@@ -0,0 +1,170 @@
+package libnet
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+
+	"goProject/libnet/binary"
+)
+
+// First byte of a zlib stream with the default window. It never starts a
+// JSON object or a MessagePack map, so compressed and plain packets can be
+// told apart.
+const compressMark = 0x78
+
+// Largest decompressed packet accepted when Packet has no size limit.
+const compressMaxSize = 1 << 24
+
+// Compress packets of codecType with zlib, must be used inside Packet. The
+// size limit of PacketLimit also applies to decompressed packets.
+// Outgoing packets are compressed only when they are at least threshold bytes
+// and the peer has sent a compressed packet, so peers without compression
+// support keep receiving plain packets.
+func Compress(codecType CodecType, threshold int) CodecType {
+	return compressCodecType{codecType, threshold, false}
+}
+
+// Like Compress, but the first packet is always compressed to tell the peer
+// that compression is supported. For clients.
+func CompressActive(codecType CodecType, threshold int) CodecType {
+	return compressCodecType{codecType, threshold, true}
+}
+
+type compressCodecType struct {
+	CodecType CodecType
+	Threshold int
+	Active    bool
+}
+
+func (codecType compressCodecType) NewCodec(r io.Reader, w io.Writer) Codec {
+	pr, ok1 := r.(*binary.PacketReader)
+	pw, ok2 := w.(*binary.PacketWriter)
+	if !ok1 || !ok2 {
+		panic("Compress must be used inside Packet")
+	}
+
+	codec := &compressCodec{
+		threshold: codecType.Threshold,
+		writer:    pw,
+	}
+	if codecType.Active {
+		codec.enable = 1
+		codec.first = true
+	}
+	codec.reader.codec = codec
+	codec.reader.packet = pr
+	codec.Codec = codecType.CodecType.NewCodec(&codec.reader, &codec.buffer)
+	return codec
+}
+
+type compressCodec struct {
+	Codec     Codec
+	threshold int
+	enable    int32
+	first     bool
+	reader    compressReader
+	writer    *binary.PacketWriter
+	buffer    bytes.Buffer
+	zwriter   *zlib.Writer
+}
+
+type compressFrameState struct {
+	enable int32
+	first  bool
+	inner  interface{}
+}
+
+func (codec *compressCodec) FrameState() (interface{}, bool) {
+	state, ok := frameState(codec.Codec)
+	return compressFrameState{atomic.LoadInt32(&codec.enable), codec.first, state}, ok
+}
+
+func (codec *compressCodec) Decode(msg interface{}) error {
+	return codec.Codec.Decode(msg)
+}
+
+func (codec *compressCodec) Encode(msg interface{}) error {
+	codec.buffer.Reset()
+	if err := codec.Codec.Encode(msg); err != nil {
+		return err
+	}
+	data := codec.buffer.Bytes()
+
+	compress := atomic.LoadInt32(&codec.enable) == 1 && len(data) >= codec.threshold
+	if codec.first {
+		compress, codec.first = true, false
+	}
+	if !compress {
+		_, err := codec.writer.Write(data)
+		return err
+	}
+
+	if codec.zwriter == nil {
+		codec.zwriter, _ = zlib.NewWriterLevel(codec.writer, zlib.BestSpeed)
+	} else {
+		codec.zwriter.Reset(codec.writer)
+	}
+	if _, err := codec.zwriter.Write(data); err != nil {
+		return err
+	}
+	return codec.zwriter.Close()
+}
+
+// Stream of packet contents, decompressing the compressed ones.
+type compressReader struct {
+	codec  *compressCodec
+	packet *binary.PacketReader
+	buffer binary.Buffer
+}
+
+// Bytes of the current packet not read yet, after decompression.
+func (r *compressReader) Len() int {
+	return len(r.buffer.Data) - r.buffer.ReadPos
+}
+
+func (r *compressReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.buffer.Read(p)
+		if err == nil {
+			return n, nil
+		}
+
+		data := r.packet.ReadPacket()
+		if r.packet.Reader.Error() != nil {
+			return 0, r.packet.Reader.Error()
+		}
+
+		if len(data) > 0 && data[0] == compressMark {
+			if data, err = decompress(data, r.packet.MaxSize); err != nil {
+				return 0, err
+			}
+			atomic.StoreInt32(&r.codec.enable, 1)
+		}
+		r.buffer.Reset(data)
+	}
+}
+
+// Fails with binary.ErrPacketTooLarge when data inflates to more than
+// maxSize bytes, 0 means compressMaxSize.
+func decompress(data []byte, maxSize int) ([]byte, error) {
+	if maxSize <= 0 {
+		maxSize = compressMaxSize
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	data, err = ioutil.ReadAll(io.LimitReader(zr, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSize {
+		return nil, binary.ErrPacketTooLarge
+	}
+	return data, nil
+}
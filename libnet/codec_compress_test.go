@@ -0,0 +1,91 @@
+package libnet
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"goProject/libnet/binary"
+
+	"github.com/funny/unitest"
+)
+
+func Test_Packet_Compress(t *testing.T) {
+	SessionTest(t, Packet(Uint16BE, CompressActive(Json(), 0)), ObjectTest)
+}
+
+func Test_Packet_Compress_Threshold(t *testing.T) {
+	SessionTest(t, Packet(Uint16BE, CompressActive(MsgPack(), 32)), ObjectTest)
+}
+
+// A small packet can't inflate past the size limit of PacketLimit.
+func Test_Compress_Bomb(t *testing.T) {
+	codecType := PacketLimit(Uint16BE, 4096, Compress(Json(), 0))
+	packet := func(size int) []byte {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write([]byte(`"` + strings.Repeat("a", size-2) + `"`))
+		unitest.NotError(t, zw.Close())
+		return append([]byte{byte(buf.Len() >> 8), byte(buf.Len())}, buf.Bytes()...)
+	}
+
+	var msg string
+	codec := codecType.NewCodec(bytes.NewBuffer(packet(4096)), new(bytes.Buffer))
+	unitest.NotError(t, codec.Decode(&msg))
+	unitest.Pass(t, len(msg) == 4094)
+
+	bomb := packet(1 << 20)
+	unitest.Pass(t, len(bomb) < 4096)
+	codec = codecType.NewCodec(bytes.NewBuffer(bomb), new(bytes.Buffer))
+	unitest.Pass(t, codec.Decode(&msg) == binary.ErrPacketTooLarge)
+}
+
+func Test_Compress_Negotiation(t *testing.T) {
+	conn1, conn2 := net.Pipe()
+	session := NewSession(conn1, Packet(Uint16BE, Compress(Json(), 200)))
+	raw := NewSession(conn2, Bytes(Uint16BE))
+	defer session.Close()
+	defer raw.Close()
+
+	big := newTestCmd()
+	for i := 0; i < 20; i++ {
+		big.Args = append(big.Args, "friend")
+	}
+
+	sendRaw := func(msg interface{}) []byte {
+		go session.Send(msg)
+		var packet []byte
+		unitest.NotError(t, raw.Receive(&packet))
+		return packet
+	}
+
+	// the peer never sent a compressed packet
+	unitest.Pass(t, sendRaw(big)[0] == '{')
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	unitest.NotError(t, json.NewEncoder(zw).Encode(newTestCmd()))
+	unitest.NotError(t, zw.Close())
+	go raw.Send(buf.Bytes())
+	var cmd testCmd
+	unitest.NotError(t, session.Receive(&cmd))
+	unitest.Pass(t, reflect.DeepEqual(cmd.Args, newTestCmd().Args))
+
+	// now big packets are compressed, small ones are not
+	packet := sendRaw(big)
+	unitest.Pass(t, packet[0] == compressMark)
+	zr, err := zlib.NewReader(bytes.NewReader(packet))
+	unitest.NotError(t, err)
+	data, err := ioutil.ReadAll(zr)
+	unitest.NotError(t, err)
+	var cmd2 testCmd
+	unitest.NotError(t, json.Unmarshal(data, &cmd2))
+	unitest.Pass(t, len(cmd2.Args) == len(big.Args))
+
+	unitest.Pass(t, sendRaw(newTestCmd())[0] == '{')
+}
@@ -11,6 +11,7 @@ func Gob() CodecType {
 	return &genCodecType{
 		func(r io.Reader) decoder { return gob.NewDecoder(r) },
 		func(w io.Writer) encoder { return gob.NewEncoder(w) },
+		false,
 	}
 }
 
@@ -18,6 +19,7 @@ func Json() CodecType {
 	return &genCodecType{
 		func(r io.Reader) decoder { return json.NewDecoder(r) },
 		func(w io.Writer) encoder { return json.NewEncoder(w) },
+		true,
 	}
 }
 
@@ -25,6 +27,7 @@ func Xml() CodecType {
 	return &genCodecType{
 		func(r io.Reader) decoder { return xml.NewDecoder(r) },
 		func(w io.Writer) encoder { return xml.NewEncoder(w) },
+		true,
 	}
 }
 
@@ -39,18 +42,22 @@ type decoder interface {
 type genCodecType struct {
 	newDecoder func(io.Reader) decoder
 	newEncoder func(io.Writer) encoder
+	// gob encoders keep type information per stream
+	stateless bool
 }
 
 func (codecType *genCodecType) NewCodec(r io.Reader, w io.Writer) Codec {
 	return &genCodec{
-		Decoder: codecType.newDecoder(r),
-		Encoder: codecType.newEncoder(w),
+		Decoder:   codecType.newDecoder(r),
+		Encoder:   codecType.newEncoder(w),
+		stateless: codecType.stateless,
 	}
 }
 
 type genCodec struct {
-	Decoder decoder
-	Encoder encoder
+	Decoder   decoder
+	Encoder   encoder
+	stateless bool
 }
 
 func (codec *genCodec) Decode(msg interface{}) error {
@@ -60,3 +67,7 @@ func (codec *genCodec) Decode(msg interface{}) error {
 func (codec *genCodec) Encode(msg interface{}) error {
 	return codec.Encoder.Encode(msg)
 }
+
+func (codec *genCodec) FrameState() (interface{}, bool) {
+	return nil, codec.stateless
+}
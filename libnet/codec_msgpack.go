@@ -0,0 +1,591 @@
+package libnet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+
+	"goProject/libnet/binary"
+)
+
+var (
+	ErrMsgPackType   = errors.New("Type not supported by MessagePack codec")
+	ErrMsgPackFormat = errors.New("Bad MessagePack format")
+)
+
+// MessagePack codec. Structs are encoded as maps keyed by the json tag of
+// their fields, so the same types work with both Json() and MsgPack().
+func MsgPack() CodecType {
+	return msgpackCodecType{}
+}
+
+type msgpackCodecType struct{}
+
+func (_ msgpackCodecType) NewCodec(r io.Reader, w io.Writer) Codec {
+	return msgpackCodec{
+		binary.NewReader(r),
+		binary.NewWriter(w),
+	}
+}
+
+type msgpackCodec struct {
+	Reader *binary.Reader
+	Writer *binary.Writer
+}
+
+func (codec msgpackCodec) Decode(msg interface{}) error {
+	v := reflect.ValueOf(msg)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return ErrMsgPackType
+	}
+	if err := msgpackDecode(codec.Reader, v.Elem()); err != nil {
+		return err
+	}
+	return codec.Reader.Error()
+}
+
+func (codec msgpackCodec) Encode(msg interface{}) error {
+	if err := msgpackEncode(codec.Writer, reflect.ValueOf(msg)); err != nil {
+		return err
+	}
+	return codec.Writer.Flush()
+}
+
+func (codec msgpackCodec) FrameState() (interface{}, bool) {
+	return nil, true
+}
+
+// Does b begin a MessagePack map, the encoding of a struct.
+func IsMsgPackMap(b byte) bool {
+	return msgpackIsMap(b)
+}
+
+func msgpackEncode(w *binary.Writer, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Invalid:
+		w.WriteUint8(0xc0)
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			w.WriteUint8(0xc0)
+			return nil
+		}
+		return msgpackEncode(w, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			w.WriteUint8(0xc3)
+		} else {
+			w.WriteUint8(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		msgpackWriteInt(w, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		msgpackWriteUint(w, v.Uint())
+	case reflect.Float32:
+		w.WriteUint8(0xca)
+		w.WriteFloat32BE(float32(v.Float()))
+	case reflect.Float64:
+		w.WriteUint8(0xcb)
+		w.WriteFloat64BE(v.Float())
+	case reflect.String:
+		msgpackWriteHead(w, v.Len(), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		w.WriteString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			w.WriteUint8(0xc0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			msgpackWriteHead(w, v.Len(), 0, 0, 0xc4, 0xc5, 0xc6)
+			w.WriteBytes(msgpackBytes(v))
+			break
+		}
+		msgpackWriteHead(w, v.Len(), 0x90, 16, 0, 0xdc, 0xdd)
+		for i := 0; i < v.Len(); i++ {
+			if err := msgpackEncode(w, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			w.WriteUint8(0xc0)
+			return nil
+		}
+		msgpackWriteHead(w, v.Len(), 0x80, 16, 0, 0xde, 0xdf)
+		for _, key := range v.MapKeys() {
+			if err := msgpackEncode(w, key); err != nil {
+				return err
+			}
+			if err := msgpackEncode(w, v.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fields := msgpackFields(v.Type())
+		msgpackWriteHead(w, len(fields), 0x80, 16, 0, 0xde, 0xdf)
+		for _, field := range fields {
+			msgpackWriteHead(w, len(field.Name), 0xa0, 32, 0xd9, 0xda, 0xdb)
+			w.WriteString(field.Name)
+			if err := msgpackEncode(w, v.Field(field.Index)); err != nil {
+				return err
+			}
+		}
+	default:
+		return ErrMsgPackType
+	}
+	return w.Error()
+}
+
+// Write the header of a string, binary, array or map of n items. fix is the
+// prefix of the fix format, which holds up to fixMax items; 0 means none.
+func msgpackWriteHead(w *binary.Writer, n int, fix byte, fixMax int, head8, head16, head32 byte) {
+	switch {
+	case n < fixMax:
+		w.WriteUint8(fix | byte(n))
+	case n < 1<<8 && head8 != 0:
+		w.WriteUint8(head8)
+		w.WriteUint8(uint8(n))
+	case n < 1<<16:
+		w.WriteUint8(head16)
+		w.WriteUint16BE(uint16(n))
+	default:
+		w.WriteUint8(head32)
+		w.WriteUint32BE(uint32(n))
+	}
+}
+
+func msgpackWriteInt(w *binary.Writer, n int64) {
+	switch {
+	case n >= 0:
+		msgpackWriteUint(w, uint64(n))
+	case n >= -32:
+		w.WriteUint8(uint8(n))
+	case n >= -1<<7:
+		w.WriteUint8(0xd0)
+		w.WriteUint8(uint8(n))
+	case n >= -1<<15:
+		w.WriteUint8(0xd1)
+		w.WriteInt16BE(int16(n))
+	case n >= -1<<31:
+		w.WriteUint8(0xd2)
+		w.WriteInt32BE(int32(n))
+	default:
+		w.WriteUint8(0xd3)
+		w.WriteInt64BE(n)
+	}
+}
+
+func msgpackWriteUint(w *binary.Writer, n uint64) {
+	switch {
+	case n < 1<<7:
+		w.WriteUint8(uint8(n))
+	case n < 1<<8:
+		w.WriteUint8(0xcc)
+		w.WriteUint8(uint8(n))
+	case n < 1<<16:
+		w.WriteUint8(0xcd)
+		w.WriteUint16BE(uint16(n))
+	case n < 1<<32:
+		w.WriteUint8(0xce)
+		w.WriteUint32BE(uint32(n))
+	default:
+		w.WriteUint8(0xcf)
+		w.WriteUint64BE(n)
+	}
+}
+
+func msgpackBytes(v reflect.Value) []byte {
+	if v.Kind() == reflect.Slice {
+		return v.Bytes()
+	}
+	b := make([]byte, v.Len())
+	reflect.Copy(reflect.ValueOf(b), v)
+	return b
+}
+
+type msgpackField struct {
+	Name  string
+	Index int
+}
+
+var (
+	msgpackFieldsMutex sync.RWMutex
+	msgpackFieldsCache = make(map[reflect.Type][]msgpackField)
+)
+
+// Exported fields of a struct type and their names, the json tag if any.
+func msgpackFields(t reflect.Type) []msgpackField {
+	msgpackFieldsMutex.RLock()
+	fields, ok := msgpackFieldsCache[t]
+	msgpackFieldsMutex.RUnlock()
+	if ok {
+		return fields
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			tag = strings.Split(tag, ",")[0]
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, msgpackField{name, i})
+	}
+
+	msgpackFieldsMutex.Lock()
+	msgpackFieldsCache[t] = fields
+	msgpackFieldsMutex.Unlock()
+	return fields
+}
+
+func msgpackDecode(r *binary.Reader, v reflect.Value) error {
+	head := r.ReadUint8()
+	if r.Error() != nil {
+		return r.Error()
+	}
+	return msgpackDecodeHead(r, head, v)
+}
+
+func msgpackDecodeHead(r *binary.Reader, head byte, v reflect.Value) error {
+	if head == 0xc0 {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return msgpackDecodeHead(r, head, v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return ErrMsgPackType
+		}
+		x, err := msgpackDecodeAny(r, head)
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	}
+
+	switch {
+	case head == 0xc2 || head == 0xc3:
+		if v.Kind() != reflect.Bool {
+			return ErrMsgPackType
+		}
+		v.SetBool(head == 0xc3)
+	case msgpackIsNumber(head):
+		x, err := msgpackReadNumber(r, head)
+		if err != nil {
+			return err
+		}
+		return msgpackAssignNumber(v, x)
+	case msgpackIsString(head) || msgpackIsBinary(head):
+		n, err := msgpackReadLen(r, head)
+		if err != nil {
+			return err
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(r.ReadString(n))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(r.ReadBytes(n))
+		default:
+			return ErrMsgPackType
+		}
+	case msgpackIsArray(head):
+		n, err := msgpackReadLen(r, head)
+		if err != nil {
+			return err
+		}
+		switch v.Kind() {
+		case reflect.Slice:
+			// a bad header can't make it allocate more than the data
+			size := n
+			if size > msgpackMaxPrealloc {
+				size = msgpackMaxPrealloc
+			}
+			v.Set(reflect.MakeSlice(v.Type(), 0, size))
+			for i := 0; i < n; i++ {
+				if i < v.Cap() {
+					v.SetLen(i + 1)
+				} else {
+					v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+				}
+				if err := msgpackDecode(r, v.Index(i)); err != nil {
+					return err
+				}
+			}
+		case reflect.Array:
+			for i := 0; i < n; i++ {
+				if i < v.Len() {
+					err = msgpackDecode(r, v.Index(i))
+				} else {
+					err = msgpackSkip(r)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		default:
+			return ErrMsgPackType
+		}
+	case msgpackIsMap(head):
+		n, err := msgpackReadLen(r, head)
+		if err != nil {
+			return err
+		}
+		switch v.Kind() {
+		case reflect.Map:
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			for i := 0; i < n; i++ {
+				key := reflect.New(v.Type().Key()).Elem()
+				if err := msgpackDecode(r, key); err != nil {
+					return err
+				}
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if err := msgpackDecode(r, elem); err != nil {
+					return err
+				}
+				v.SetMapIndex(key, elem)
+			}
+		case reflect.Struct:
+			fields := msgpackFields(v.Type())
+			for i := 0; i < n; i++ {
+				name, err := msgpackReadKey(r)
+				if err != nil {
+					return err
+				}
+				found := false
+				for _, field := range fields {
+					if field.Name == string(name) {
+						err, found = msgpackDecode(r, v.Field(field.Index)), true
+						break
+					}
+				}
+				if !found {
+					err = msgpackSkip(r)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		default:
+			return ErrMsgPackType
+		}
+	default:
+		return ErrMsgPackFormat
+	}
+	return r.Error()
+}
+
+func msgpackIsNumber(head byte) bool {
+	return head < 0x80 || head >= 0xe0 || (head >= 0xca && head <= 0xd3)
+}
+
+func msgpackIsString(head byte) bool {
+	return head&0xe0 == 0xa0 || (head >= 0xd9 && head <= 0xdb)
+}
+
+func msgpackIsBinary(head byte) bool {
+	return head >= 0xc4 && head <= 0xc6
+}
+
+func msgpackIsArray(head byte) bool {
+	return head&0xf0 == 0x90 || head == 0xdc || head == 0xdd
+}
+
+func msgpackIsMap(head byte) bool {
+	return head&0xf0 == 0x80 || head == 0xde || head == 0xdf
+}
+
+// Decode a value without a target type, like encoding/json does for interface{}.
+func msgpackDecodeAny(r *binary.Reader, head byte) (interface{}, error) {
+	switch {
+	case head == 0xc0:
+		return nil, nil
+	case head == 0xc2 || head == 0xc3:
+		return head == 0xc3, nil
+	case msgpackIsNumber(head):
+		return msgpackReadNumber(r, head)
+	}
+
+	n, err := msgpackReadLen(r, head)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case msgpackIsString(head):
+		return r.ReadString(n), r.Error()
+	case msgpackIsBinary(head):
+		return r.ReadBytes(n), r.Error()
+	case msgpackIsArray(head):
+		size := n
+		if size > msgpackMaxPrealloc {
+			size = msgpackMaxPrealloc
+		}
+		x := make([]interface{}, 0, size)
+		for i := 0; i < n; i++ {
+			var elem interface{}
+			if err := msgpackDecode(r, reflect.ValueOf(&elem).Elem()); err != nil {
+				return nil, err
+			}
+			x = append(x, elem)
+		}
+		return x, nil
+	case msgpackIsMap(head):
+		x := make(map[string]interface{})
+		for i := 0; i < n; i++ {
+			var key, elem interface{}
+			if err := msgpackDecode(r, reflect.ValueOf(&key).Elem()); err != nil {
+				return nil, err
+			}
+			if err := msgpackDecode(r, reflect.ValueOf(&elem).Elem()); err != nil {
+				return nil, err
+			}
+			x[fmt.Sprint(key)] = elem
+		}
+		return x, nil
+	}
+	return nil, ErrMsgPackFormat
+}
+
+// Read a string map key without allocating, valid until the next read.
+func msgpackReadKey(r *binary.Reader) ([]byte, error) {
+	head := r.ReadUint8()
+	if r.Error() != nil || head == 0xc0 {
+		return nil, r.Error()
+	}
+	if !msgpackIsString(head) {
+		return nil, ErrMsgPackType
+	}
+	n, err := msgpackReadLen(r, head)
+	if err != nil {
+		return nil, err
+	}
+	b := r.ReadBytesTemp(n)
+	return b, r.Error()
+}
+
+func msgpackSkip(r *binary.Reader) error {
+	var x interface{}
+	return msgpackDecode(r, reflect.ValueOf(&x).Elem())
+}
+
+// Longest string, binary, array or map accepted, so a bad header can't make
+// the decoder allocate gigabytes.
+const msgpackMaxLen = 1 << 24
+
+// Most array items allocated before they are read.
+const msgpackMaxPrealloc = 1024
+
+// Implemented by readers knowing how many bytes are left in the packet being
+// decoded, like binary.PacketReader and bytes.Buffer.
+type lenReader interface {
+	Len() int
+}
+
+// Length of a string, binary, array or map following its header byte.
+func msgpackReadLen(r *binary.Reader, head byte) (n int, err error) {
+	switch {
+	case head == 0xd9 || head == 0xc4:
+		n = int(r.ReadUint8())
+	case head == 0xda || head == 0xc5 || head == 0xdc || head == 0xde:
+		n = int(r.ReadUint16BE())
+	case head == 0xdb || head == 0xc6 || head == 0xdd || head == 0xdf:
+		n = int(r.ReadUint32BE())
+	case msgpackIsString(head):
+		n = int(head & 0x1f)
+	case msgpackIsArray(head) || msgpackIsMap(head):
+		n = int(head & 0x0f)
+	default:
+		return 0, ErrMsgPackFormat
+	}
+	if r.Error() != nil {
+		return 0, r.Error()
+	}
+	if n > msgpackMaxLen {
+		return 0, ErrMsgPackFormat
+	}
+
+	// every array item takes at least one byte and every map entry two, so
+	// a length the rest of the packet can't hold is an error
+	if lr, ok := r.Reader().(lenReader); ok {
+		size := n
+		if msgpackIsMap(head) {
+			size = n * 2
+		}
+		if size > lr.Len() {
+			return 0, ErrMsgPackFormat
+		}
+	}
+	return n, nil
+}
+
+// Integers are returned as int64, or uint64 when they overflow int64.
+func msgpackReadNumber(r *binary.Reader, head byte) (interface{}, error) {
+	var x interface{}
+	switch {
+	case head < 0x80:
+		x = int64(head)
+	case head >= 0xe0:
+		x = int64(int8(head))
+	case head == 0xca:
+		x = float64(r.ReadFloat32BE())
+	case head == 0xcb:
+		x = r.ReadFloat64BE()
+	case head == 0xcc:
+		x = int64(r.ReadUint8())
+	case head == 0xcd:
+		x = int64(r.ReadUint16BE())
+	case head == 0xce:
+		x = int64(r.ReadUint32BE())
+	case head == 0xcf:
+		if n := r.ReadUint64BE(); n > 1<<63-1 {
+			x = n
+		} else {
+			x = int64(n)
+		}
+	case head == 0xd0:
+		x = int64(int8(r.ReadUint8()))
+	case head == 0xd1:
+		x = int64(r.ReadInt16BE())
+	case head == 0xd2:
+		x = int64(r.ReadInt32BE())
+	case head == 0xd3:
+		x = r.ReadInt64BE()
+	default:
+		return nil, ErrMsgPackFormat
+	}
+	return x, r.Error()
+}
+
+// Store a decoded number into v.
+func msgpackAssignNumber(v reflect.Value, x interface{}) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		v.Set(reflect.ValueOf(x).Convert(v.Type()))
+		return nil
+	}
+	return ErrMsgPackType
+}
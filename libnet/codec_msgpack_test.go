@@ -0,0 +1,171 @@
+package libnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/funny/unitest"
+)
+
+// Same layout as protocol.CmdResponse.
+type testCmd struct {
+	CmdName string      `json:"cmd"`
+	Ok      bool        `json:"ok"`
+	Message string      `json:"msg"`
+	Args    []string    `json:"obj"`
+	Repo    interface{} `json:"repo"`
+	Time    int64       `json:"time"`
+	Ignored string      `json:"-"`
+}
+
+func newTestCmd() *testCmd {
+	return &testCmd{
+		CmdName: "receive_message_topic",
+		Ok:      true,
+		Args:    []string{"hello", "topic", "aa", "1445422101", "7f152006-6909-4955-bdb4-92f0e3cb354e"},
+		Repo:    map[string]interface{}{"id": int64(-1), "tags": []interface{}{"a", 1.5, nil, true}},
+		Time:    1445422101,
+	}
+}
+
+func Test_MsgPack_Cmd(t *testing.T) {
+	buf := new(bytes.Buffer)
+	codec := MsgPack().NewCodec(buf, buf)
+
+	cmd1 := newTestCmd()
+	cmd1.Ignored = "x"
+	unitest.NotError(t, codec.Encode(cmd1))
+	unitest.Pass(t, IsMsgPackMap(buf.Bytes()[0]))
+
+	jsonSize, _ := json.Marshal(cmd1)
+	unitest.Pass(t, buf.Len() < len(jsonSize))
+
+	var cmd2 testCmd
+	unitest.NotError(t, codec.Decode(&cmd2))
+	cmd1.Ignored = ""
+	unitest.Pass(t, reflect.DeepEqual(*cmd1, cmd2))
+	unitest.Pass(t, buf.Len() == 0)
+}
+
+func Test_MsgPack_UnknownField(t *testing.T) {
+	buf := new(bytes.Buffer)
+	codec := MsgPack().NewCodec(buf, buf)
+
+	unitest.NotError(t, codec.Encode(newTestCmd()))
+	unitest.NotError(t, codec.Encode(map[string]int{"cmd": 1}))
+
+	var small struct {
+		CmdName string `json:"cmd"`
+	}
+	unitest.NotError(t, codec.Decode(&small))
+	unitest.Pass(t, small.CmdName == "receive_message_topic")
+
+	// a type mismatch is reported instead of silently ignored
+	unitest.Pass(t, codec.Decode(&small) == ErrMsgPackType)
+}
+
+func Test_MsgPack_BadLength(t *testing.T) {
+	buf := bytes.NewBuffer([]byte{0xdb, 0xff, 0xff, 0xff, 0xff})
+	codec := MsgPack().NewCodec(buf, buf)
+
+	var s string
+	unitest.Pass(t, codec.Decode(&s) == ErrMsgPackFormat)
+}
+
+// A length the rest of the packet can't hold fails before anything is allocated.
+func Test_MsgPack_ShortPacket(t *testing.T) {
+	huge := []byte{0x00, 0xff, 0xff, 0xff}
+	tests := []struct {
+		codecType CodecType
+		packet    []byte
+	}{
+		{MsgPack(), append([]byte{0xdd}, huge...)},                               // array
+		{MsgPack(), append([]byte{0xdf}, huge...)},                               // map
+		{MsgPack(), append([]byte{0xdb}, huge...)},                               // string
+		{MsgPack(), append([]byte{0xc6}, huge...)},                               // binary
+		{MsgPack(), append([]byte{0x81, 0xa1, 'x', 0xdd}, huge...)},              // skipped field
+		{JsonOrMsgPack(), append([]byte{0x81, 0xa1, 'x', 0xdd}, huge...)},        // after negotiation
+		{Compress(MsgPack(), 0), append([]byte{0x81, 0xa1, 'x', 0xdd}, huge...)}, // plain packet of Compress
+	}
+	for _, test := range tests {
+		buf := bytes.NewBuffer([]byte{0, byte(len(test.packet))})
+		buf.Write(test.packet)
+		codec := Packet(Uint16BE, test.codecType).NewCodec(buf, new(bytes.Buffer))
+
+		var before, after runtime.MemStats
+		var msg interface{}
+		runtime.ReadMemStats(&before)
+		err := codec.Decode(&msg)
+		runtime.ReadMemStats(&after)
+		unitest.Pass(t, err == ErrMsgPackFormat)
+		unitest.Pass(t, after.TotalAlloc-before.TotalAlloc < 1<<20)
+	}
+}
+
+func Test_Negotiate(t *testing.T) {
+	server, err := Serve("tcp", "127.0.0.1:0", Packet(Uint16BE, JsonOrMsgPack()))
+	unitest.NotError(t, err)
+	defer server.Stop()
+
+	go func() {
+		for {
+			session, err := server.Accept()
+			if err != nil {
+				break
+			}
+			go func() {
+				for {
+					var cmd testCmd
+					if session.Receive(&cmd) != nil {
+						return
+					}
+					cmd.Ok = false
+					session.Send(&cmd)
+				}
+			}()
+		}
+	}()
+
+	for _, codecType := range []CodecType{Json(), MsgPack()} {
+		session, err := Connect("tcp", server.Listener().Addr().String(), Packet(Uint16BE, codecType))
+		unitest.NotError(t, err)
+
+		for i := 0; i < 10; i++ {
+			unitest.NotError(t, session.Send(newTestCmd()))
+			var cmd testCmd
+			unitest.NotError(t, session.Receive(&cmd))
+			unitest.Pass(t, cmd.CmdName == "receive_message_topic" && !cmd.Ok)
+			unitest.Pass(t, len(cmd.Args) == 5)
+		}
+		session.Close()
+	}
+}
+
+// Encode and decode one command per op through the codec stack msg_server uses.
+func benchmarkCodec(b *testing.B, codecType CodecType) {
+	buf := new(bytes.Buffer)
+	codec := Packet(Uint16BE, codecType).NewCodec(buf, buf)
+	cmd := newTestCmd()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := codec.Encode(cmd); err != nil {
+			b.Fatal(err)
+		}
+		var out testCmd
+		if err := codec.Decode(&out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Benchmark_Packet_Json(b *testing.B) {
+	benchmarkCodec(b, Json())
+}
+
+func Benchmark_Packet_MsgPack(b *testing.B) {
+	benchmarkCodec(b, MsgPack())
+}
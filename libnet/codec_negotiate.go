@@ -0,0 +1,115 @@
+package libnet
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// Pick the codec of each session by the first byte its peer sends, so one
+// listener can serve clients speaking different codecs. choose returns nil to
+// keep defaultType, which is also used for messages sent before the first
+// message arrives.
+func Negotiate(defaultType CodecType, choose func(firstByte byte) CodecType) CodecType {
+	return negotiateCodecType{defaultType, choose}
+}
+
+// JSON for clients whose first message starts with '{', MessagePack for
+// clients whose first message is a MessagePack map.
+func JsonOrMsgPack() CodecType {
+	return Negotiate(Json(), func(firstByte byte) CodecType {
+		if IsMsgPackMap(firstByte) {
+			return MsgPack()
+		}
+		return nil
+	})
+}
+
+type negotiateCodecType struct {
+	DefaultType CodecType
+	Choose      func(byte) CodecType
+}
+
+func (codecType negotiateCodecType) NewCodec(r io.Reader, w io.Writer) Codec {
+	br := bufio.NewReader(r)
+	var input io.Reader = br
+	if lr, ok := r.(lenReader); ok {
+		input = negotiateReader{br, lr}
+	}
+	return &negotiateCodec{
+		reader: br,
+		input:  input,
+		writer: w,
+		choose: codecType.Choose,
+		codec:  codecType.DefaultType.NewCodec(input, w),
+		first:  -1,
+	}
+}
+
+// Keeps telling the codec how many bytes are left in the packet. bufio only
+// reads more from a packet reader once its buffer is empty, so what it holds
+// is always part of the current packet.
+type negotiateReader struct {
+	*bufio.Reader
+	packet lenReader
+}
+
+func (r negotiateReader) Len() int {
+	return r.Buffered() + r.packet.Len()
+}
+
+type negotiateCodec struct {
+	reader *bufio.Reader
+	input  io.Reader
+	writer io.Writer
+	choose func(byte) CodecType
+	chosen bool
+	mutex  sync.Mutex
+	codec  Codec
+	// first byte received, -1 before that
+	first int
+}
+
+type negotiateFrameState struct {
+	first int
+	inner interface{}
+}
+
+func (codec *negotiateCodec) Decode(msg interface{}) error {
+	if !codec.chosen {
+		b, err := codec.reader.Peek(1)
+		if err != nil {
+			return err
+		}
+		codec.chosen = true
+		codecType := codec.choose(b[0])
+		codec.mutex.Lock()
+		if codecType != nil {
+			codec.codec = codecType.NewCodec(codec.input, codec.writer)
+		}
+		codec.first = int(b[0])
+		codec.mutex.Unlock()
+	}
+	return codec.current().Decode(msg)
+}
+
+func (codec *negotiateCodec) Encode(msg interface{}) error {
+	return codec.current().Encode(msg)
+}
+
+func (codec *negotiateCodec) current() Codec {
+	codec.mutex.Lock()
+	defer codec.mutex.Unlock()
+	return codec.codec
+}
+
+// choose gives the same codec type for the same first byte, so the byte
+// identifies the codec in use.
+func (codec *negotiateCodec) FrameState() (interface{}, bool) {
+	codec.mutex.Lock()
+	first, inner := codec.first, codec.codec
+	codec.mutex.Unlock()
+
+	state, ok := frameState(inner)
+	return negotiateFrameState{first, state}, ok
+}
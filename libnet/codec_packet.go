@@ -7,16 +7,23 @@ import (
 )
 
 func Packet(spliter binary.Spliter, codecType CodecType) CodecType {
-	return packetCodecType{spliter, codecType}
+	return packetCodecType{spliter, codecType, 0}
+}
+
+// Like Packet, but a packet larger than maxSize fails the decoding with
+// binary.ErrPacketTooLarge and closes the session.
+func PacketLimit(spliter binary.Spliter, maxSize int, codecType CodecType) CodecType {
+	return packetCodecType{spliter, codecType, maxSize}
 }
 
 type packetCodecType struct {
 	Spliter   binary.Spliter
 	CodecType CodecType
+	MaxSize   int
 }
 
 func (codecType packetCodecType) NewCodec(r io.Reader, w io.Writer) Codec {
-	pr := binary.NewPacketReader(codecType.Spliter, r)
+	pr := binary.NewPacketReaderLimit(codecType.Spliter, codecType.MaxSize, r)
 	pw := binary.NewPacketWriter(codecType.Spliter, w)
 	return &packetCodec{
 		Codec:  codecType.CodecType.NewCodec(pr, pw),
@@ -40,6 +47,10 @@ func (codec *packetCodec) Decode(msg interface{}) error {
 	return codec.Codec.Decode(msg)
 }
 
+func (codec *packetCodec) FrameState() (interface{}, bool) {
+	return frameState(codec.Codec)
+}
+
 var (
 	Line     = binary.SplitByLine
 	Null     = binary.SplitByNull
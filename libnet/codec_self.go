@@ -45,3 +45,7 @@ func (codec selfCodec) Encode(msg interface{}) error {
 	}
 	return codec.Writer.Flush()
 }
+
+func (codec selfCodec) FrameState() (interface{}, bool) {
+	return nil, true
+}
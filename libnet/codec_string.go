@@ -37,3 +37,7 @@ func (codec stringCodec) Encode(msg interface{}) error {
 	codec.Writer.WritePacket([]byte(msg.(string)), codec.Spliter)
 	return codec.Writer.Flush()
 }
+
+func (codec stringCodec) FrameState() (interface{}, bool) {
+	return nil, true
+}
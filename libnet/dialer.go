@@ -0,0 +1,154 @@
+package libnet
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Dialer states, see Dialer.OnState.
+const (
+	DIAL_CONNECTED = iota
+	DIAL_DISCONNECTED
+	DIAL_FAILED
+	DIAL_STOPPED
+)
+
+// Keeps a logical connection alive, dialing again with exponential backoff
+// and jitter whenever the session closes or a dial fails.
+type Dialer struct {
+	dial       func() (*Session, error)
+	onConnect  func(*Session) error
+	onState    func(dialer *Dialer, state int, err error)
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	session  *Session
+	mutex    sync.Mutex
+	stopFlag int32
+	stopChan chan int
+}
+
+// dial opens a session, like Connect. onConnect runs after each successful
+// dial, before the session is in use, to subscribe or start receiving. The
+// dialer notices a broken connection only when the session closes, so
+// onConnect should start something that receives from it. An error from
+// onConnect closes the session and counts as a failed dial.
+func NewDialer(dial func() (*Session, error), onConnect func(*Session) error) *Dialer {
+	return &Dialer{
+		dial:       dial,
+		onConnect:  onConnect,
+		minBackoff: time.Second,
+		maxBackoff: 30 * time.Second,
+		stopChan:   make(chan int),
+	}
+}
+
+// The wait after the first failure, doubled after each failure up to max.
+// Must be called before Start.
+func (dialer *Dialer) SetBackoff(min, max time.Duration) {
+	dialer.minBackoff = min
+	dialer.maxBackoff = max
+}
+
+// Invoke callback on every state change, err is set for DIAL_FAILED. Must be
+// called before Start.
+func (dialer *Dialer) OnState(callback func(dialer *Dialer, state int, err error)) {
+	dialer.onState = callback
+}
+
+func (dialer *Dialer) Start() {
+	go dialer.loop()
+}
+
+// Stop dialing and close the current session.
+func (dialer *Dialer) Stop() {
+	if atomic.CompareAndSwapInt32(&dialer.stopFlag, 0, 1) {
+		close(dialer.stopChan)
+	}
+}
+
+// The current session, nil while disconnected.
+func (dialer *Dialer) Session() *Session {
+	dialer.mutex.Lock()
+	defer dialer.mutex.Unlock()
+	return dialer.session
+}
+
+func (dialer *Dialer) setSession(session *Session) {
+	dialer.mutex.Lock()
+	defer dialer.mutex.Unlock()
+	dialer.session = session
+}
+
+func (dialer *Dialer) event(state int, err error) {
+	if dialer.onState != nil {
+		dialer.onState(dialer, state, err)
+	}
+}
+
+func (dialer *Dialer) loop() {
+	defer dialer.event(DIAL_STOPPED, nil)
+
+	backoff := dialer.minBackoff
+	for {
+		session, err := dialer.connect()
+		if err != nil {
+			dialer.event(DIAL_FAILED, err)
+			if !dialer.wait(backoff) {
+				return
+			}
+			if backoff *= 2; backoff > dialer.maxBackoff {
+				backoff = dialer.maxBackoff
+			}
+			continue
+		}
+
+		backoff = dialer.minBackoff
+		dialer.setSession(session)
+		dialer.event(DIAL_CONNECTED, nil)
+
+		select {
+		case <-session.closeChan:
+		case <-dialer.stopChan:
+			session.Close()
+		}
+
+		dialer.setSession(nil)
+		dialer.event(DIAL_DISCONNECTED, nil)
+		if !dialer.wait(backoff) {
+			return
+		}
+	}
+}
+
+func (dialer *Dialer) connect() (*Session, error) {
+	session, err := dialer.dial()
+	if err != nil {
+		return nil, err
+	}
+	if dialer.onConnect != nil {
+		if err := dialer.onConnect(session); err != nil {
+			session.Close()
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+// Sleep half to all of backoff, returns false when stopped.
+func (dialer *Dialer) wait(backoff time.Duration) bool {
+	if backoff > 0 {
+		backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	}
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-dialer.stopChan:
+		return false
+	}
+}
@@ -0,0 +1,96 @@
+package libnet
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/funny/unitest"
+)
+
+func Test_Dialer_Reconnect(t *testing.T) {
+	server, err := Serve("tcp", "127.0.0.1:0", String(Uint16BE))
+	unitest.NotError(t, err)
+	defer server.Stop()
+	addr := server.Listener().Addr().String()
+
+	accepted := make(chan *Session, 2)
+	go func() {
+		for {
+			session, err := server.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- session
+		}
+	}()
+
+	var connects int32
+	dialer := NewDialer(func() (*Session, error) {
+		return Connect("tcp", addr, String(Uint16BE))
+	}, func(session *Session) error {
+		atomic.AddInt32(&connects, 1)
+		go func() {
+			var msg string
+			for session.Receive(&msg) == nil {
+			}
+		}()
+		return session.Send("subscribe")
+	})
+	dialer.SetBackoff(10*time.Millisecond, 50*time.Millisecond)
+
+	states := make(chan int, 10)
+	dialer.OnState(func(dialer *Dialer, state int, err error) {
+		states <- state
+	})
+	dialer.Start()
+
+	var msg string
+	session := <-accepted
+	unitest.NotError(t, session.Receive(&msg))
+	unitest.Pass(t, msg == "subscribe")
+	unitest.Pass(t, <-states == DIAL_CONNECTED)
+	unitest.Pass(t, dialer.Session() != nil)
+
+	// the peer goes away, the dialer connects again and subscribes again
+	session.Close()
+	unitest.Pass(t, <-states == DIAL_DISCONNECTED)
+
+	session = <-accepted
+	unitest.NotError(t, session.Receive(&msg))
+	unitest.Pass(t, msg == "subscribe")
+	unitest.Pass(t, <-states == DIAL_CONNECTED)
+	unitest.Pass(t, atomic.LoadInt32(&connects) == 2)
+
+	dialer.Stop()
+	unitest.Pass(t, <-states == DIAL_DISCONNECTED)
+	unitest.Pass(t, <-states == DIAL_STOPPED)
+	unitest.Pass(t, dialer.Session() == nil)
+}
+
+func Test_Dialer_Backoff(t *testing.T) {
+	var dials int32
+	errDial := errors.New("dial failed")
+	dialer := NewDialer(func() (*Session, error) {
+		atomic.AddInt32(&dials, 1)
+		return nil, errDial
+	}, nil)
+	dialer.SetBackoff(20*time.Millisecond, 40*time.Millisecond)
+
+	failed := make(chan error, 100)
+	dialer.OnState(func(dialer *Dialer, state int, err error) {
+		if state == DIAL_FAILED {
+			failed <- err
+		}
+	})
+	dialer.Start()
+
+	unitest.Pass(t, <-failed == errDial)
+	time.Sleep(200 * time.Millisecond)
+	dialer.Stop()
+
+	// waits of 10-20ms, 20-40ms and then 20-40ms, at most 200ms / 10ms dials
+	n := atomic.LoadInt32(&dials)
+	unitest.Pass(t, n >= 4 && n <= 12)
+}
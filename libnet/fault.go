@@ -0,0 +1,101 @@
+package libnet
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrFaultReset = errors.New("Connection reset by fault injection")
+
+// Faults injected into the writes of a connection. Sessions using Packet
+// write each message with one Write, so faults hit whole messages. The funcs
+// get the index of the write, from 0, and say whether the fault happens; nil
+// means never. Checked in the order Reset, Truncate, Drop.
+type Fault struct {
+	// Delay before each write.
+	Latency time.Duration
+	// Close the connection instead of writing, Write fails with ErrFaultReset.
+	Reset func(n int) bool
+	// Write the first half and close the connection, Write fails with
+	// io.ErrShortWrite.
+	Truncate func(n int) bool
+	// Pretend to write, the peer never gets it.
+	Drop func(n int) bool
+}
+
+// Fault at the given write indexes.
+func FaultAt(indexes ...int) func(int) bool {
+	return func(n int) bool {
+		for _, i := range indexes {
+			if i == n {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Fault at random with the given rate, the same writes for the same seed.
+func FaultRate(rate float64, seed int64) func(int) bool {
+	var mutex sync.Mutex
+	r := rand.New(rand.NewSource(seed))
+	return func(int) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return r.Float64() < rate
+	}
+}
+
+type FaultConn struct {
+	net.Conn
+	fault  Fault
+	writes int64
+}
+
+func NewFaultConn(conn net.Conn, fault Fault) *FaultConn {
+	return &FaultConn{Conn: conn, fault: fault}
+}
+
+func (conn *FaultConn) Write(p []byte) (int, error) {
+	n := int(atomic.AddInt64(&conn.writes, 1) - 1)
+	fault := conn.fault
+	if fault.Latency > 0 {
+		time.Sleep(fault.Latency)
+	}
+
+	switch {
+	case fault.Reset != nil && fault.Reset(n):
+		conn.Conn.Close()
+		return 0, ErrFaultReset
+	case fault.Truncate != nil && fault.Truncate(n):
+		written, _ := conn.Conn.Write(p[:len(p)/2])
+		conn.Conn.Close()
+		return written, io.ErrShortWrite
+	case fault.Drop != nil && fault.Drop(n):
+		return len(p), nil
+	}
+	return conn.Conn.Write(p)
+}
+
+// Wrap the connections accepted by listener in FaultConns.
+func NewFaultListener(listener net.Listener, fault Fault) net.Listener {
+	return faultListener{listener, fault}
+}
+
+type faultListener struct {
+	net.Listener
+	fault Fault
+}
+
+func (l faultListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewFaultConn(conn, l.fault), nil
+}
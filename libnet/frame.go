@@ -0,0 +1,123 @@
+package libnet
+
+import (
+	"bytes"
+	"net"
+	"sync"
+)
+
+// A message encoded once per wire format and written as is to every session
+// using that format. Send, AsyncSend and Channel.Broadcast accept frames.
+type Frame struct {
+	msg   interface{}
+	mutex sync.RWMutex
+	data  map[frameKey][]byte
+}
+
+// Sessions accepted by the same server share the codecId, and with the same
+// codec state they produce the same bytes for a message.
+type frameKey struct {
+	codecId uint64
+	state   interface{}
+}
+
+func NewFrame(msg interface{}) *Frame {
+	if frame, ok := msg.(*Frame); ok {
+		return frame
+	}
+	return &Frame{msg: msg, data: make(map[frameKey][]byte)}
+}
+
+func (frame *Frame) Msg() interface{} {
+	return frame.msg
+}
+
+func (frame *Frame) get(key frameKey) []byte {
+	frame.mutex.RLock()
+	defer frame.mutex.RUnlock()
+	return frame.data[key]
+}
+
+func (frame *Frame) put(key frameKey, data []byte) {
+	frame.mutex.Lock()
+	defer frame.mutex.Unlock()
+	frame.data[key] = data
+}
+
+// Implemented by codecs whose output can be shared between sessions. state
+// is a comparable value describing what else than the message decides the
+// output, like a negotiated format. ok is false when the output can't be
+// shared at all, gob for example sends type information once per stream.
+// Codecs without this method are never shared.
+type FrameCodec interface {
+	FrameState() (state interface{}, ok bool)
+}
+
+func frameState(codec Codec) (interface{}, bool) {
+	if fc, ok := codec.(FrameCodec); ok {
+		return fc.FrameState()
+	}
+	return nil, false
+}
+
+// Forwards to the connection, recording the bytes while a frame is encoded.
+type frameWriter struct {
+	session *Session
+	conn    net.Conn
+	capture *bytes.Buffer
+}
+
+func (w *frameWriter) Write(p []byte) (int, error) {
+	n, err := w.conn.Write(p)
+	if n > 0 {
+		w.session.addTraffic(bytesOut, uint64(n))
+	}
+	if w.capture != nil {
+		w.capture.Write(p[:n])
+	}
+	return n, err
+}
+
+// Must hold sendMutex.
+func (session *Session) sendFrame(frame *Frame) error {
+	state, ok := frameState(session.codec)
+	if !ok {
+		return session.codec.Encode(frame.msg)
+	}
+
+	key := frameKey{session.codecId, state}
+	if data := frame.get(key); data != nil {
+		_, err := session.writer.Write(data)
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	session.writer.capture = buf
+	err := session.codec.Encode(frame.msg)
+	session.writer.capture = nil
+
+	// codec states only move forward, so an unchanged state means the
+	// encoding used it too
+	if after, _ := frameState(session.codec); err == nil && after == state {
+		frame.put(key, buf.Bytes())
+	}
+	return err
+}
+
+// AsyncSend msg to the sessions, or Send when AsyncSend is not enabled,
+// encoding it once per wire format. Returns the sessions failed.
+func Multicast(msg interface{}, sessions []*Session) (failed []*Session) {
+	frame := NewFrame(msg)
+	for _, session := range sessions {
+		var err error
+		if session.IsAsyncSend() {
+			err = session.AsyncSend(frame)
+		} else {
+			err = session.Send(frame)
+		}
+		if err != nil {
+			failed = append(failed, session)
+		}
+	}
+	return
+}
@@ -0,0 +1,106 @@
+package libnet
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/funny/unitest"
+	"goProject/libnet/binary"
+)
+
+type countObject struct {
+	TestObject
+	encodes *int32
+}
+
+func (obj *countObject) SelfEncode(w *binary.Writer) error {
+	atomic.AddInt32(obj.encodes, 1)
+	return obj.TestObject.SelfEncode(w)
+}
+
+// Connect n clients to a new server, returns the server side sessions.
+func frameTestSessions(t *testing.T, serverType CodecType, clientTypes []CodecType) (*Server, []*Session, []*Session) {
+	server, err := Serve("tcp", "127.0.0.1:0", serverType)
+	unitest.NotError(t, err)
+
+	var servers, clients []*Session
+	for _, clientType := range clientTypes {
+		client, err := Connect("tcp", server.Listener().Addr().String(), clientType)
+		unitest.NotError(t, err)
+		session, err := server.Accept()
+		unitest.NotError(t, err)
+		clients = append(clients, client)
+		servers = append(servers, session)
+	}
+	return server, servers, clients
+}
+
+func Test_Frame_EncodeOnce(t *testing.T) {
+	codecType := Packet(Uint16BE, SelfCodec())
+	clientTypes := []CodecType{codecType, codecType, codecType, codecType}
+	server, sessions, clients := frameTestSessions(t, codecType, clientTypes)
+	defer server.Stop()
+
+	var encodes int32
+	msg := &countObject{RandObject(), &encodes}
+	unitest.Pass(t, len(Multicast(msg, sessions)) == 0)
+	unitest.Pass(t, encodes == 1)
+
+	for _, client := range clients {
+		var obj TestObject
+		unitest.NotError(t, client.Receive(&obj))
+		unitest.Pass(t, obj == msg.TestObject)
+		client.Close()
+	}
+}
+
+func Test_Frame_Negotiate(t *testing.T) {
+	json, msgpack := Packet(Uint16BE, Json()), Packet(Uint16BE, MsgPack())
+	clientTypes := []CodecType{json, msgpack, json, msgpack}
+	server, sessions, clients := frameTestSessions(t, Packet(Uint16BE, JsonOrMsgPack()), clientTypes)
+	defer server.Stop()
+
+	// let every session negotiate its codec
+	for i, client := range clients {
+		unitest.NotError(t, client.Send(newTestCmd()))
+		var cmd testCmd
+		unitest.NotError(t, sessions[i].Receive(&cmd))
+	}
+
+	frame := NewFrame(newTestCmd())
+	unitest.Pass(t, len(Multicast(frame, sessions)) == 0)
+	unitest.Pass(t, len(frame.data) == 2)
+
+	for _, client := range clients {
+		var cmd testCmd
+		unitest.NotError(t, client.Receive(&cmd))
+		unitest.Pass(t, cmd.CmdName == "receive_message_topic")
+		client.Close()
+	}
+}
+
+func Test_Frame_Channel(t *testing.T) {
+	codecType := Packet(Uint16BE, Gob())
+	clientTypes := []CodecType{codecType, codecType}
+	server, sessions, clients := frameTestSessions(t, codecType, clientTypes)
+	defer server.Stop()
+
+	channel := NewChannel()
+	for _, session := range sessions {
+		session.EnableAsyncSend(10)
+		channel.Join(session)
+	}
+
+	// gob output depends on the stream, so every session encodes by itself
+	for i := 0; i < 3; i++ {
+		msg := RandObject()
+		frame := NewFrame(&msg)
+		unitest.NotError(t, channel.Broadcast(frame))
+		for _, client := range clients {
+			var obj TestObject
+			unitest.NotError(t, client.Receive(&obj))
+			unitest.Pass(t, obj == msg)
+		}
+		unitest.Pass(t, len(frame.data) == 0)
+	}
+}
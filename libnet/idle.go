@@ -0,0 +1,57 @@
+package libnet
+
+import (
+	"sync"
+	"time"
+)
+
+// Which timeout fired.
+const (
+	IDLE_READ = iota
+	IDLE_WRITE
+)
+
+// Invoke callback when nothing was received within readTimeout, the session is
+// closed after the callback returns. Or when nothing was sent within
+// writeTimeout, the session stays open so the callback can send a heartbeat.
+// Zero disables a timeout. Must be called before the session starts receiving
+// and sending.
+func (session *Session) SetIdleTimeout(readTimeout, writeTimeout time.Duration, callback func(session *Session, idle int)) {
+	// the timer must not fire before it is stored
+	var mutex sync.Mutex
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if readTimeout > 0 {
+		session.readIdleTimeout = readTimeout
+		session.readIdle = time.AfterFunc(readTimeout, func() {
+			if session.IsClosed() {
+				return
+			}
+			callback(session, IDLE_READ)
+			session.Close()
+		})
+	}
+
+	if writeTimeout > 0 {
+		session.writeIdleTimeout = writeTimeout
+		session.writeIdle = time.AfterFunc(writeTimeout, func() {
+			if session.IsClosed() {
+				return
+			}
+			callback(session, IDLE_WRITE)
+			mutex.Lock()
+			session.writeIdle.Reset(writeTimeout)
+			mutex.Unlock()
+		})
+	}
+}
+
+func (session *Session) stopIdleTimers() {
+	if session.readIdle != nil {
+		session.readIdle.Stop()
+	}
+	if session.writeIdle != nil {
+		session.writeIdle.Stop()
+	}
+}
@@ -0,0 +1,67 @@
+package libnet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/funny/unitest"
+)
+
+func Test_Session_ReadIdle(t *testing.T) {
+	conn1, conn2 := net.Pipe()
+	session := NewSession(conn1, String(Uint16BE))
+	peer := NewSession(conn2, String(Uint16BE))
+	defer peer.Close()
+
+	fired := make(chan int, 1)
+	session.SetIdleTimeout(200*time.Millisecond, 0, func(session *Session, idle int) {
+		fired <- idle
+	})
+
+	go func() {
+		for {
+			var msg string
+			if session.Receive(&msg) != nil {
+				return
+			}
+		}
+	}()
+
+	// keep the session alive longer than the timeout
+	for i := 0; i < 5; i++ {
+		unitest.NotError(t, peer.Send("ping"))
+		time.Sleep(100 * time.Millisecond)
+	}
+	unitest.Pass(t, !session.IsClosed())
+
+	select {
+	case idle := <-fired:
+		unitest.Pass(t, idle == IDLE_READ)
+	case <-time.After(time.Second):
+		t.Fatal("read idle timeout not fired")
+	}
+	time.Sleep(10 * time.Millisecond)
+	unitest.Pass(t, session.IsClosed())
+}
+
+func Test_Session_WriteIdle(t *testing.T) {
+	conn1, conn2 := net.Pipe()
+	session := NewSession(conn1, String(Uint16BE))
+	peer := NewSession(conn2, String(Uint16BE))
+	defer session.Close()
+	defer peer.Close()
+
+	session.SetIdleTimeout(0, 100*time.Millisecond, func(session *Session, idle int) {
+		if idle == IDLE_WRITE {
+			session.Send("heartbeat")
+		}
+	})
+
+	for i := 0; i < 3; i++ {
+		var msg string
+		unitest.NotError(t, peer.Receive(&msg))
+		unitest.Pass(t, msg == "heartbeat")
+	}
+	unitest.Pass(t, !session.IsClosed())
+}
@@ -0,0 +1,47 @@
+package libnet
+
+// Does the actual decoding or encoding of msg.
+type Invoker func(msg interface{}) error
+
+// Sees every message a session receives or sends. Call invoke to pass msg on,
+// maybe a modified one, and return its error. The session is closed only on
+// codec errors.
+//
+// Receive interceptors get msg before invoke decodes into it. Returning an
+// error after a successful invoke rejects the message, it is dropped and
+// Receive goes on with the next one. Returning an error without invoking
+// makes Receive return it.
+//
+// Send interceptors reject a message by returning an error without invoking,
+// Send returns the error. Broadcast messages arrive as *Frame, see Frame.Msg.
+// Send interceptors run with the send lock held and must not call Send.
+type Interceptor func(session *Session, msg interface{}, invoke Invoker) error
+
+// Must be called before the session starts receiving.
+func (session *Session) AddRecvInterceptor(interceptor Interceptor) {
+	session.recvInterceptors = append(session.recvInterceptors, interceptor)
+}
+
+// Must be called before the session starts sending.
+func (session *Session) AddSendInterceptor(interceptor Interceptor) {
+	session.sendInterceptors = append(session.sendInterceptors, interceptor)
+}
+
+// Interceptors for the sessions accepted afterwards. Must be called before
+// Accept runs.
+func (server *Server) AddRecvInterceptor(interceptor Interceptor) {
+	server.recvInterceptors = append(server.recvInterceptors, interceptor)
+}
+
+func (server *Server) AddSendInterceptor(interceptor Interceptor) {
+	server.sendInterceptors = append(server.sendInterceptors, interceptor)
+}
+
+func invokeInterceptors(session *Session, interceptors []Interceptor, msg interface{}, last Invoker) error {
+	if len(interceptors) == 0 {
+		return last(msg)
+	}
+	return interceptors[0](session, msg, func(msg interface{}) error {
+		return invokeInterceptors(session, interceptors[1:], msg, last)
+	})
+}
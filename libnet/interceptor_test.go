@@ -0,0 +1,124 @@
+package libnet
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/funny/unitest"
+)
+
+var errRejected = errors.New("rejected")
+
+func Test_Interceptor_Recv(t *testing.T) {
+	conn1, conn2 := net.Pipe()
+	session := NewSession(conn1, String(Uint16BE))
+	peer := NewSession(conn2, String(Uint16BE))
+	defer session.Close()
+	defer peer.Close()
+
+	var order []string
+	session.AddRecvInterceptor(func(session *Session, msg interface{}, invoke Invoker) error {
+		order = append(order, "outer")
+		return invoke(msg)
+	})
+	session.AddRecvInterceptor(func(session *Session, msg interface{}, invoke Invoker) error {
+		order = append(order, "inner")
+		if err := invoke(msg); err != nil {
+			return err
+		}
+		if *msg.(*string) == "drop" {
+			return errRejected
+		}
+		*msg.(*string) = strings.ToUpper(*msg.(*string))
+		return nil
+	})
+
+	go func() {
+		peer.Send("drop")
+		peer.Send("hello")
+	}()
+
+	var msg string
+	unitest.NotError(t, session.Receive(&msg))
+	unitest.Pass(t, msg == "HELLO")
+	unitest.Pass(t, strings.Join(order, ",") == "outer,inner,outer,inner")
+	unitest.Pass(t, !session.IsClosed())
+}
+
+func Test_Interceptor_RecvNotInvoked(t *testing.T) {
+	conn1, conn2 := net.Pipe()
+	session := NewSession(conn1, String(Uint16BE))
+	defer session.Close()
+	defer conn2.Close()
+
+	session.AddRecvInterceptor(func(session *Session, msg interface{}, invoke Invoker) error {
+		return errRejected
+	})
+
+	var msg string
+	unitest.Pass(t, session.Receive(&msg) == errRejected)
+	unitest.Pass(t, !session.IsClosed())
+}
+
+func Test_Interceptor_Send(t *testing.T) {
+	conn1, conn2 := net.Pipe()
+	session := NewSession(conn1, String(Uint16BE))
+	peer := NewSession(conn2, String(Uint16BE))
+	defer session.Close()
+	defer peer.Close()
+
+	session.AddSendInterceptor(func(session *Session, msg interface{}, invoke Invoker) error {
+		if msg.(string) == "secret" {
+			return errRejected
+		}
+		return invoke("<" + msg.(string) + ">")
+	})
+
+	unitest.Pass(t, session.Send("secret") == errRejected)
+	unitest.Pass(t, !session.IsClosed())
+
+	go session.Send("hello")
+	var msg string
+	unitest.NotError(t, peer.Receive(&msg))
+	unitest.Pass(t, msg == "<hello>")
+}
+
+func Test_Interceptor_Server(t *testing.T) {
+	server, err := Serve("tcp", "127.0.0.1:0", String(Uint16BE))
+	unitest.NotError(t, err)
+	defer server.Stop()
+
+	var recv, sent int32
+	server.AddRecvInterceptor(func(session *Session, msg interface{}, invoke Invoker) error {
+		atomic.AddInt32(&recv, 1)
+		return invoke(msg)
+	})
+	server.AddSendInterceptor(func(session *Session, msg interface{}, invoke Invoker) error {
+		atomic.AddInt32(&sent, 1)
+		return invoke(msg)
+	})
+
+	go func() {
+		session, err := server.Accept()
+		if err != nil {
+			return
+		}
+		var msg string
+		if session.Receive(&msg) == nil {
+			session.Send(msg)
+		}
+	}()
+
+	client, err := Connect("tcp", server.Listener().Addr().String(), String(Uint16BE))
+	unitest.NotError(t, err)
+	defer client.Close()
+
+	unitest.NotError(t, client.Send("echo"))
+	var msg string
+	unitest.NotError(t, client.Receive(&msg))
+	unitest.Pass(t, msg == "echo")
+	unitest.Pass(t, atomic.LoadInt32(&recv) == 1 && atomic.LoadInt32(&sent) == 1)
+}
@@ -0,0 +1,188 @@
+package libnet
+
+import (
+	"io"
+	"net"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Message and byte counters. Bytes are counted on the wire, after compression
+// and including packet heads. Decode and encode errors include connection
+// errors, but not EOF or errors after the session was closed.
+type TrafficStats struct {
+	MsgIn        uint64 `json:"msg_in"`
+	MsgOut       uint64 `json:"msg_out"`
+	BytesIn      uint64 `json:"bytes_in"`
+	BytesOut     uint64 `json:"bytes_out"`
+	DecodeErrors uint64 `json:"decode_errors"`
+	EncodeErrors uint64 `json:"encode_errors"`
+}
+
+var globalTraffic TrafficStats
+
+func (stats *TrafficStats) load() TrafficStats {
+	return TrafficStats{
+		MsgIn:        atomic.LoadUint64(&stats.MsgIn),
+		MsgOut:       atomic.LoadUint64(&stats.MsgOut),
+		BytesIn:      atomic.LoadUint64(&stats.BytesIn),
+		BytesOut:     atomic.LoadUint64(&stats.BytesOut),
+		DecodeErrors: atomic.LoadUint64(&stats.DecodeErrors),
+		EncodeErrors: atomic.LoadUint64(&stats.EncodeErrors),
+	}
+}
+
+func (stats *TrafficStats) add(other TrafficStats) {
+	stats.MsgIn += other.MsgIn
+	stats.MsgOut += other.MsgOut
+	stats.BytesIn += other.BytesIn
+	stats.BytesOut += other.BytesOut
+	stats.DecodeErrors += other.DecodeErrors
+	stats.EncodeErrors += other.EncodeErrors
+}
+
+func msgIn(stats *TrafficStats) *uint64        { return &stats.MsgIn }
+func msgOut(stats *TrafficStats) *uint64       { return &stats.MsgOut }
+func bytesIn(stats *TrafficStats) *uint64      { return &stats.BytesIn }
+func bytesOut(stats *TrafficStats) *uint64     { return &stats.BytesOut }
+func decodeErrors(stats *TrafficStats) *uint64 { return &stats.DecodeErrors }
+func encodeErrors(stats *TrafficStats) *uint64 { return &stats.EncodeErrors }
+
+// Increase a counter of the session, its server and the global counters.
+func (session *Session) addTraffic(counter func(*TrafficStats) *uint64, n uint64) {
+	atomic.AddUint64(counter(&session.traffic), n)
+	atomic.AddUint64(counter(&globalTraffic), n)
+	if session.serverTraffic != nil {
+		atomic.AddUint64(counter(session.serverTraffic), n)
+	}
+}
+
+// Counters of all sessions in the process.
+func GlobalTraffic() TrafficStats {
+	return globalTraffic.load()
+}
+
+type countReader struct {
+	session *Session
+	reader  io.Reader
+}
+
+func (r countReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.session.addTraffic(bytesIn, uint64(n))
+	}
+	return n, err
+}
+
+func (session *Session) Traffic() TrafficStats {
+	return session.traffic.load()
+}
+
+// Messages waiting in the async send queue.
+func (session *Session) SendQueueLen() int {
+	if atomic.LoadInt32(&session.sendLoopFlag) != 1 {
+		return 0
+	}
+	session.sendQueueMutex.Lock()
+	defer session.sendQueueMutex.Unlock()
+	return session.highQueue.Len() + session.sendQueue.Len()
+}
+
+func (session *Session) StartTime() time.Time {
+	return session.startTime
+}
+
+// How long the session has been, or was, open.
+func (session *Session) Lifetime() time.Duration {
+	if closeTime := atomic.LoadInt64(&session.closeTime); closeTime != 0 {
+		return time.Duration(closeTime - session.startTime.UnixNano())
+	}
+	return time.Since(session.startTime)
+}
+
+// Snapshot of a session.
+type SessionMetrics struct {
+	Id         uint64        `json:"id"`
+	RemoteAddr string        `json:"remote_addr"`
+	Traffic    TrafficStats  `json:"traffic"`
+	SendQueue  int           `json:"send_queue"`
+	Lifetime   time.Duration `json:"lifetime"`
+}
+
+func (session *Session) Metrics() SessionMetrics {
+	return SessionMetrics{
+		Id:         session.id,
+		RemoteAddr: addrString(session.RemoteAddr()),
+		Traffic:    session.Traffic(),
+		SendQueue:  session.SendQueueLen(),
+		Lifetime:   session.Lifetime(),
+	}
+}
+
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+// Snapshot of a server or a channel. Traffic of a server includes closed
+// sessions, traffic of a channel only the current members.
+type Metrics struct {
+	Traffic      TrafficStats `json:"traffic"`
+	Sessions     int          `json:"sessions"`
+	SendQueue    int          `json:"send_queue"`
+	MaxSendQueue int          `json:"max_send_queue"`
+}
+
+func (metrics *Metrics) addSession(session *Session) {
+	n := session.SendQueueLen()
+	metrics.Sessions++
+	metrics.SendQueue += n
+	if n > metrics.MaxSendQueue {
+		metrics.MaxSendQueue = n
+	}
+}
+
+// Sum of two servers, MaxSendQueue is the larger one.
+func (metrics *Metrics) Add(other Metrics) {
+	metrics.Traffic.add(other.Traffic)
+	metrics.Sessions += other.Sessions
+	metrics.SendQueue += other.SendQueue
+	if other.MaxSendQueue > metrics.MaxSendQueue {
+		metrics.MaxSendQueue = other.MaxSendQueue
+	}
+}
+
+func (server *Server) Metrics() Metrics {
+	metrics := Metrics{Traffic: server.traffic.load()}
+	for _, session := range server.copySessions() {
+		metrics.addSession(session)
+	}
+	return metrics
+}
+
+// The n sessions with the biggest value of key, all of them when n <= 0.
+func (server *Server) TopSessions(n int, key func(SessionMetrics) uint64) []SessionMetrics {
+	sessions := server.copySessions()
+	list := make([]SessionMetrics, len(sessions))
+	for i, session := range sessions {
+		list[i] = session.Metrics()
+	}
+	sort.Slice(list, func(i, j int) bool { return key(list[i]) > key(list[j]) })
+	if n > 0 && n < len(list) {
+		list = list[:n]
+	}
+	return list
+}
+
+func (channel *Channel) Metrics() Metrics {
+	var metrics Metrics
+	channel.Fetch(func(session *Session) {
+		metrics.addSession(session)
+		metrics.Traffic.add(session.Traffic())
+	})
+	return metrics
+}
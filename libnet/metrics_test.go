@@ -0,0 +1,116 @@
+package libnet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funny/unitest"
+)
+
+func Test_Metrics_Traffic(t *testing.T) {
+	server, err := Serve("tcp", "127.0.0.1:0", String(Uint16BE))
+	unitest.NotError(t, err)
+	defer server.Stop()
+	addr := server.Listener().Addr().String()
+
+	accepted := make(chan *Session, 2)
+	go func() {
+		for {
+			session, err := server.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- session
+		}
+	}()
+
+	// a heavy and a light client
+	heavy, err := Connect("tcp", addr, String(Uint16BE))
+	unitest.NotError(t, err)
+	defer heavy.Close()
+	light, err := Connect("tcp", addr, String(Uint16BE))
+	unitest.NotError(t, err)
+	defer light.Close()
+
+	for i := 0; i < 3; i++ {
+		unitest.NotError(t, heavy.Send("hello"))
+	}
+	unitest.NotError(t, light.Send("hi"))
+	unitest.Pass(t, heavy.Traffic() == TrafficStats{MsgOut: 3, BytesOut: 3 * 7})
+
+	var msg string
+	var sessions []*Session
+	for i := 0; i < 2; i++ {
+		session := <-accepted
+		sessions = append(sessions, session)
+		unitest.NotError(t, session.Receive(&msg))
+		if msg == "hello" {
+			unitest.NotError(t, session.Receive(&msg))
+			unitest.NotError(t, session.Receive(&msg))
+		}
+	}
+
+	metrics := server.Metrics()
+	unitest.Pass(t, metrics.Sessions == 2)
+	unitest.Pass(t, metrics.Traffic.MsgIn == 4)
+	unitest.Pass(t, metrics.Traffic.BytesIn == 3*7+4)
+
+	top := server.TopSessions(1, func(m SessionMetrics) uint64 { return m.Traffic.MsgIn })
+	unitest.Pass(t, len(top) == 1)
+	unitest.Pass(t, top[0].Traffic.MsgIn == 3)
+	unitest.Pass(t, top[0].RemoteAddr == heavy.Conn().LocalAddr().String())
+
+	channel := NewChannel()
+	channel.Join(sessions[0])
+	unitest.Pass(t, channel.Metrics().Sessions == 1)
+	unitest.Pass(t, channel.Metrics().Traffic == sessions[0].Traffic())
+
+	// closed sessions still count for the server
+	sessions[0].Close()
+	sessions[1].Close()
+	unitest.Pass(t, server.Metrics().Sessions == 0)
+	unitest.Pass(t, server.Metrics().Traffic.MsgIn == 4)
+	unitest.Pass(t, channel.Metrics().Sessions == 0)
+}
+
+func Test_Metrics_DecodeError(t *testing.T) {
+	server, err := Serve("tcp", "127.0.0.1:0", PacketLimit(Uint16BE, 4, String(Uint16BE)))
+	unitest.NotError(t, err)
+	defer server.Stop()
+
+	client, err := Connect("tcp", server.Listener().Addr().String(), String(Uint16BE))
+	unitest.NotError(t, err)
+	defer client.Close()
+	unitest.NotError(t, client.Send("too long"))
+
+	session, err := server.Accept()
+	unitest.NotError(t, err)
+	var msg string
+	unitest.Pass(t, session.Receive(&msg) != nil)
+	unitest.Pass(t, session.Traffic().DecodeErrors == 1)
+	unitest.Pass(t, server.Metrics().Traffic.DecodeErrors == 1)
+
+	// a clean close is no error
+	client, err = Connect("tcp", server.Listener().Addr().String(), String(Uint16BE))
+	unitest.NotError(t, err)
+	client.Close()
+	session, err = server.Accept()
+	unitest.NotError(t, err)
+	unitest.Pass(t, session.Receive(&msg) != nil)
+	unitest.Pass(t, session.Traffic().DecodeErrors == 0)
+}
+
+func Test_Metrics_SendQueue(t *testing.T) {
+	session, peer := newStalledSession(t, 4, SendPolicy{})
+	defer peer.Close()
+
+	unitest.NotError(t, session.AsyncSend("1"))
+	unitest.NotError(t, session.AsyncSend("2"))
+	unitest.Pass(t, session.SendQueueLen() == 2)
+	unitest.Pass(t, session.Metrics().SendQueue == 2)
+
+	session.Close()
+	lifetime := session.Lifetime()
+	time.Sleep(10 * time.Millisecond)
+	unitest.Pass(t, session.Lifetime() == lifetime)
+}
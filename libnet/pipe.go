@@ -0,0 +1,72 @@
+package libnet
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+var ErrPipeClosed = errors.New("Pipe listener closed")
+
+// In-process listener whose connections are net.Pipe ends, for tests that
+// need a Server and Sessions without sockets. Writes block until the peer
+// reads, keep a goroutine receiving on each end or use AsyncSend.
+type PipeListener struct {
+	conns     chan net.Conn
+	closeChan chan int
+	closeOnce sync.Once
+}
+
+func NewPipeListener() *PipeListener {
+	return &PipeListener{
+		conns:     make(chan net.Conn),
+		closeChan: make(chan int),
+	}
+}
+
+// Server on a new PipeListener.
+func ServePipe(codecType CodecType) *Server {
+	return NewServer(NewPipeListener(), codecType)
+}
+
+func ConnectPipe(listener *PipeListener, codecType CodecType) (*Session, error) {
+	conn, err := listener.Dial()
+	if err != nil {
+		return nil, err
+	}
+	return NewSession(conn, codecType), nil
+}
+
+// Client end of a new connection, the other end is returned by Accept.
+func (l *PipeListener) Dial() (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.closeChan:
+		return nil, ErrPipeClosed
+	}
+}
+
+func (l *PipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closeChan:
+		return nil, ErrPipeClosed
+	}
+}
+
+func (l *PipeListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closeChan) })
+	return nil
+}
+
+func (l *PipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
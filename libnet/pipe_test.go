@@ -0,0 +1,149 @@
+package libnet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funny/unitest"
+)
+
+// Writes each message with one Write, so faults hit whole messages.
+var pipeCodec = Packet(Uint16BE, Json())
+
+// Echo every string back until the session closes.
+func servePipeEcho(server *Server) {
+	for {
+		session, err := server.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			var msg string
+			for session.Receive(&msg) == nil {
+				session.Send(msg)
+			}
+		}()
+	}
+}
+
+func Test_Pipe(t *testing.T) {
+	server := ServePipe(pipeCodec)
+	listener := server.Listener().(*PipeListener)
+	go servePipeEcho(server)
+
+	for i := 0; i < 3; i++ {
+		session, err := ConnectPipe(listener, pipeCodec)
+		unitest.NotError(t, err)
+		unitest.NotError(t, session.Send("hello"))
+		var msg string
+		unitest.NotError(t, session.Receive(&msg))
+		unitest.Pass(t, msg == "hello")
+		unitest.Pass(t, session.RemoteAddr().String() == "pipe")
+	}
+
+	server.Stop()
+	_, err := ConnectPipe(listener, pipeCodec)
+	unitest.Pass(t, err == ErrPipeClosed)
+	_, err = server.Accept()
+	unitest.Pass(t, err == ErrPipeClosed)
+}
+
+// A server session whose client writes "0", "1" and "2" through fault.
+func faultPipe(t *testing.T, fault Fault) *Session {
+	listener := NewPipeListener()
+	server := NewServer(listener, pipeCodec)
+	go func() {
+		conn, err := listener.Dial()
+		unitest.NotError(t, err)
+		client := NewSession(NewFaultConn(conn, fault), pipeCodec)
+		for _, msg := range []string{"0", "1", "2"} {
+			if client.Send(msg) != nil {
+				return
+			}
+		}
+	}()
+	session, err := server.Accept()
+	unitest.NotError(t, err)
+	return session
+}
+
+func Test_Fault_Drop(t *testing.T) {
+	session := faultPipe(t, Fault{Drop: FaultAt(1)})
+	defer session.Close()
+
+	var msg string
+	unitest.NotError(t, session.Receive(&msg))
+	unitest.Pass(t, msg == "0")
+	unitest.NotError(t, session.Receive(&msg))
+	unitest.Pass(t, msg == "2")
+}
+
+func Test_Fault_Truncate(t *testing.T) {
+	session := faultPipe(t, Fault{Truncate: FaultAt(1)})
+
+	var msg string
+	unitest.NotError(t, session.Receive(&msg))
+	unitest.Pass(t, msg == "0")
+	unitest.Pass(t, session.Receive(&msg) != nil)
+	unitest.Pass(t, session.IsClosed())
+}
+
+func Test_Fault_Latency(t *testing.T) {
+	session := faultPipe(t, Fault{Latency: 50 * time.Millisecond})
+	defer session.Close()
+
+	start := time.Now()
+	var msg string
+	for i := 0; i < 3; i++ {
+		unitest.NotError(t, session.Receive(&msg))
+	}
+	unitest.Pass(t, time.Since(start) >= 150*time.Millisecond)
+}
+
+func Test_Fault_Rate(t *testing.T) {
+	f1, f2 := FaultRate(0.5, 1), FaultRate(0.5, 1)
+	var hits int
+	for i := 0; i < 1000; i++ {
+		x := f1(i)
+		unitest.Pass(t, x == f2(i))
+		if x {
+			hits++
+		}
+	}
+	unitest.Pass(t, hits > 400 && hits < 600)
+}
+
+// The dialer connects again after the connection is reset.
+func Test_Fault_DialerReset(t *testing.T) {
+	server := ServePipe(pipeCodec)
+	listener := server.Listener().(*PipeListener)
+	defer server.Stop()
+	go servePipeEcho(server)
+
+	dialer := NewDialer(func() (*Session, error) {
+		conn, err := listener.Dial()
+		if err != nil {
+			return nil, err
+		}
+		// the first write is the subscribe, the second one resets
+		return NewSession(NewFaultConn(conn, Fault{Reset: FaultAt(1)}), pipeCodec), nil
+	}, func(session *Session) error {
+		if err := session.Send("subscribe"); err != nil {
+			return err
+		}
+		var msg string
+		return session.Receive(&msg)
+	})
+	dialer.SetBackoff(10*time.Millisecond, 10*time.Millisecond)
+	states := make(chan int, 10)
+	dialer.OnState(func(dialer *Dialer, state int, err error) {
+		states <- state
+	})
+	dialer.Start()
+	defer dialer.Stop()
+
+	unitest.Pass(t, <-states == DIAL_CONNECTED)
+	unitest.Pass(t, dialer.Session().Send("hello") == ErrFaultReset)
+	unitest.Pass(t, <-states == DIAL_DISCONNECTED)
+	unitest.Pass(t, <-states == DIAL_CONNECTED)
+}
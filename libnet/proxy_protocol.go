@@ -0,0 +1,198 @@
+package libnet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrProxyHeader = errors.New("Bad PROXY protocol header")
+
+var (
+	proxyV1Prefix = []byte("PROXY ")
+	proxyV2Sig    = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// Longest v1 header, including CRLF.
+const proxyV1MaxLen = 107
+
+// Wrap a listener whose connections come from a load balancer sending PROXY
+// protocol v1 or v2 headers. RemoteAddr of accepted connections is the client
+// address from the header, or the balancer address for LOCAL and UNKNOWN
+// headers. Clients must not reach the listener directly, they could fake the
+// header.
+//
+// Headers are read in the background, Accept returns connections whose header
+// has arrived, so a slow connection doesn't block the others. Connections
+// without a valid header within timeout are closed. Wrap before
+// tls.NewListener, the header comes before the TLS handshake.
+func NewProxyListener(listener net.Listener, timeout time.Duration) net.Listener {
+	l := &proxyListener{
+		Listener: listener,
+		timeout:  timeout,
+		accepted: make(chan net.Conn),
+		done:     make(chan int),
+	}
+	go l.acceptLoop()
+	return l
+}
+
+type proxyListener struct {
+	net.Listener
+	timeout  time.Duration
+	accepted chan net.Conn
+	done     chan int
+	err      error
+}
+
+func (l *proxyListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.err = err
+			close(l.done)
+			return
+		}
+		go l.readHeader(&proxyConn{Conn: conn, reader: bufio.NewReader(conn), timeout: l.timeout})
+	}
+}
+
+func (l *proxyListener) readHeader(conn *proxyConn) {
+	if err := conn.readHeader(); err != nil {
+		conn.Close()
+		return
+	}
+	select {
+	case l.accepted <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.accepted:
+		return conn, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+type proxyConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+	addr    net.Addr
+}
+
+func (conn *proxyConn) Read(p []byte) (int, error) {
+	return conn.reader.Read(p)
+}
+
+func (conn *proxyConn) RemoteAddr() net.Addr {
+	if conn.addr != nil {
+		return conn.addr
+	}
+	return conn.Conn.RemoteAddr()
+}
+
+func (conn *proxyConn) readHeader() (err error) {
+	if conn.timeout > 0 {
+		conn.Conn.SetReadDeadline(time.Now().Add(conn.timeout))
+		defer conn.Conn.SetReadDeadline(time.Time{})
+	}
+
+	b, err := conn.reader.Peek(len(proxyV1Prefix))
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(b, proxyV1Prefix) {
+		conn.addr, err = readProxyV1(conn.reader)
+		return err
+	}
+
+	b, err = conn.reader.Peek(len(proxyV2Sig))
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(b, proxyV2Sig) {
+		conn.addr, err = readProxyV2(conn.reader)
+		return err
+	}
+	return ErrProxyHeader
+}
+
+// PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= proxyV1MaxLen {
+			return nil, ErrProxyHeader
+		}
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrProxyHeader
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, ErrProxyHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	head := make([]byte, len(proxyV2Sig)+4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	verCmd, family := head[12], head[13]
+	body := make([]byte, binary.BigEndian.Uint16(head[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	if verCmd>>4 != 2 {
+		return nil, ErrProxyHeader
+	}
+	switch verCmd & 0xF {
+	case 0:
+		// LOCAL, health checks of the balancer itself
+		return nil, nil
+	case 1:
+	default:
+		return nil, ErrProxyHeader
+	}
+
+	// source address, destination address, source port, destination port
+	switch family >> 4 {
+	case 1:
+		if len(body) < 12 {
+			return nil, ErrProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:]))}, nil
+	case 2:
+		if len(body) < 36 {
+			return nil, ErrProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:]))}, nil
+	}
+	// AF_UNSPEC and AF_UNIX
+	return nil, nil
+}
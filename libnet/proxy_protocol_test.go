@@ -0,0 +1,112 @@
+package libnet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/funny/unitest"
+)
+
+// Accept one connection whose client writes header and then a message.
+func proxyTest(t *testing.T, header []byte) (*Session, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	unitest.NotError(t, err)
+	server := NewServer(NewProxyListener(listener, time.Second), String(Uint16BE))
+	defer server.Stop()
+
+	go func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			return
+		}
+		conn.Write(header)
+		NewSession(conn, String(Uint16BE)).Send("hello")
+	}()
+
+	session, err := server.Accept()
+	unitest.NotError(t, err)
+
+	var msg string
+	if err := session.Receive(&msg); err != nil {
+		return session, err
+	}
+	unitest.Pass(t, msg == "hello")
+	return session, nil
+}
+
+func proxyV2Header(cmd, family byte, addrs []byte) []byte {
+	var b bytes.Buffer
+	b.Write(proxyV2Sig)
+	b.WriteByte(0x20 | cmd)
+	b.WriteByte(family)
+	binary.Write(&b, binary.BigEndian, uint16(len(addrs)))
+	b.Write(addrs)
+	return b.Bytes()
+}
+
+func Test_ProxyProtocol_V1(t *testing.T) {
+	session, err := proxyTest(t, []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"))
+	unitest.NotError(t, err)
+	unitest.Pass(t, session.RemoteAddr().String() == "192.168.0.1:56324")
+
+	session, err = proxyTest(t, []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"))
+	unitest.NotError(t, err)
+	unitest.Pass(t, session.RemoteAddr().String() == "[2001:db8::1]:56324")
+
+	session, err = proxyTest(t, []byte("PROXY UNKNOWN\r\n"))
+	unitest.NotError(t, err)
+	unitest.Pass(t, session.RemoteAddr().String() != "")
+}
+
+func Test_ProxyProtocol_V2(t *testing.T) {
+	addrs := []byte{10, 0, 0, 1, 10, 0, 0, 2, 0xDB, 0xC4, 0x01, 0xBB}
+	session, err := proxyTest(t, proxyV2Header(1, 0x11, addrs))
+	unitest.NotError(t, err)
+	unitest.Pass(t, session.RemoteAddr().String() == "10.0.0.1:56260")
+	unitest.Pass(t, session.Conn().RemoteAddr().String() == "10.0.0.1:56260")
+
+	addrs = make([]byte, 36)
+	addrs[0], addrs[1], addrs[15] = 0x20, 0x01, 1
+	addrs[32], addrs[33] = 0x00, 0x50
+	session, err = proxyTest(t, proxyV2Header(1, 0x21, addrs))
+	unitest.NotError(t, err)
+	unitest.Pass(t, session.RemoteAddr().String() == "[2001::1]:80")
+
+	session, err = proxyTest(t, proxyV2Header(0, 0x00, nil))
+	unitest.NotError(t, err)
+	unitest.Pass(t, session.RemoteAddr().(*net.TCPAddr).IP.IsLoopback())
+}
+
+// Connections without a valid header are closed before Accept.
+func Test_ProxyProtocol_Missing(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	unitest.NotError(t, err)
+	server := NewServer(NewProxyListener(listener, 100*time.Millisecond), String(Uint16BE))
+	defer server.Stop()
+
+	for _, header := range []string{
+		"GET / HTTP/1.0\r\n",
+		"PROXY TCP4 not-an-ip 192.168.0.11 56324 443\r\n",
+		"", // timeout
+	} {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		unitest.NotError(t, err)
+		conn.Write([]byte(header))
+		_, err = conn.Read(make([]byte, 1))
+		unitest.Pass(t, err != nil)
+		conn.Close()
+	}
+
+	go func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err == nil {
+			conn.Write([]byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"))
+		}
+	}()
+	session, err := server.Accept()
+	unitest.NotError(t, err)
+	unitest.Pass(t, session.RemoteAddr().String() == "192.168.0.1:56324")
+}
@@ -0,0 +1,84 @@
+package libnet
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// What AsyncSend does when the send queue is full.
+const (
+	POLICY_CLOSE         = iota // close the session and return ErrBlocking
+	POLICY_BLOCK                // wait up to Timeout for room, then close
+	POLICY_DROP_OLDEST          // drop the oldest queued message
+	POLICY_DROP_PRIORITY        // drop the least important message, by Priority
+	POLICY_SPILL                // hand the message to Spill instead of queueing it
+)
+
+type SendPolicy struct {
+	Mode    int
+	Timeout time.Duration
+	// Bigger is more important.
+	Priority func(msg interface{}) int
+	// Also receives the messages left in the queue when the session closes.
+	Spill func(session *Session, msg interface{})
+	// Called by the send loop when it has emptied the queue after some
+	// messages were spilled, so they can be queued again. Must not block.
+	Drained func(session *Session)
+}
+
+// How many times each policy fired.
+type SendPolicyStats struct {
+	Close        uint64 `json:"close"`
+	Block        uint64 `json:"block"`
+	Timeout      uint64 `json:"timeout"`
+	DropOldest   uint64 `json:"drop_oldest"`
+	DropPriority uint64 `json:"drop_priority"`
+	Spill        uint64 `json:"spill"`
+}
+
+var globalSendStats SendPolicyStats
+
+// Increase a counter of stats and the matching global counter.
+func (stats *SendPolicyStats) incr(counter *uint64) {
+	atomic.AddUint64(counter, 1)
+	switch counter {
+	case &stats.Close:
+		atomic.AddUint64(&globalSendStats.Close, 1)
+	case &stats.Block:
+		atomic.AddUint64(&globalSendStats.Block, 1)
+	case &stats.Timeout:
+		atomic.AddUint64(&globalSendStats.Timeout, 1)
+	case &stats.DropOldest:
+		atomic.AddUint64(&globalSendStats.DropOldest, 1)
+	case &stats.DropPriority:
+		atomic.AddUint64(&globalSendStats.DropPriority, 1)
+	case &stats.Spill:
+		atomic.AddUint64(&globalSendStats.Spill, 1)
+	}
+}
+
+func (stats *SendPolicyStats) load() SendPolicyStats {
+	return SendPolicyStats{
+		Close:        atomic.LoadUint64(&stats.Close),
+		Block:        atomic.LoadUint64(&stats.Block),
+		Timeout:      atomic.LoadUint64(&stats.Timeout),
+		DropOldest:   atomic.LoadUint64(&stats.DropOldest),
+		DropPriority: atomic.LoadUint64(&stats.DropPriority),
+		Spill:        atomic.LoadUint64(&stats.Spill),
+	}
+}
+
+// Counters of all sessions in the process.
+func GlobalSendStats() SendPolicyStats {
+	return globalSendStats.load()
+}
+
+func (session *Session) SetSendPolicy(policy SendPolicy) {
+	session.sendQueueMutex.Lock()
+	defer session.sendQueueMutex.Unlock()
+	session.sendPolicy = policy
+}
+
+func (session *Session) SendStats() SendPolicyStats {
+	return session.sendStats.load()
+}
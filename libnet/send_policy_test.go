@@ -0,0 +1,217 @@
+package libnet
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/funny/unitest"
+)
+
+// A session whose peer does not read until told to, so the send loop blocks
+// on the first message and the queue fills up.
+func newStalledSession(t *testing.T, queueSize int, policy SendPolicy) (*Session, *Session) {
+	conn1, conn2 := net.Pipe()
+	session := NewSession(conn1, String(Uint16BE))
+	peer := NewSession(conn2, String(Uint16BE))
+	session.SetSendPolicy(policy)
+	session.EnableAsyncSend(queueSize)
+
+	unitest.NotError(t, session.AsyncSend("0"))
+	waitSendQueue(t, session, 0)
+	return session, peer
+}
+
+func waitSendQueue(t *testing.T, session *Session, n int) {
+	for i := 0; i < 100; i++ {
+		session.sendQueueMutex.Lock()
+		l := session.sendQueue.Len()
+		session.sendQueueMutex.Unlock()
+		if l == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("send queue length never reached %d", n)
+}
+
+func receiveStrings(t *testing.T, peer *Session, n int) []string {
+	msgs := make([]string, n)
+	for i := range msgs {
+		unitest.NotError(t, peer.Receive(&msgs[i]))
+	}
+	return msgs
+}
+
+func Test_SendPolicy_Close(t *testing.T) {
+	session, peer := newStalledSession(t, 2, SendPolicy{})
+	defer peer.Close()
+
+	unitest.NotError(t, session.AsyncSend("1"))
+	unitest.NotError(t, session.AsyncSend("2"))
+	unitest.Pass(t, session.AsyncSend("3") == ErrBlocking)
+	unitest.Pass(t, session.IsClosed())
+	unitest.Pass(t, session.SendStats().Close == 1)
+}
+
+func Test_SendPolicy_Block(t *testing.T) {
+	session, peer := newStalledSession(t, 1, SendPolicy{Mode: POLICY_BLOCK, Timeout: time.Second})
+	defer session.Close()
+	defer peer.Close()
+
+	unitest.NotError(t, session.AsyncSend("1"))
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		receiveStrings(t, peer, 1)
+	}()
+	unitest.NotError(t, session.AsyncSend("2"))
+	unitest.Pass(t, session.SendStats().Block == 1)
+
+	msgs := receiveStrings(t, peer, 2)
+	unitest.Pass(t, msgs[0] == "1" && msgs[1] == "2")
+}
+
+func Test_SendPolicy_Block_Timeout(t *testing.T) {
+	session, peer := newStalledSession(t, 1, SendPolicy{Mode: POLICY_BLOCK, Timeout: 100 * time.Millisecond})
+	defer peer.Close()
+
+	unitest.NotError(t, session.AsyncSend("1"))
+	unitest.Pass(t, session.AsyncSend("2") == ErrBlocking)
+	unitest.Pass(t, session.IsClosed())
+
+	stats := session.SendStats()
+	unitest.Pass(t, stats.Block == 1 && stats.Timeout == 1)
+}
+
+func Test_SendPolicy_DropOldest(t *testing.T) {
+	session, peer := newStalledSession(t, 2, SendPolicy{Mode: POLICY_DROP_OLDEST})
+	defer session.Close()
+	defer peer.Close()
+
+	for _, msg := range []string{"1", "2", "3", "4"} {
+		unitest.NotError(t, session.AsyncSend(msg))
+	}
+	unitest.Pass(t, session.SendStats().DropOldest == 2)
+
+	msgs := receiveStrings(t, peer, 3)
+	unitest.Pass(t, msgs[0] == "0" && msgs[1] == "3" && msgs[2] == "4")
+}
+
+func Test_SendPolicy_DropPriority(t *testing.T) {
+	// "h..." messages are more important than "l..." messages
+	priority := func(msg interface{}) int {
+		if msg.(string)[0] == 'h' {
+			return 1
+		}
+		return 0
+	}
+	session, peer := newStalledSession(t, 2, SendPolicy{Mode: POLICY_DROP_PRIORITY, Priority: priority})
+	defer session.Close()
+	defer peer.Close()
+
+	for _, msg := range []string{"l1", "h1", "h2", "l2"} {
+		unitest.NotError(t, session.AsyncSend(msg))
+	}
+	unitest.Pass(t, session.SendStats().DropPriority == 2)
+
+	msgs := receiveStrings(t, peer, 3)
+	unitest.Pass(t, msgs[0] == "0" && msgs[1] == "h1" && msgs[2] == "h2")
+}
+
+func Test_SendPolicy_Spill(t *testing.T) {
+	var (
+		mutex   sync.Mutex
+		spilled []string
+	)
+	spill := func(session *Session, msg interface{}) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		spilled = append(spilled, msg.(string))
+	}
+	session, peer := newStalledSession(t, 1, SendPolicy{Mode: POLICY_SPILL, Spill: spill})
+	defer peer.Close()
+
+	unitest.NotError(t, session.AsyncSend("1"))
+	unitest.NotError(t, session.AsyncSend("2"))
+	session.Close()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	unitest.Pass(t, len(spilled) == 2 && spilled[0] == "2" && spilled[1] == "1")
+	unitest.Pass(t, session.SendStats().Spill == 2)
+	unitest.Pass(t, GlobalSendStats().Spill >= 2)
+}
+
+func Test_SendPolicy_Drained(t *testing.T) {
+	var (
+		mutex   sync.Mutex
+		spilled []interface{}
+	)
+	policy := SendPolicy{Mode: POLICY_SPILL}
+	policy.Spill = func(session *Session, msg interface{}) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		spilled = append(spilled, msg)
+	}
+	// queue the spilled messages again once there's room
+	policy.Drained = func(session *Session) {
+		mutex.Lock()
+		msgs := spilled
+		spilled = nil
+		mutex.Unlock()
+		for _, msg := range msgs {
+			session.AsyncSend(msg)
+		}
+	}
+	session, peer := newStalledSession(t, 1, policy)
+	defer session.Close()
+	defer peer.Close()
+
+	unitest.NotError(t, session.AsyncSend("1"))
+	unitest.NotError(t, session.AsyncSend("2"))
+	unitest.NotError(t, session.AsyncSend("3"))
+	unitest.Pass(t, session.SendStats().Spill == 2)
+
+	msgs := receiveStrings(t, peer, 4)
+	unitest.Pass(t, msgs[0] == "0" && msgs[1] == "1" && msgs[2] == "2" && msgs[3] == "3")
+}
+
+func Test_AsyncSendPriority(t *testing.T) {
+	session, peer := newStalledSession(t, 4, SendPolicy{})
+	defer session.Close()
+	defer peer.Close()
+
+	unitest.NotError(t, session.AsyncSend("1"))
+	unitest.NotError(t, session.AsyncSend("2"))
+	unitest.NotError(t, session.AsyncSendPriority("h1", PRIORITY_HIGH))
+	unitest.NotError(t, session.AsyncSendPriority("h2", PRIORITY_HIGH))
+	unitest.NotError(t, session.AsyncSendPriority("3", PRIORITY_NORMAL))
+	unitest.Pass(t, session.SendQueueLen() == 5)
+
+	msgs := receiveStrings(t, peer, 6)
+	unitest.Pass(t, msgs[0] == "0" && msgs[1] == "h1" && msgs[2] == "h2")
+	unitest.Pass(t, msgs[3] == "1" && msgs[4] == "2" && msgs[5] == "3")
+}
+
+func Test_AsyncSendPriority_Send(t *testing.T) {
+	session, peer := newStalledSession(t, 2, SendPolicy{})
+	defer session.Close()
+	defer peer.Close()
+
+	// the high lane goes before a Send waiting for the send loop
+	unitest.NotError(t, session.AsyncSendPriority("h1", PRIORITY_HIGH))
+	go session.Send("s")
+
+	msgs := receiveStrings(t, peer, 3)
+	unitest.Pass(t, msgs[0] == "0" && msgs[1] == "h1" && msgs[2] == "s")
+}
+
+func Test_AsyncSendPriority_Full(t *testing.T) {
+	session, peer := newStalledSession(t, 1, SendPolicy{Mode: POLICY_DROP_OLDEST})
+	defer peer.Close()
+
+	unitest.NotError(t, session.AsyncSendPriority("h1", PRIORITY_HIGH))
+	unitest.Pass(t, session.AsyncSendPriority("h2", PRIORITY_HIGH) == ErrBlocking)
+	unitest.Pass(t, session.IsClosed())
+}
@@ -1,14 +1,29 @@
 package libnet
 
 import (
+	"errors"
 	"net"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
+var ErrServerClosed = errors.New("Server closed")
+
 type Server struct {
 	listener  net.Listener
 	codecType CodecType
+	codecId   uint64
+
+	// About interceptors
+	recvInterceptors []Interceptor
+	sendInterceptors []Interceptor
+
+	// About admission control
+	admission *Admission
+
+	// About metrics
+	traffic TrafficStats
 
 	// About sessions
 	maxSessionId uint64
@@ -17,6 +32,7 @@ type Server struct {
 
 	// About server start and stop
 	stopFlag int32
+	closed   bool // no new sessions, guarded by sessionMutex
 	stopChan chan int
 	stopWait sync.WaitGroup
 
@@ -28,6 +44,7 @@ func NewServer(listener net.Listener, codecType CodecType) *Server {
 	server := &Server{
 		listener:  listener,
 		codecType: codecType,
+		codecId:   atomic.AddUint64(&globalCodecId, 1),
 		sessions:  make(map[uint64]*Session),
 		stopChan:  make(chan int),
 	}
@@ -39,16 +56,29 @@ func (server *Server) Listener() net.Listener {
 }
 
 func (server *Server) Accept() (*Session, error) {
-	conn, err := server.listener.Accept()
-	if err != nil {
-		return nil, err
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if server.admission != nil {
+			if reason := server.admit(conn); reason != nil {
+				server.rejectSession(conn, reason)
+				continue
+			}
+		}
+		session := server.newSession(conn)
+		if session == nil {
+			return nil, ErrServerClosed
+		}
+		return session, nil
 	}
-	return server.newSession(conn), nil
 }
 
 func (server *Server) Stop() bool {
 	if atomic.CompareAndSwapInt32(&server.stopFlag, 0, 1) {
 		server.listener.Close()
+		server.closeAccept()
 		close(server.stopChan)
 		server.closeSessions()
 		server.stopWait.Wait()
@@ -57,19 +87,68 @@ func (server *Server) Stop() bool {
 	return false
 }
 
+// Stop accepting new connections and wait for the sessions to close by themselves.
+// Sessions still alive after timeout are closed. Returns false when the server
+// was already stopped or the timeout was hit.
+func (server *Server) Drain(timeout time.Duration) bool {
+	if atomic.LoadInt32(&server.stopFlag) != 0 {
+		return false
+	}
+	server.listener.Close()
+	server.closeAccept()
+
+	drained := make(chan int)
+	go func() {
+		server.stopWait.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		server.Stop()
+		return true
+	case <-time.After(timeout):
+		server.Stop()
+		return false
+	}
+}
+
 func (server *Server) newSession(conn net.Conn) *Session {
 	session := NewSession(conn, server.codecType)
-	server.putSession(session)
+	session.codecId = server.codecId
+	session.server = server
+	session.serverTraffic = &server.traffic
+	session.recvInterceptors = append([]Interceptor(nil), server.recvInterceptors...)
+	session.sendInterceptors = append([]Interceptor(nil), server.sendInterceptors...)
+	if !server.putSession(session) {
+		server.release(session)
+		session.Close()
+		return nil
+	}
 	return session
 }
 
-func (server *Server) putSession(session *Session) {
+// After this no session is added, so stopWait.Add doesn't race with stopWait.Wait.
+func (server *Server) closeAccept() {
+	server.sessionMutex.Lock()
+	server.closed = true
+	server.sessionMutex.Unlock()
+}
+
+func (server *Server) putSession(session *Session) bool {
 	server.sessionMutex.Lock()
 	defer server.sessionMutex.Unlock()
 
-	session.AddCloseCallback(server, func() { server.delSession(session) })
+	if server.closed {
+		return false
+	}
+	session.AddCloseCallback(server, func() {
+		server.delSession(session)
+		server.release(session)
+	})
 	server.sessions[session.id] = session
 	server.stopWait.Add(1)
+	return true
 }
 
 func (server *Server) delSession(session *Session) {
@@ -81,6 +160,12 @@ func (server *Server) delSession(session *Session) {
 	server.stopWait.Done()
 }
 
+func (server *Server) SessionNum() int {
+	server.sessionMutex.Lock()
+	defer server.sessionMutex.Unlock()
+	return len(server.sessions)
+}
+
 func (server *Server) copySessions() []*Session {
 	server.sessionMutex.Lock()
 	defer server.sessionMutex.Unlock()
@@ -0,0 +1,86 @@
+package libnet
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/funny/unitest"
+)
+
+func serveEcho(t *testing.T, codecType CodecType) *Server {
+	server, err := Serve("tcp", "127.0.0.1:0", codecType)
+	unitest.NotError(t, err)
+
+	go func() {
+		for {
+			session, err := server.Accept()
+			if err != nil {
+				break
+			}
+			go func() {
+				io.Copy(session.conn, session.conn)
+				session.Close()
+			}()
+		}
+	}()
+	return server
+}
+
+func Test_Server_Drain(t *testing.T) {
+	server := serveEcho(t, Bytes(Uint16BE))
+	addr := server.Listener().Addr().String()
+
+	sessions := make([]*Session, 10)
+	for i := range sessions {
+		session, err := Connect("tcp", addr, Bytes(Uint16BE))
+		unitest.NotError(t, err)
+		BytesTest(t, session)
+		sessions[i] = session
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		for _, session := range sessions {
+			session.Close()
+		}
+	}()
+
+	begin := time.Now()
+	unitest.Pass(t, server.Drain(5*time.Second))
+	unitest.Pass(t, time.Since(begin) < 5*time.Second)
+
+	_, err := Connect("tcp", addr, Bytes(Uint16BE))
+	unitest.Pass(t, err != nil)
+}
+
+func Test_Server_Drain_Timeout(t *testing.T) {
+	server := serveEcho(t, Bytes(Uint16BE))
+
+	session, err := Connect("tcp", server.Listener().Addr().String(), Bytes(Uint16BE))
+	unitest.NotError(t, err)
+	defer session.Close()
+
+	unitest.Pass(t, !server.Drain(200*time.Millisecond))
+	unitest.Pass(t, !server.Drain(200*time.Millisecond))
+
+	// the server side session was closed, so the client sees EOF
+	var msg []byte
+	unitest.Pass(t, session.Receive(&msg) != nil)
+}
+
+// Connections accepted while the server drains don't become sessions.
+func Test_Server_Drain_Accept(t *testing.T) {
+	server, err := Serve("tcp", "127.0.0.1:0", Bytes(Uint16BE))
+	unitest.NotError(t, err)
+
+	conn, err := net.Dial("tcp", server.Listener().Addr().String())
+	unitest.NotError(t, err)
+	defer conn.Close()
+
+	unitest.Pass(t, server.Drain(time.Second))
+	session := server.newSession(conn)
+	unitest.Pass(t, session == nil)
+	unitest.Pass(t, server.SessionNum() == 0)
+}
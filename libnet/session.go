@@ -3,9 +3,11 @@ package libnet
 import (
 	"container/list"
 	"errors"
+	"io"
 	"net"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 var (
@@ -14,15 +16,47 @@ var (
 )
 
 type Session struct {
-	id    uint64
-	conn  net.Conn
-	codec Codec
+	id      uint64
+	conn    net.Conn
+	codec   Codec
+	codecId uint64
+	server  *Server
+	writer  frameWriter
 
 	// About send and receive
 	recvMutex    sync.Mutex
 	sendMutex    sync.Mutex
 	sendLoopFlag int32
-	sendChan     chan interface{}
+
+	// About async send queue
+	sendQueue      *list.List
+	highQueue      *list.List
+	sendQueueSize  int
+	sendQueueMutex sync.Mutex
+	sendSignal     chan int
+	sendSpace      chan int
+	sendPolicy     SendPolicy
+	sendStats      SendPolicyStats
+	sendSpilled    int32
+
+	// About idle timeout
+	readIdle         *time.Timer
+	readIdleTimeout  time.Duration
+	writeIdle        *time.Timer
+	writeIdleTimeout time.Duration
+
+	// About interceptors
+	recvInterceptors []Interceptor
+	sendInterceptors []Interceptor
+
+	// About call
+	caller *caller
+
+	// About metrics
+	traffic       TrafficStats
+	serverTraffic *TrafficStats
+	startTime     time.Time
+	closeTime     int64
 
 	// About session close
 	closeChan       chan int
@@ -34,16 +68,22 @@ type Session struct {
 	State interface{}
 }
 
-var globalSessionId uint64
+var (
+	globalSessionId uint64
+	globalCodecId   uint64
+)
 
 func NewSession(conn net.Conn, codecType CodecType) *Session {
 	session := &Session{
 		id:             atomic.AddUint64(&globalSessionId, 1),
 		conn:           conn,
-		codec:          codecType.NewCodec(conn, conn),
+		codecId:        atomic.AddUint64(&globalCodecId, 1),
 		closeChan:      make(chan int),
 		closeCallbacks: list.New(),
+		startTime:      time.Now(),
 	}
+	session.writer = frameWriter{session: session, conn: conn}
+	session.codec = codecType.NewCodec(countReader{session, conn}, &session.writer)
 	return session
 }
 
@@ -51,11 +91,21 @@ func (session *Session) Id() uint64     { return session.id }
 func (session *Session) Conn() net.Conn { return session.conn }
 func (session *Session) IsClosed() bool { return atomic.LoadInt32(&session.closeFlag) != 0 }
 
+// The server that accepted the session, nil for sessions from NewSession.
+func (session *Session) Server() *Server { return session.server }
+
+// The peer address, or the client address given by the load balancer when
+// accepted by a NewProxyListener.
+func (session *Session) RemoteAddr() net.Addr { return session.conn.RemoteAddr() }
+
 func (session *Session) Close() {
 	if atomic.CompareAndSwapInt32(&session.closeFlag, 0, 1) {
+		atomic.StoreInt64(&session.closeTime, time.Now().UnixNano())
 		session.invokeCloseCallbacks()
 		close(session.closeChan)
 		session.conn.Close()
+		session.stopIdleTimers()
+		session.spillSendQueue()
 	}
 }
 
@@ -63,58 +113,354 @@ func (session *Session) Receive(msg interface{}) (err error) {
 	session.recvMutex.Lock()
 	defer session.recvMutex.Unlock()
 
+	if len(session.recvInterceptors) == 0 {
+		return session.decode(msg)
+	}
+
+	for {
+		var invoked bool
+		var decodeErr error
+		err = invokeInterceptors(session, session.recvInterceptors, msg, func(msg interface{}) error {
+			invoked, decodeErr = true, session.decode(msg)
+			return decodeErr
+		})
+		// drop the rejected message and receive the next one
+		if err == nil || decodeErr != nil || !invoked {
+			return
+		}
+	}
+}
+
+func (session *Session) decode(msg interface{}) (err error) {
 	err = session.codec.Decode(msg)
 	if err != nil {
+		if err != io.EOF && !session.IsClosed() {
+			session.addTraffic(decodeErrors, 1)
+		}
 		session.Close()
+		return
+	}
+	session.addTraffic(msgIn, 1)
+	if session.readIdle != nil {
+		session.readIdle.Reset(session.readIdleTimeout)
 	}
 	return
 }
 
+// Messages queued by AsyncSendPriority with PRIORITY_HIGH are sent first.
 func (session *Session) Send(msg interface{}) (err error) {
 	session.sendMutex.Lock()
 	defer session.sendMutex.Unlock()
 
-	err = session.codec.Encode(msg)
+	if err = session.sendHighQueue(); err != nil {
+		return
+	}
+	return session.send(msg)
+}
+
+// Must hold sendMutex.
+func (session *Session) send(msg interface{}) error {
+	if len(session.sendInterceptors) == 0 {
+		return session.encode(msg)
+	}
+	return invokeInterceptors(session, session.sendInterceptors, msg, session.encode)
+}
+
+func (session *Session) encode(msg interface{}) (err error) {
+	if frame, ok := msg.(*Frame); ok {
+		err = session.sendFrame(frame)
+	} else {
+		err = session.codec.Encode(msg)
+	}
 	if err != nil {
+		if !session.IsClosed() {
+			session.addTraffic(encodeErrors, 1)
+		}
 		session.Close()
+		return
+	}
+	session.addTraffic(msgOut, 1)
+	if session.writeIdle != nil {
+		session.writeIdle.Reset(session.writeIdleTimeout)
 	}
 	return
 }
 
 func (session *Session) EnableAsyncSend(sendChanSize int) {
+	session.sendQueueMutex.Lock()
+	defer session.sendQueueMutex.Unlock()
+
 	if atomic.CompareAndSwapInt32(&session.sendLoopFlag, 0, 1) {
-		session.sendChan = make(chan interface{}, sendChanSize)
-		go func() {
-			for {
-				select {
-				case msg := <-session.sendChan:
-					if err := session.Send(msg); err != nil {
-						return
-					}
-				case <-session.closeChan:
-					return
-				}
+		session.sendQueue = list.New()
+		session.highQueue = list.New()
+		session.sendQueueSize = sendChanSize
+		session.sendSignal = make(chan int, 1)
+		session.sendSpace = make(chan int, 1)
+		go session.sendLoop()
+	}
+}
+
+func (session *Session) IsAsyncSend() bool {
+	return atomic.LoadInt32(&session.sendLoopFlag) == 1
+}
+
+func (session *Session) sendLoop() {
+	for {
+		select {
+		case <-session.sendSignal:
+		case <-session.closeChan:
+			return
+		}
+		for {
+			msg, ok := session.popSendQueue()
+			if !ok {
+				break
+			}
+			if err := session.Send(msg); err != nil {
+				return
 			}
-		}()
+		}
+		// only high priority messages were queued
+		session.sendMutex.Lock()
+		err := session.sendHighQueue()
+		session.sendMutex.Unlock()
+		if err != nil {
+			return
+		}
+		session.invokeDrained()
 	}
 }
 
+// Tell the SendPolicy the queue is empty if messages were spilled since the
+// last time. A spill only happens on a full queue, which wakes the send loop,
+// so the loop always gets here again after it.
+func (session *Session) invokeDrained() {
+	if !atomic.CompareAndSwapInt32(&session.sendSpilled, 1, 0) {
+		return
+	}
+	session.sendQueueMutex.Lock()
+	drained := session.sendPolicy.Drained
+	session.sendQueueMutex.Unlock()
+	if drained != nil {
+		drained(session)
+	}
+}
+
+// Must hold sendMutex. Send the messages queued with PRIORITY_HIGH, in order.
+func (session *Session) sendHighQueue() error {
+	if atomic.LoadInt32(&session.sendLoopFlag) != 1 {
+		return nil
+	}
+	for {
+		session.sendQueueMutex.Lock()
+		front := session.highQueue.Front()
+		if front != nil {
+			session.highQueue.Remove(front)
+		}
+		session.sendQueueMutex.Unlock()
+
+		if front == nil {
+			return nil
+		}
+		if err := session.send(front.Value); err != nil {
+			return err
+		}
+	}
+}
+
+func (session *Session) popSendQueue() (interface{}, bool) {
+	session.sendQueueMutex.Lock()
+	defer session.sendQueueMutex.Unlock()
+
+	front := session.sendQueue.Front()
+	if front == nil {
+		return nil, false
+	}
+	session.sendQueue.Remove(front)
+	notify(session.sendSpace)
+	return front.Value, true
+}
+
+// Must hold sendQueueMutex.
+func (session *Session) pushSendQueue(msg interface{}) {
+	session.sendQueue.PushBack(msg)
+	notify(session.sendSignal)
+	if session.sendQueue.Len() < session.sendQueueSize {
+		// wake up the next blocked AsyncSend
+		notify(session.sendSpace)
+	}
+}
+
+func notify(c chan int) {
+	select {
+	case c <- 1:
+	default:
+	}
+}
+
+// Queue msg for the send loop. When the queue is full the session's SendPolicy
+// decides what happens, by default the session is closed and ErrBlocking returned.
 func (session *Session) AsyncSend(msg interface{}) error {
 	if session.IsClosed() {
 		return ErrClosed
 	}
 
-	if session.sendLoopFlag != 1 {
+	if atomic.LoadInt32(&session.sendLoopFlag) != 1 {
 		panic("AsyncSend not enable")
 	}
 
-	select {
-	case session.sendChan <- msg:
-	default:
-		session.Close()
-		return ErrBlocking
+	session.sendQueueMutex.Lock()
+	if session.sendQueue.Len() < session.sendQueueSize {
+		session.pushSendQueue(msg)
+		session.sendQueueMutex.Unlock()
+		return nil
+	}
+
+	policy := session.sendPolicy
+	switch policy.Mode {
+	case POLICY_BLOCK:
+		session.sendQueueMutex.Unlock()
+		return session.blockSend(msg, policy.Timeout)
+	case POLICY_DROP_OLDEST:
+		session.sendQueue.Remove(session.sendQueue.Front())
+		session.pushSendQueue(msg)
+		session.sendQueueMutex.Unlock()
+		session.sendStats.incr(&session.sendStats.DropOldest)
+		return nil
+	case POLICY_DROP_PRIORITY:
+		session.dropByPriority(msg, policy.Priority)
+		session.sendQueueMutex.Unlock()
+		session.sendStats.incr(&session.sendStats.DropPriority)
+		return nil
+	case POLICY_SPILL:
+		atomic.StoreInt32(&session.sendSpilled, 1)
+		session.sendQueueMutex.Unlock()
+		session.sendStats.incr(&session.sendStats.Spill)
+		if policy.Spill != nil {
+			policy.Spill(session, msg)
+		}
+		return nil
+	}
+	session.sendQueueMutex.Unlock()
+	session.sendStats.incr(&session.sendStats.Close)
+	session.Close()
+	return ErrBlocking
+}
+
+// Lanes of the async send queue.
+const (
+	PRIORITY_NORMAL = iota
+	PRIORITY_HIGH
+)
+
+// AsyncSend in the lane of priority. PRIORITY_HIGH is for small control
+// messages like ping replies and kick notices: they are sent before any
+// normal message still queued and before the next Send. The high lane holds
+// as many messages as the normal one, a peer not reading even those is gone,
+// so when it's full the session is closed and ErrBlocking returned whatever
+// the SendPolicy.
+func (session *Session) AsyncSendPriority(msg interface{}, priority int) error {
+	if priority < PRIORITY_HIGH {
+		return session.AsyncSend(msg)
+	}
+
+	if session.IsClosed() {
+		return ErrClosed
+	}
+
+	if atomic.LoadInt32(&session.sendLoopFlag) != 1 {
+		panic("AsyncSend not enable")
+	}
+
+	session.sendQueueMutex.Lock()
+	if session.highQueue.Len() < session.sendQueueSize {
+		session.highQueue.PushBack(msg)
+		notify(session.sendSignal)
+		session.sendQueueMutex.Unlock()
+		return nil
+	}
+	session.sendQueueMutex.Unlock()
+	session.sendStats.incr(&session.sendStats.Close)
+	session.Close()
+	return ErrBlocking
+}
+
+func (session *Session) blockSend(msg interface{}, timeout time.Duration) error {
+	session.sendStats.incr(&session.sendStats.Block)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-session.sendSpace:
+		case <-session.closeChan:
+			return ErrClosed
+		case <-timer.C:
+			session.sendStats.incr(&session.sendStats.Timeout)
+			session.Close()
+			return ErrBlocking
+		}
+
+		session.sendQueueMutex.Lock()
+		if session.sendQueue.Len() < session.sendQueueSize {
+			session.pushSendQueue(msg)
+			session.sendQueueMutex.Unlock()
+			return nil
+		}
+		session.sendQueueMutex.Unlock()
+	}
+}
+
+// Must hold sendQueueMutex. Drop the lowest priority message, the oldest one
+// when several share the lowest priority. msg itself is dropped when nothing
+// queued is less important.
+func (session *Session) dropByPriority(msg interface{}, priority func(interface{}) int) {
+	if priority == nil {
+		return
+	}
+
+	var lowest *list.Element
+	lowestPriority := priority(msg)
+	for i := session.sendQueue.Front(); i != nil; i = i.Next() {
+		if p := priority(i.Value); p < lowestPriority {
+			lowest, lowestPriority = i, p
+		}
+	}
+	if lowest == nil {
+		return
+	}
+	session.sendQueue.Remove(lowest)
+	session.pushSendQueue(msg)
+}
+
+// Hand the messages still queued at close time to the spill callback.
+func (session *Session) spillSendQueue() {
+	if atomic.LoadInt32(&session.sendLoopFlag) != 1 {
+		return
+	}
+
+	session.sendQueueMutex.Lock()
+	policy := session.sendPolicy
+	if policy.Mode != POLICY_SPILL || policy.Spill == nil {
+		session.sendQueueMutex.Unlock()
+		return
+	}
+	msgs := make([]interface{}, 0, session.highQueue.Len()+session.sendQueue.Len())
+	for i := session.highQueue.Front(); i != nil; i = i.Next() {
+		msgs = append(msgs, i.Value)
+	}
+	for i := session.sendQueue.Front(); i != nil; i = i.Next() {
+		msgs = append(msgs, i.Value)
+	}
+	session.highQueue.Init()
+	session.sendQueue.Init()
+	session.sendQueueMutex.Unlock()
+
+	for _, msg := range msgs {
+		session.sendStats.incr(&session.sendStats.Spill)
+		policy.Spill(session, msg)
 	}
-	return nil
 }
 
 type closeCallback struct {
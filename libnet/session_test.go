@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io"
 	"math/rand"
+	"net"
 	"runtime/pprof"
 	"sync"
 	"testing"
@@ -224,6 +225,39 @@ func Test_Bufio_Packet_SelfCodec(t *testing.T) {
 	SessionTest(t, Bufio(Packet(Uint16BE, SelfCodec())), ObjectTest)
 }
 
+func Test_MsgPack(t *testing.T) {
+	SessionTest(t, MsgPack(), ObjectTest)
+}
+
+func Test_Bufio_MsgPack(t *testing.T) {
+	SessionTest(t, Bufio(MsgPack()), ObjectTest)
+}
+
+func Test_Packet_MsgPack(t *testing.T) {
+	SessionTest(t, Packet(Uint16BE, MsgPack()), ObjectTest)
+}
+
+func Test_Bufio_Packet_MsgPack(t *testing.T) {
+	SessionTest(t, Bufio(Packet(Uint16BE, MsgPack())), ObjectTest)
+}
+
+func Test_PacketLimit(t *testing.T) {
+	conn1, conn2 := net.Pipe()
+	session := NewSession(conn1, PacketLimit(Uint16BE, 100, Bytes(Uint16BE)))
+	peer := NewSession(conn2, Packet(Uint16BE, Bytes(Uint16BE)))
+	defer peer.Close()
+
+	go func() {
+		peer.Send(RandBytes(50))
+		peer.Send(make([]byte, 200))
+	}()
+
+	var msg []byte
+	unitest.NotError(t, session.Receive(&msg))
+	unitest.Pass(t, session.Receive(&msg) == binary.ErrPacketTooLarge)
+	unitest.Pass(t, session.IsClosed())
+}
+
 func MakeSureSessionGoroutineExit(t *testing.T) {
 	buff := new(bytes.Buffer)
 	goroutines := pprof.Lookup("goroutine")
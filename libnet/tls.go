@@ -0,0 +1,95 @@
+package libnet
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+)
+
+var ErrBadCAFile = errors.New("No certificate found in CA file")
+
+// TLS settings shared by servers and clients, loaded from the json config files.
+type TLSConfig struct {
+	Enable     bool
+	CertFile   string
+	KeyFile    string
+	CAFile     string
+	ServerName string
+	// Server side: reject clients without a certificate signed by CAFile.
+	// When false and CAFile is set, client certificates are verified if given.
+	ClientAuth bool
+}
+
+func (config *TLSConfig) ServerConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if config.CAFile != "" {
+		pool, err := loadCertPool(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		if config.ClientAuth {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return tlsConfig, nil
+}
+
+func (config *TLSConfig) ClientConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: config.ServerName,
+	}
+
+	if config.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if config.CAFile != "" {
+		pool, err := loadCertPool(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, ErrBadCAFile
+	}
+	return pool, nil
+}
+
+// Verified client certificate chains of a TLS session. Nil when the session is
+// not over TLS or the peer did not present a verified certificate.
+func (session *Session) VerifiedChains() [][]*x509.Certificate {
+	conn, ok := session.conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	if err := conn.Handshake(); err != nil {
+		return nil
+	}
+	return conn.ConnectionState().VerifiedChains
+}
@@ -0,0 +1,162 @@
+package libnet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/funny/unitest"
+)
+
+type testPKI struct {
+	Dir    string
+	CAFile string
+	CA     *x509.Certificate
+	CAKey  *ecdsa.PrivateKey
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	dir, err := ioutil.TempDir("", "libnet_tls")
+	unitest.NotError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	unitest.NotError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "libnet test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	unitest.NotError(t, err)
+	ca, err := x509.ParseCertificate(der)
+	unitest.NotError(t, err)
+
+	pki := &testPKI{Dir: dir, CAFile: filepath.Join(dir, "ca.pem"), CA: ca, CAKey: key}
+	writePEM(t, pki.CAFile, "CERTIFICATE", der)
+	return pki
+}
+
+func (pki *testPKI) Issue(t *testing.T, name string, serial int64) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	unitest.NotError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, pki.CA, &key.PublicKey, pki.CAKey)
+	unitest.NotError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	unitest.NotError(t, err)
+
+	certFile = filepath.Join(pki.Dir, name+".pem")
+	keyFile = filepath.Join(pki.Dir, name+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDer)
+	return
+}
+
+func writePEM(t *testing.T, file, typ string, der []byte) {
+	f, err := os.Create(file)
+	unitest.NotError(t, err)
+	defer f.Close()
+	unitest.NotError(t, pem.Encode(f, &pem.Block{Type: typ, Bytes: der}))
+}
+
+func serveEchoTLS(t *testing.T, config *TLSConfig) *Server {
+	serverConfig, err := config.ServerConfig()
+	unitest.NotError(t, err)
+
+	server, err := ServeTLS("tcp", "127.0.0.1:0", serverConfig, Bytes(Uint16BE))
+	unitest.NotError(t, err)
+
+	go func() {
+		for {
+			session, err := server.Accept()
+			if err != nil {
+				break
+			}
+			go io.Copy(session.conn, session.conn)
+		}
+	}()
+	return server
+}
+
+func Test_TLS_Bytes(t *testing.T) {
+	pki := newTestPKI(t)
+	defer os.RemoveAll(pki.Dir)
+
+	certFile, keyFile := pki.Issue(t, "server", 2)
+	server := serveEchoTLS(t, &TLSConfig{Enable: true, CertFile: certFile, KeyFile: keyFile})
+	defer server.Stop()
+
+	clientConfig, err := (&TLSConfig{Enable: true, CAFile: pki.CAFile}).ClientConfig()
+	unitest.NotError(t, err)
+
+	session, err := ConnectTimeoutTLS("tcp", server.Listener().Addr().String(), time.Second, clientConfig, Bytes(Uint16BE))
+	unitest.NotError(t, err)
+	defer session.Close()
+
+	BytesTest(t, session)
+}
+
+func Test_TLS_ClientAuth(t *testing.T) {
+	pki := newTestPKI(t)
+	defer os.RemoveAll(pki.Dir)
+
+	serverCert, serverKey := pki.Issue(t, "server", 2)
+	clientCert, clientKey := pki.Issue(t, "client", 3)
+	server := serveEchoTLS(t, &TLSConfig{
+		Enable: true, CertFile: serverCert, KeyFile: serverKey, CAFile: pki.CAFile, ClientAuth: true,
+	})
+	defer server.Stop()
+	addr := server.Listener().Addr().String()
+
+	// without a client certificate the handshake must fail
+	anonymous, err := (&TLSConfig{Enable: true, CAFile: pki.CAFile}).ClientConfig()
+	unitest.NotError(t, err)
+	session, err := ConnectTLS("tcp", addr, anonymous, Bytes(Uint16BE))
+	if err == nil {
+		err = session.Send([]byte("ping"))
+		if err == nil {
+			var msg []byte
+			err = session.Receive(&msg)
+		}
+		session.Close()
+	}
+	unitest.Pass(t, err != nil)
+
+	mutual, err := (&TLSConfig{Enable: true, CertFile: clientCert, KeyFile: clientKey, CAFile: pki.CAFile}).ClientConfig()
+	unitest.NotError(t, err)
+	session, err = ConnectTLS("tcp", addr, mutual, Bytes(Uint16BE))
+	unitest.NotError(t, err)
+	defer session.Close()
+
+	msg1 := []byte("ping")
+	unitest.NotError(t, session.Send(msg1))
+	var msg2 []byte
+	unitest.NotError(t, session.Receive(&msg2))
+	unitest.Pass(t, bytes.Equal(msg1, msg2))
+}
@@ -0,0 +1,241 @@
+package libnet
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrWebSocketClosed = errors.New("WebSocket listener closed")
+
+const DEFAULT_WEBSOCKET_PATH = "/"
+
+type WebSocketConfig struct {
+	// Path of the upgrade handler, DEFAULT_WEBSOCKET_PATH if empty.
+	Path string
+	// websocket.TextMessage or websocket.BinaryMessage. 0 answers with the
+	// type of the last message received, binary until then.
+	MessageType int
+	// nil only accepts requests without Origin or from the same host.
+	CheckOrigin func(r *http.Request) bool
+	// Largest message accepted, 0 means no limit.
+	MaxMessageSize int64
+}
+
+// Listener accepting WebSocket upgrades over the connections of another
+// listener, each accepted conn reads and writes WebSocket messages. Use a
+// codec from WebSocketMessage so each message encoded is one WebSocket
+// message, the same sessions and handlers serve TCP and browser clients.
+type WebSocketListener struct {
+	listener  net.Listener
+	config    WebSocketConfig
+	upgrader  websocket.Upgrader
+	conns     chan net.Conn
+	closeChan chan int
+	closeOnce sync.Once
+}
+
+func NewWebSocketListener(listener net.Listener, config WebSocketConfig) *WebSocketListener {
+	if config.Path == "" {
+		config.Path = DEFAULT_WEBSOCKET_PATH
+	}
+	l := &WebSocketListener{
+		listener:  listener,
+		config:    config,
+		upgrader:  websocket.Upgrader{CheckOrigin: config.CheckOrigin},
+		conns:     make(chan net.Conn),
+		closeChan: make(chan int),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(config.Path, l.upgrade)
+	go func() {
+		http.Serve(listener, mux)
+		l.Close()
+	}()
+	return l
+}
+
+func ServeWebSocket(network, address string, config WebSocketConfig, codecType CodecType) (*Server, error) {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(NewWebSocketListener(listener, config), WebSocketMessage(codecType)), nil
+}
+
+func ConnectWebSocket(url string, codecType CodecType) (*Session, error) {
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewSession(newWebSocketConn(ws, 0), WebSocketMessage(codecType)), nil
+}
+
+func (l *WebSocketListener) upgrade(w http.ResponseWriter, r *http.Request) {
+	ws, err := l.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	if l.config.MaxMessageSize > 0 {
+		ws.SetReadLimit(l.config.MaxMessageSize)
+	}
+	conn := newWebSocketConn(ws, l.config.MessageType)
+	select {
+	case l.conns <- conn:
+	case <-l.closeChan:
+		conn.Close()
+	}
+}
+
+func (l *WebSocketListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closeChan:
+		return nil, ErrWebSocketClosed
+	}
+}
+
+func (l *WebSocketListener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.closeChan)
+		err = l.listener.Close()
+	})
+	return err
+}
+
+func (l *WebSocketListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// net.Conn over a WebSocket. Read gives the contents of the messages one
+// after another, like PacketReader gives packets. Each Write is sent as one
+// message.
+type webSocketConn struct {
+	ws          *websocket.Conn
+	messageType int
+	lastType    int32
+	reader      io.Reader
+}
+
+func newWebSocketConn(ws *websocket.Conn, messageType int) *webSocketConn {
+	return &webSocketConn{
+		ws:          ws,
+		messageType: messageType,
+		lastType:    websocket.BinaryMessage,
+	}
+}
+
+func (conn *webSocketConn) Read(p []byte) (int, error) {
+	for {
+		if conn.reader == nil {
+			messageType, reader, err := conn.ws.NextReader()
+			if err != nil {
+				// a close frame is the end of the stream
+				if _, ok := err.(*websocket.CloseError); ok {
+					return 0, io.EOF
+				}
+				return 0, err
+			}
+			atomic.StoreInt32(&conn.lastType, int32(messageType))
+			conn.reader = reader
+		}
+		n, err := conn.reader.Read(p)
+		if err == io.EOF {
+			conn.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (conn *webSocketConn) Write(p []byte) (int, error) {
+	messageType := conn.messageType
+	if messageType == 0 {
+		messageType = int(atomic.LoadInt32(&conn.lastType))
+	}
+	if err := conn.ws.WriteMessage(messageType, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Send a close frame then close the connection.
+func (conn *webSocketConn) Close() error {
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	conn.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	return conn.ws.Close()
+}
+
+func (conn *webSocketConn) LocalAddr() net.Addr {
+	return conn.ws.LocalAddr()
+}
+
+func (conn *webSocketConn) RemoteAddr() net.Addr {
+	return conn.ws.RemoteAddr()
+}
+
+func (conn *webSocketConn) SetDeadline(t time.Time) error {
+	if err := conn.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return conn.ws.SetWriteDeadline(t)
+}
+
+func (conn *webSocketConn) SetReadDeadline(t time.Time) error {
+	return conn.ws.SetReadDeadline(t)
+}
+
+func (conn *webSocketConn) SetWriteDeadline(t time.Time) error {
+	return conn.ws.SetWriteDeadline(t)
+}
+
+// Encode each message into one Write, so it goes out as one WebSocket
+// message whatever the number of writes codecType does.
+func WebSocketMessage(codecType CodecType) CodecType {
+	return webSocketCodecType{codecType}
+}
+
+type webSocketCodecType struct {
+	CodecType CodecType
+}
+
+func (codecType webSocketCodecType) NewCodec(r io.Reader, w io.Writer) Codec {
+	codec := &webSocketCodec{Writer: w}
+	codec.Codec = codecType.CodecType.NewCodec(r, &codec.Buffer)
+	return codec
+}
+
+type webSocketCodec struct {
+	Codec  Codec
+	Writer io.Writer
+	Buffer bytes.Buffer
+}
+
+func (codec *webSocketCodec) Encode(msg interface{}) error {
+	codec.Buffer.Reset()
+	if err := codec.Codec.Encode(msg); err != nil {
+		return err
+	}
+	_, err := codec.Writer.Write(codec.Buffer.Bytes())
+	return err
+}
+
+func (codec *webSocketCodec) Decode(msg interface{}) error {
+	return codec.Codec.Decode(msg)
+}
+
+func (codec *webSocketCodec) FrameState() (interface{}, bool) {
+	return frameState(codec.Codec)
+}
@@ -0,0 +1,79 @@
+package libnet
+
+import (
+	"testing"
+
+	"github.com/funny/unitest"
+	"github.com/gorilla/websocket"
+)
+
+func serveWebSocketEcho(t *testing.T, config WebSocketConfig) (*Server, string) {
+	server, err := ServeWebSocket("tcp", "127.0.0.1:0", config, Json())
+	unitest.NotError(t, err)
+	go servePipeEcho(server)
+	return server, "ws://" + server.Listener().Addr().String() + "/chat"
+}
+
+func Test_WebSocket(t *testing.T) {
+	server, url := serveWebSocketEcho(t, WebSocketConfig{Path: "/chat"})
+	defer server.Stop()
+
+	session, err := ConnectWebSocket(url, Json())
+	unitest.NotError(t, err)
+	defer session.Close()
+
+	for _, s := range []string{"hello", "world"} {
+		unitest.NotError(t, session.Send(s))
+		var msg string
+		unitest.NotError(t, session.Receive(&msg))
+		unitest.Pass(t, msg == s)
+	}
+}
+
+func Test_WebSocket_Message(t *testing.T) {
+	server, url := serveWebSocketEcho(t, WebSocketConfig{Path: "/chat"})
+	defer server.Stop()
+
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	unitest.NotError(t, err)
+	defer ws.Close()
+
+	// answered with the type received, one message per message
+	for _, messageType := range []int{websocket.TextMessage, websocket.BinaryMessage} {
+		unitest.NotError(t, ws.WriteMessage(messageType, []byte(`"hello"`)))
+		typ, data, err := ws.ReadMessage()
+		unitest.NotError(t, err)
+		unitest.Pass(t, typ == messageType)
+		unitest.Pass(t, string(data) == "\"hello\"\n")
+	}
+}
+
+func Test_WebSocket_MaxMessageSize(t *testing.T) {
+	server, url := serveWebSocketEcho(t, WebSocketConfig{Path: "/chat", MaxMessageSize: 16})
+	defer server.Stop()
+
+	session, err := ConnectWebSocket(url, Json())
+	unitest.NotError(t, err)
+	defer session.Close()
+
+	unitest.NotError(t, session.Send("0123456789abcdefghij"))
+	var msg string
+	unitest.Pass(t, session.Receive(&msg) != nil)
+}
+
+func Test_WebSocket_Close(t *testing.T) {
+	server, url := serveWebSocketEcho(t, WebSocketConfig{Path: "/chat"})
+
+	session, err := ConnectWebSocket(url, Json())
+	unitest.NotError(t, err)
+	unitest.NotError(t, session.Send("hello"))
+	var msg string
+	unitest.NotError(t, session.Receive(&msg))
+
+	server.Stop()
+	unitest.Pass(t, session.Receive(&msg) != nil)
+	_, err = server.Accept()
+	unitest.Pass(t, err == ErrWebSocketClosed)
+	_, err = ConnectWebSocket(url, Json())
+	unitest.Pass(t, err != nil)
+}
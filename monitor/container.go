@@ -2,6 +2,7 @@ package main
 
 import (
 	// "goProject/protocol"
+	"goProject/libnet"
 	"sync"
 )
 
@@ -10,9 +11,10 @@ var MsgServerInfoMutex sync.Mutex
 // type InfoData []interface{}
 
 type MsgServerInfo struct {
-	ServerAddr string `json:"server_addr"`
-	Time       int64  `json:"time"`
-	SessionNum uint64 `json:"session_num"`
+	ServerAddr string         `json:"server_addr"`
+	Time       int64          `json:"time"`
+	SessionNum uint64         `json:"session_num"`
+	Traffic    libnet.Metrics `json:"traffic"`
 }
 
 var NewestMsgServerInfoData []MsgServerInfo
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"goProject/libnet"
 	"goProject/log"
 	"os"
 	"time"
@@ -12,6 +13,7 @@ type MonitorConfig struct {
 	TransportProtocols    string
 	LocalIP               string
 	Listen                string
+	TLS                   libnet.TLSConfig
 	LogFile               string
 	MsgServerList         []string
 	ScanDeadServerTimeout time.Duration
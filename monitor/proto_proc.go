@@ -57,6 +57,7 @@ func (self *ProtoProc) procMonitorMsg(cmd protocol.CmdMonitor, session *libnet.S
 			if v.ServerAddr == session.State.(string) {
 				v.Time = cmd.Time
 				v.SessionNum = data.SessionNum
+				v.Traffic = data.Traffic
 				NewestMsgServerInfoData[k] = v
 
 				have = true
@@ -67,6 +68,7 @@ func (self *ProtoProc) procMonitorMsg(cmd protocol.CmdMonitor, session *libnet.S
 				ServerAddr: session.State.(string),
 				Time:       cmd.Time,
 				SessionNum: data.SessionNum,
+				Traffic:    data.Traffic,
 			})
 		}
 
@@ -7,9 +7,9 @@ import (
 	"goProject/log"
 	"goProject/protocol"
 	"goProject/storage/mongo_store"
-	"sync"
-	// "time"
 	"net/http"
+	"sync"
+	"time"
 )
 
 type Monitor struct {
@@ -31,7 +31,17 @@ func NewMonitor(cfg *MonitorConfig) *Monitor {
 
 //连接msgServer
 func (self *Monitor) connectServer(ms string) (*libnet.Session, error) {
-	client, err := libnet.Connect("tcp", ms, libnet.Packet(libnet.Uint16BE, libnet.Json()))
+	codecType := libnet.Packet(libnet.Uint16BE, libnet.Json())
+	if self.cfg.TLS.Enable {
+		tlsConfig, err := self.cfg.TLS.ClientConfig()
+		if err != nil {
+			log.Error(err.Error())
+			return nil, err
+		}
+		return libnet.ConnectTLS("tcp", ms, tlsConfig, codecType)
+	}
+
+	client, err := libnet.Connect("tcp", ms, codecType)
 	if err != nil {
 		log.Error(err.Error())
 		return nil, err
@@ -40,60 +50,55 @@ func (self *Monitor) connectServer(ms string) (*libnet.Session, error) {
 	return client, err
 }
 
-//连接未连接的MsgServerList
-func (self *Monitor) connectDisconnectedMsgServerList() {
-	for _, ms := range self.disConnectedMsgServerList {
-		msgServerClient, err := self.connectServer(ms)
-		if err == nil {
-			log.Info(ms, " : connected")
+//连接MsgServer,断开后按退避时间自动重连
+func (self *Monitor) dialMsgServer(ms string) {
+	dialer := libnet.NewDialer(func() (*libnet.Session, error) {
+		return self.connectServer(ms)
+	}, func(msgServerClient *libnet.Session) error {
+		//每次重连后重新订阅
+		err := self.connectMsgServerCommands(msgServerClient)
+		if err != nil {
+			return err
+		}
+		msgServerClient.State = ms
+
+		// go self.heartBeatWithMsgServer(msgServerClient, ms)
+		go func() {
+			for {
+				var msg protocol.CmdMonitor
+				if err := msgServerClient.Receive(&msg); err != nil {
+					break
+				}
 
-			err = self.connectMsgServerCommands(msgServerClient)
-			if err != nil {
-				log.Error(err.Error())
+				err := self.parseProtocol(msg, msgServerClient)
+				if err != nil {
+					log.Error(err.Error())
+				}
 			}
-
-			self.msgServerMutex.Lock()
-
+		}()
+		return nil
+	})
+	dialer.SetBackoff(time.Second, self.cfg.ScanDeadServerTimeout*time.Second)
+	dialer.OnState(func(dialer *libnet.Dialer, state int, err error) {
+		self.msgServerMutex.Lock()
+		defer self.msgServerMutex.Unlock()
+
+		switch state {
+		case libnet.DIAL_CONNECTED:
+			log.Info(ms, " : connected")
 			self.disConnectedMsgServerList = common.DeleteChild(self.disConnectedMsgServerList, ms)
 			self.connectedMsgServerList = append(self.connectedMsgServerList, ms)
-			self.msgServerClientMap[ms] = msgServerClient
-			msgServerClient.State = ms
-
-			self.msgServerMutex.Unlock()
-
-			// go self.heartBeatWithMsgServer(msgServerClient, ms)
-			go func() {
-				for {
-					var msg protocol.CmdMonitor
-					if err := msgServerClient.Receive(&msg); err != nil {
-						break
-					}
-
-					err := self.parseProtocol(msg, msgServerClient)
-					if err != nil {
-						log.Error(err.Error())
-					}
-				}
-			}()
+			self.msgServerClientMap[ms] = dialer.Session()
+		case libnet.DIAL_DISCONNECTED:
+			log.Info(ms, " : disconnect")
+			self.connectedMsgServerList = common.DeleteChild(self.connectedMsgServerList, ms)
+			self.disConnectedMsgServerList = append(self.disConnectedMsgServerList, ms)
+			delete(self.msgServerClientMap, ms)
 		}
-	}
+	})
+	dialer.Start()
 }
 
-// //扫描没有连接的Server
-// func (self *Monitor) scanDisconnectServer() {
-// 	log.Info("scanDisconnectServer")
-// 	timer := time.NewTicker(self.cfg.ScanDeadServerTimeout * time.Second)
-// 	ttl := time.After(10 * time.Second)
-// 	for {
-// 		select {
-// 		case <-timer.C:
-// 			go self.connectDisconnectedMsgServerList()
-// 		case <-ttl:
-// 			break
-// 		}
-// 	}
-// }
-
 //解析Server过来的命令
 func (self *Monitor) parseProtocol(msg protocol.CmdMonitor, sc *libnet.Session) error {
 	var err error
@@ -146,9 +151,9 @@ func (self *Monitor) subscribeChannels() error {
 
 	self.disConnectedMsgServerList = self.cfg.MsgServerList
 
-	go self.connectDisconnectedMsgServerList()
-
-	// go self.scanDisconnectServer()
+	for _, ms := range self.cfg.MsgServerList {
+		self.dialMsgServer(ms)
+	}
 
 	return err
 }
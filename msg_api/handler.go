@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"errors"
 	"goProject/common"
+	"goProject/info"
 	"goProject/log"
 	"goProject/storage/mongo_store"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -69,9 +71,7 @@ func (self *handle) P2PHistory(w http.ResponseWriter, r *http.Request) {
 		endTime, err = strconv.ParseInt(self.GetParam(r, "endTime"), 10, 64)
 		if err != nil {
 			log.Error(err.Error())
-			resp.Status = RESP_STATUS_ERROR
-			resp.Result = emp
-			self.Response(w, resp)
+			self.ResponseError(w, r, RESP_STATUS_ERROR, info.CODE_INVALID_ARGUMENTS)
 			return
 		}
 	} else {
@@ -81,9 +81,7 @@ func (self *handle) P2PHistory(w http.ResponseWriter, r *http.Request) {
 		n, err = strconv.Atoi(self.GetParam(r, "msgNum"))
 		if err != nil {
 			log.Info("msgNum: ", err)
-			resp.Status = RESP_STATUS_ERROR
-			resp.Result = emp
-			self.Response(w, resp)
+			self.ResponseError(w, r, RESP_STATUS_ERROR, info.CODE_INVALID_ARGUMENTS)
 			return
 		}
 	} else {
@@ -92,9 +90,7 @@ func (self *handle) P2PHistory(w http.ResponseWriter, r *http.Request) {
 
 	if fromID == "" || toID == "" {
 		log.Info("need fromid or toid.")
-		resp.Status = RESP_STATUS_ERROR
-		resp.Result = emp
-		self.Response(w, resp)
+		self.ResponseError(w, r, RESP_STATUS_ERROR, info.CODE_NOT_ENOUGH_ARGUMENTS)
 		return
 	}
 
@@ -117,6 +113,8 @@ func (self *handle) P2PHistory(w http.ResponseWriter, r *http.Request) {
 				Content:  result[i].Content,
 				Time:     result[i].Time,
 				UUID:     result[i].UUID,
+				Seq:      result[i].Seq,
+				MsTime:   result[i].MsTime,
 			})
 		}
 		mrt.Data = data
@@ -157,9 +155,7 @@ func (self *handle) TopicHistory(w http.ResponseWriter, r *http.Request) {
 		endTime, err = strconv.ParseInt(self.GetParam(r, "endTime"), 10, 64)
 		if err != nil {
 			log.Error(err.Error())
-			resp.Status = RESP_STATUS_ERROR
-			resp.Result = emp
-			self.Response(w, resp)
+			self.ResponseError(w, r, RESP_STATUS_ERROR, info.CODE_INVALID_ARGUMENTS)
 			return
 		}
 	} else {
@@ -169,9 +165,7 @@ func (self *handle) TopicHistory(w http.ResponseWriter, r *http.Request) {
 		n, err = strconv.Atoi(self.GetParam(r, "msgNum"))
 		if err != nil {
 			log.Info("msgNum: ", err)
-			resp.Status = RESP_STATUS_ERROR
-			resp.Result = emp
-			self.Response(w, resp)
+			self.ResponseError(w, r, RESP_STATUS_ERROR, info.CODE_INVALID_ARGUMENTS)
 			return
 		}
 	} else {
@@ -180,9 +174,7 @@ func (self *handle) TopicHistory(w http.ResponseWriter, r *http.Request) {
 
 	if fromID == "" || TopicID == "" {
 		log.Info("need fromid or toid.")
-		resp.Status = RESP_STATUS_ERROR
-		resp.Result = emp
-		self.Response(w, resp)
+		self.ResponseError(w, r, RESP_STATUS_ERROR, info.CODE_NOT_ENOUGH_ARGUMENTS)
 		return
 	}
 
@@ -205,6 +197,8 @@ func (self *handle) TopicHistory(w http.ResponseWriter, r *http.Request) {
 				Content: result[i].Content,
 				Time:    result[i].Time,
 				UUID:    result[i].UUID,
+				Seq:     result[i].Seq,
+				MsTime:  result[i].MsTime,
 			})
 		}
 		mrt.Data = data
@@ -227,7 +221,6 @@ func (self *handle) ViewFriend(w http.ResponseWriter, r *http.Request) {
 		err  error
 		cid  string
 		resp BaseResultTemple
-		emp  EmptyTemple
 		frt  FriendAliveResultTemple
 	)
 	if self.GetParam(r, "cid") != "" {
@@ -237,9 +230,7 @@ func (self *handle) ViewFriend(w http.ResponseWriter, r *http.Request) {
 	clientInfo, err := self.Db.GetClientFromId(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, cid)
 	if err != nil {
 		log.Error(err.Error())
-		resp.Status = RESP_STATUS_ERROR
-		resp.Result = emp
-		self.Response(w, resp)
+		self.ResponseError(w, r, RESP_STATUS_ERROR, info.CODE_NO_CLIENT_INFO)
 		return
 	}
 
@@ -249,9 +240,7 @@ func (self *handle) ViewFriend(w http.ResponseWriter, r *http.Request) {
 			clientInfo, err = self.Db.GetClientFromId(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, value)
 			if err != nil {
 				log.Error(err.Error())
-				resp.Status = RESP_STATUS_ERROR
-				resp.Result = emp
-				self.Response(w, resp)
+				self.ResponseError(w, r, RESP_STATUS_ERROR, info.CODE_DATABASE_ERROR)
 				return
 			}
 			// tmpSingle := make(map[string]bool)
@@ -281,7 +270,6 @@ func (self *handle) AddFriend(w http.ResponseWriter, r *http.Request) {
 		cid      string
 		friendId string
 		resp     BaseResultTemple
-		emp      EmptyTemple
 	)
 	if self.GetParam(r, "cid") != "" {
 		cid = self.GetParam(r, "cid")
@@ -294,9 +282,7 @@ func (self *handle) AddFriend(w http.ResponseWriter, r *http.Request) {
 	clientInfo, err := self.Db.GetClientFromId(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, cid)
 	if err != nil {
 		log.Error(err.Error())
-		resp.Status = RESP_STATUS_ERROR
-		resp.Result = emp
-		self.Response(w, resp)
+		self.ResponseError(w, r, RESP_STATUS_ERROR, info.CODE_NO_CLIENT_INFO)
 		return
 	}
 
@@ -305,15 +291,11 @@ func (self *handle) AddFriend(w http.ResponseWriter, r *http.Request) {
 		notFound := errors.New("not found")
 		if err.Error() == notFound.Error() {
 			log.Error(err.Error())
-			resp.Status = RESP_STATUS_ERROR
-			resp.Result = emp
-			self.Response(w, resp)
+			self.ResponseError(w, r, RESP_STATUS_ERROR, info.CODE_THIS_ID_IS_NOT_EXISTS)
 			return
 		} else {
 			log.Error(err.Error())
-			resp.Status = RESP_STATUS_ERROR
-			resp.Result = emp
-			self.Response(w, resp)
+			self.ResponseError(w, r, RESP_STATUS_ERROR, info.CODE_DATABASE_ERROR)
 			return
 		}
 	}
@@ -329,9 +311,7 @@ func (self *handle) AddFriend(w http.ResponseWriter, r *http.Request) {
 	err = self.Db.UpdateFriendsFromId(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, cid, append(friends, friendId))
 	if err != nil {
 		log.Error(err.Error())
-		resp.Status = RESP_STATUS_ERROR
-		resp.Result = emp
-		self.Response(w, resp)
+		self.ResponseError(w, r, RESP_STATUS_ERROR, info.CODE_DATABASE_ERROR)
 		return
 	}
 
@@ -359,18 +339,14 @@ func (self *handle) Register(w http.ResponseWriter, r *http.Request) {
 
 	if clientId == "" {
 		log.Error("need clientId.")
-		resp.Status = RESP_STATUS_ERROR
-		resp.Result = emp
-		self.Response(w, resp)
+		self.ResponseError(w, r, RESP_STATUS_ERROR, info.CODE_NOT_ENOUGH_ARGUMENTS)
 		return
 	}
 
 	//查找用户信息
 	clientInfo, err := self.Db.GetClientFromId(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, clientId)
 	if clientInfo != nil {
-		resp.Status = RESP_STATUS_REPEAT_REGISTRATION
-		resp.Result = emp
-		self.Response(w, resp)
+		self.ResponseError(w, r, RESP_STATUS_REPEAT_REGISTRATION, info.CODE_REPEAT_REGISTRATION)
 		return
 	}
 
@@ -381,9 +357,7 @@ func (self *handle) Register(w http.ResponseWriter, r *http.Request) {
 	err = self.Db.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, &sessionStoreData)
 	if err != nil {
 		log.Error(err.Error())
-		resp.Status = RESP_STATUS_ERROR
-		resp.Result = emp
-		self.Response(w, resp)
+		self.ResponseError(w, r, RESP_STATUS_ERROR, info.CODE_DATABASE_ERROR)
 		return
 	}
 	resp.Status = RESP_STATUS_SUCCESS
@@ -403,6 +377,29 @@ func (self *handle) GetParam(r *http.Request, param string) string {
 	return ""
 }
 
+//请求的语言, 取locale参数, 没有时取Accept-Language的第一个
+func (self *handle) GetLocale(r *http.Request) string {
+	if locale := self.GetParam(r, "locale"); locale != "" {
+		return info.Locale(locale)
+	}
+	locale := r.Header.Get("Accept-Language")
+	if i := strings.IndexAny(locale, ",;"); i >= 0 {
+		locale = locale[:i]
+	}
+	return info.Locale(locale)
+}
+
+//返回错误, status兼容旧的客户端, code和msg见info包的CODE_*
+func (self *handle) ResponseError(w http.ResponseWriter, r *http.Request, status string, code int) error {
+	resp := BaseResultTemple{
+		Status: status,
+		Code:   code,
+		Msg:    info.Message(self.GetLocale(r), code),
+		Result: EmptyTemple{},
+	}
+	return self.Response(w, resp)
+}
+
 func (self *handle) Response(w http.ResponseWriter, resp BaseResultTemple) error {
 	temp, err := json.Marshal(resp)
 	if err != nil {
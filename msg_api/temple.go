@@ -3,9 +3,11 @@ package main
 type EmptyTemple struct {
 }
 
-//基础返回
+//基础返回, code和msg为错误码和提示信息, 见info包的CODE_*, 0为成功
 type BaseResultTemple struct {
 	Status string      `json:"status"`
+	Code   int         `json:"code"`
+	Msg    string      `json:"msg"`
 	Result interface{} `json:"result"`
 }
 
@@ -25,6 +27,8 @@ type P2PMsgTemple struct {
 	Content  string `json:"content"`
 	Time     int64  `json:"time"`
 	UUID     string `json:"uuid"`
+	Seq      int64  `json:"seq"`
+	MsTime   int64  `json:"msTime"`
 }
 
 //topic 消息返回格式
@@ -35,6 +39,8 @@ type TopicMsgTemple struct {
 	Content string `json:"content"`
 	Time    int64  `json:"time"`
 	UUID    string `json:"uuid"`
+	Seq     int64  `json:"seq"`
+	MsTime  int64  `json:"msTime"`
 }
 
 //friend
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"goProject/storage/mongo_store"
+	"sync"
+	"time"
+)
+
+//客户端超时重发的消息按发送者和客户端消息ID去重, 窗口时间内返回第一次的服务器消息ID和时间.
+//正在处理的消息记在内存中, 已保存的消息也从mongodb中查, 重发到其他msg_server时一样去重
+type MsgDedupe struct {
+	window    time.Duration
+	mutex     sync.Mutex
+	entries   map[string]*sentMessage
+	lastSweep time.Time
+}
+
+//已发送消息在服务器上的ID、时间和会话序号
+type sentMessage struct {
+	UUID   string
+	Time   int64
+	Seq    int64
+	MsTime int64
+	expire time.Time
+}
+
+func NewMsgDedupe(window time.Duration) *MsgDedupe {
+	if window <= 0 {
+		window = DEFAULT_MESSAGE_DEDUPE_WINDOW
+	}
+	return &MsgDedupe{
+		window:    window,
+		entries:   make(map[string]*sentMessage),
+		lastSweep: time.Now(),
+	}
+}
+
+//登记将要保存的消息, 窗口内已有同一消息时返回已有的, ok为true
+func (self *MsgDedupe) claim(key string, sent sentMessage) (*sentMessage, bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(self.lastSweep) > self.window {
+		for k, v := range self.entries {
+			if now.After(v.expire) {
+				delete(self.entries, k)
+			}
+		}
+		self.lastSweep = now
+	}
+
+	if entry, ok := self.entries[key]; ok && now.Before(entry.expire) {
+		copied := *entry
+		return &copied, true
+	}
+	sent.expire = now.Add(self.window)
+	self.entries[key] = &sent
+	return nil, false
+}
+
+//消息保存后更新登记的消息, uuid不同时说明已被替换
+func (self *MsgDedupe) save(key string, uuid string, sent sentMessage) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if entry, ok := self.entries[key]; ok && entry.UUID == uuid {
+		sent.expire = entry.expire
+		*entry = sent
+	}
+}
+
+//消息没有保存成功, 允许客户端重发
+func (self *MsgDedupe) release(key string) {
+	self.mutex.Lock()
+	delete(self.entries, key)
+	self.mutex.Unlock()
+}
+
+func dedupeKey(collection string, fromID string, clientMsgID string) string {
+	return collection + "/" + fromID + "/" + clientMsgID
+}
+
+//查找重发的消息, 是新消息时登记, 之后保存成功要调用save, 失败要调用release
+func (self *ProtoProc) findSentMessage(collection string, fromID string, clientMsgID string, sent sentMessage) (*sentMessage, bool) {
+	dedupe := self.msgServer.msgDedupe
+	key := dedupeKey(collection, fromID, clientMsgID)
+	if found, ok := dedupe.claim(key, sent); ok {
+		return found, true
+	}
+
+	//其他msg_server或重启前保存的
+	since := time.Now().Add(-dedupe.window).Unix()
+	var found *sentMessage
+	switch collection {
+	case mongo_store.RECORD_P2P_MESSAGE_COLLECTION:
+		if data := self.msgServer.mongoStore.ReadP2PRecordMessageFromClientMsgID(mongo_store.DATA_BASE_NAME,
+			collection, fromID, clientMsgID, since); data != nil {
+			found = &sentMessage{UUID: data.UUID, Time: data.Time, Seq: data.Seq, MsTime: data.MsTime}
+		}
+	case mongo_store.RECORD_TOPIC_MESSAGE_COLLECTION:
+		if data := self.msgServer.mongoStore.ReadTopicRecordMessageFromClientMsgID(mongo_store.DATA_BASE_NAME,
+			collection, fromID, clientMsgID, since); data != nil {
+			found = &sentMessage{UUID: data.UUID, Time: data.Time, Seq: data.Seq, MsTime: data.MsTime}
+		}
+	}
+	if found == nil {
+		return nil, false
+	}
+
+	//以后的重发直接从内存返回
+	dedupe.save(key, sent.UUID, *found)
+	return found, true
+}
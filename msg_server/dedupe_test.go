@@ -0,0 +1,77 @@
+package main
+
+import (
+	"goProject/storage/mongo_store"
+	"testing"
+	"time"
+
+	"github.com/funny/unitest"
+)
+
+func Test_MsgDedupe_Claim(t *testing.T) {
+	dedupe := NewMsgDedupe(time.Minute)
+	key := dedupeKey(mongo_store.RECORD_P2P_MESSAGE_COLLECTION, "aa", "c1")
+
+	found, ok := dedupe.claim(key, sentMessage{UUID: "u1", Time: 1})
+	unitest.Pass(t, !ok && found == nil)
+
+	//重发时返回第一次的
+	found, ok = dedupe.claim(key, sentMessage{UUID: "u2", Time: 2})
+	unitest.Pass(t, ok && found.UUID == "u1" && found.Time == 1)
+
+	//不同发送者或集合的同一客户端消息ID不算重复
+	_, ok = dedupe.claim(dedupeKey(mongo_store.RECORD_P2P_MESSAGE_COLLECTION, "bb", "c1"), sentMessage{UUID: "u3"})
+	unitest.Pass(t, !ok)
+	_, ok = dedupe.claim(dedupeKey(mongo_store.RECORD_TOPIC_MESSAGE_COLLECTION, "aa", "c1"), sentMessage{UUID: "u4"})
+	unitest.Pass(t, !ok)
+}
+
+func Test_MsgDedupe_Save(t *testing.T) {
+	dedupe := NewMsgDedupe(time.Minute)
+	key := dedupeKey(mongo_store.RECORD_P2P_MESSAGE_COLLECTION, "aa", "c1")
+
+	dedupe.claim(key, sentMessage{UUID: "u1", Time: 1})
+	dedupe.save(key, "u1", sentMessage{UUID: "u1", Time: 1, Seq: 5, MsTime: 1001})
+	found, ok := dedupe.claim(key, sentMessage{UUID: "u2"})
+	unitest.Pass(t, ok && found.Seq == 5 && found.MsTime == 1001)
+
+	//返回的是副本
+	found.Seq = 6
+	found, _ = dedupe.claim(key, sentMessage{UUID: "u2"})
+	unitest.Pass(t, found.Seq == 5)
+
+	//登记已被替换时不更新
+	dedupe.save(key, "other", sentMessage{UUID: "other", Seq: 7})
+	found, _ = dedupe.claim(key, sentMessage{UUID: "u2"})
+	unitest.Pass(t, found.UUID == "u1" && found.Seq == 5)
+}
+
+func Test_MsgDedupe_Release(t *testing.T) {
+	dedupe := NewMsgDedupe(time.Minute)
+	key := dedupeKey(mongo_store.RECORD_P2P_MESSAGE_COLLECTION, "aa", "c1")
+
+	dedupe.claim(key, sentMessage{UUID: "u1"})
+	dedupe.release(key)
+
+	//没保存成功的消息可以重发
+	found, ok := dedupe.claim(key, sentMessage{UUID: "u2"})
+	unitest.Pass(t, !ok && found == nil)
+	found, ok = dedupe.claim(key, sentMessage{UUID: "u3"})
+	unitest.Pass(t, ok && found.UUID == "u2")
+}
+
+func Test_MsgDedupe_Window(t *testing.T) {
+	dedupe := NewMsgDedupe(50 * time.Millisecond)
+	key := dedupeKey(mongo_store.RECORD_P2P_MESSAGE_COLLECTION, "aa", "c1")
+
+	dedupe.claim(key, sentMessage{UUID: "u1"})
+	dedupe.claim(dedupeKey(mongo_store.RECORD_P2P_MESSAGE_COLLECTION, "aa", "c2"), sentMessage{UUID: "u2"})
+	time.Sleep(100 * time.Millisecond)
+
+	//超过窗口的不再去重, 过期的登记被清除
+	_, ok := dedupe.claim(key, sentMessage{UUID: "u3"})
+	unitest.Pass(t, !ok)
+	unitest.Pass(t, len(dedupe.entries) == 1)
+
+	unitest.Pass(t, NewMsgDedupe(0).window == DEFAULT_MESSAGE_DEDUPE_WINDOW)
+}
@@ -19,7 +19,7 @@ func (self *ProtoProc) procViewFriends(cmd protocol.Cmd, session *libnet.Session
 	var err error
 
 	if session.State == nil {
-		self.respCmd(protocol.RESP_VIEW_FRIENDS_CMD, session, cmd.GetReport(), false, info.YOU_HAVE_NOT_LANDED)
+		self.respCmd(protocol.RESP_VIEW_FRIENDS_CMD, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
 		return nil
 	}
 	clientId := session.State.(*base.SessionState).ClientID
@@ -33,7 +33,7 @@ func (self *ProtoProc) procViewFriends(cmd protocol.Cmd, session *libnet.Session
 	clientInfo, err := self.msgServer.mongoStore.GetClientFromId(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, clientId)
 	if err != nil {
 		log.Error(err.Error())
-		self.respCmd(protocol.RESP_VIEW_FRIENDS_CMD, session, cmd.GetReport(), false, info.ERROR)
+		self.respCmd(protocol.RESP_VIEW_FRIENDS_CMD, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 		return err
 	}
 
@@ -48,15 +48,14 @@ func (self *ProtoProc) procViewFriends(cmd protocol.Cmd, session *libnet.Session
 	temp, err := json.Marshal(result)
 	if err != nil {
 		log.Error(err.Error())
-		resp.Message = info.YOU_HAVE_NO_FRIENDS
-		resp.Ok = true
+		setCode(resp, session, info.CODE_YOU_HAVE_NO_FRIENDS)
 	} else {
 		resp.AddArg(string(temp))
 		if self.msgServer.sessions[clientId] != nil {
 			err = self.msgServer.sessions[clientId].Send(resp)
 			if err != nil {
 				log.Error(err.Error())
-				self.respCmd(protocol.RESP_VIEW_FRIENDS_CMD, session, cmd.GetReport(), false, info.ERROR)
+				self.respCmd(protocol.RESP_VIEW_FRIENDS_CMD, session, cmd.GetReport(), info.CODE_SEND_MESSAGE_ERROR)
 				return err
 			}
 		}
@@ -76,27 +75,26 @@ func (self *ProtoProc) procAddFriend(cmd protocol.Cmd, session *libnet.Session)
 	log.Info("procAddFriend")
 	var err error
 	if session.State == nil {
-		self.respCmd(protocol.RESP_ADD_FRIEND_CMD, session, cmd.GetReport(), false, info.YOU_HAVE_NOT_LANDED)
+		self.respCmd(protocol.RESP_ADD_FRIEND_CMD, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
 		return nil
 	}
-	if len(cmd.GetArgs()) < protocol.SEND_ADD_FRIEND_CMD_ARGS_NUM {
-		log.Info(info.NOT_ENOUGH_ARGUMENTS)
-		self.respCmd(protocol.RESP_ADD_FRIEND_CMD, session, cmd.GetReport(), false, info.NOT_ENOUGH_ARGUMENTS)
+	req, ok := self.payload(cmd, session, protocol.RESP_ADD_FRIEND_CMD).(*protocol.FriendData)
+	if !ok {
 		return nil
 	}
 
 	clientId := session.State.(*base.SessionState).ClientID
-	friendId := cmd.GetArgs()[0]
+	friendId := req.FriendID
 
 	clientInfo, err := self.msgServer.mongoStore.GetClientFromId(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, clientId)
 	if err != nil {
 		log.Error(err.Error())
-		self.respCmd(protocol.RESP_ADD_FRIEND_CMD, session, cmd.GetReport(), false, info.NO_CLIENT_INFO)
+		self.respCmd(protocol.RESP_ADD_FRIEND_CMD, session, cmd.GetReport(), info.CODE_NO_CLIENT_INFO)
 	}
 	friends := clientInfo.Friends
 	if common.InArray(friends, friendId) {
 		log.Error(info.THE_ID_IS_ALREADY_YOUR_FRIEND)
-		self.respCmd(protocol.RESP_ADD_FRIEND_CMD, session, cmd.GetReport(), false, info.THE_ID_IS_ALREADY_YOUR_FRIEND)
+		self.respCmd(protocol.RESP_ADD_FRIEND_CMD, session, cmd.GetReport(), info.CODE_THE_ID_IS_ALREADY_YOUR_FRIEND)
 		return err
 	}
 
@@ -105,22 +103,22 @@ func (self *ProtoProc) procAddFriend(cmd protocol.Cmd, session *libnet.Session)
 		notFound := errors.New("not found")
 		if err.Error() == notFound.Error() {
 			log.Error(err.Error())
-			self.respCmd(protocol.RESP_ADD_FRIEND_CMD, session, cmd.GetReport(), false, info.THIS_ID_IS_NOT_EXISTS)
+			self.respCmd(protocol.RESP_ADD_FRIEND_CMD, session, cmd.GetReport(), info.CODE_THIS_ID_IS_NOT_EXISTS)
 			return err
 		} else {
 			log.Error(err.Error())
-			self.respCmd(protocol.RESP_ADD_FRIEND_CMD, session, cmd.GetReport(), false, info.ERROR)
+			self.respCmd(protocol.RESP_ADD_FRIEND_CMD, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 			return err
 		}
 	}
 	err = self.msgServer.mongoStore.UpdateFriendsFromId(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, clientId, append(friends, friendId))
 	if err != nil {
 		log.Error(err.Error())
-		self.respCmd(protocol.RESP_ADD_FRIEND_CMD, session, cmd.GetReport(), false, info.ERROR)
+		self.respCmd(protocol.RESP_ADD_FRIEND_CMD, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 		return err
 	}
 
-	self.respCmd(protocol.RESP_ADD_FRIEND_CMD, session, cmd.GetReport(), true, "")
+	self.respCmd(protocol.RESP_ADD_FRIEND_CMD, session, cmd.GetReport(), info.CODE_OK)
 	return err
 }
 
@@ -130,37 +128,36 @@ func (self *ProtoProc) procDelFriend(cmd protocol.Cmd, session *libnet.Session)
 	var err error
 
 	if session.State == nil {
-		self.respCmd(protocol.RESP_DEL_FRIEND_CMD, session, cmd.GetReport(), false, info.YOU_HAVE_NOT_LANDED)
+		self.respCmd(protocol.RESP_DEL_FRIEND_CMD, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
 		return nil
 	}
-	if len(cmd.GetArgs()) < protocol.SEND_DEL_FRIEND_CMD_ARGS_NUM {
-		log.Info(info.NOT_ENOUGH_ARGUMENTS)
-		self.respCmd(protocol.RESP_DEL_FRIEND_CMD, session, cmd.GetReport(), false, info.NOT_ENOUGH_ARGUMENTS)
+	req, ok := self.payload(cmd, session, protocol.RESP_DEL_FRIEND_CMD).(*protocol.FriendData)
+	if !ok {
 		return nil
 	}
 
 	clientId := session.State.(*base.SessionState).ClientID
-	friendId := cmd.GetArgs()[0]
+	friendId := req.FriendID
 
 	clientInfo, err := self.msgServer.mongoStore.GetClientFromId(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, clientId)
 	if err != nil {
 		log.Error(err.Error())
-		self.respCmd(protocol.RESP_DEL_FRIEND_CMD, session, cmd.GetReport(), false, info.NO_CLIENT_INFO)
+		self.respCmd(protocol.RESP_DEL_FRIEND_CMD, session, cmd.GetReport(), info.CODE_NO_CLIENT_INFO)
 		return err
 	}
 	friends := clientInfo.Friends
 	if !common.InArray(friends, friendId) {
-		self.respCmd(protocol.RESP_DEL_FRIEND_CMD, session, cmd.GetReport(), false, info.YOU_HAVE_NO_THIS_FRIEND)
+		self.respCmd(protocol.RESP_DEL_FRIEND_CMD, session, cmd.GetReport(), info.CODE_YOU_HAVE_NO_THIS_FRIEND)
 		return err
 	}
 	friends = common.DeleteChild(friends, friendId)
 	err = self.msgServer.mongoStore.UpdateFriendsFromId(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, clientId, friends)
 	if err != nil {
 		log.Error(err.Error())
-		self.respCmd(protocol.RESP_DEL_FRIEND_CMD, session, cmd.GetReport(), false, info.ERROR)
+		self.respCmd(protocol.RESP_DEL_FRIEND_CMD, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 		return err
 	}
 
-	self.respCmd(protocol.RESP_DEL_FRIEND_CMD, session, cmd.GetReport(), true, "")
+	self.respCmd(protocol.RESP_DEL_FRIEND_CMD, session, cmd.GetReport(), info.CODE_OK)
 	return nil
 }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"goProject/libnet"
+	"goProject/log"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+type serverMetrics struct {
+	SessionNum uint64                    `json:"session_num"`
+	Traffic    libnet.Metrics            `json:"traffic"`
+	SendStats  libnet.SendPolicyStats    `json:"send_stats"`
+	Channels   map[string]libnet.Metrics `json:"channels"`
+}
+
+//按连接排序的字段
+var sessionMetricsKeys = map[string]func(libnet.SessionMetrics) uint64{
+	"msg_in":     func(m libnet.SessionMetrics) uint64 { return m.Traffic.MsgIn },
+	"msg_out":    func(m libnet.SessionMetrics) uint64 { return m.Traffic.MsgOut },
+	"bytes_in":   func(m libnet.SessionMetrics) uint64 { return m.Traffic.BytesIn },
+	"bytes_out":  func(m libnet.SessionMetrics) uint64 { return m.Traffic.BytesOut },
+	"send_queue": func(m libnet.SessionMetrics) uint64 { return uint64(m.SendQueue) },
+}
+
+//流量统计的HTTP接口, /metrics返回本服务器和各channel的汇总,
+//按字段排序的连接用/metrics/sessions?by=msg_in&top=20, 默认msg_in前20个
+func (self *MsgServer) startMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", self.serveMetrics)
+	mux.HandleFunc("/metrics/sessions", self.serveSessionMetrics)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Error(err.Error())
+		}
+	}()
+}
+
+func (self *MsgServer) serveMetrics(res http.ResponseWriter, req *http.Request) {
+	metrics := serverMetrics{
+		SessionNum: (uint64)(self.sessionNum()),
+		Traffic:    self.metrics(),
+		SendStats:  libnet.GlobalSendStats(),
+		Channels:   make(map[string]libnet.Metrics),
+	}
+	for name, c := range self.channels {
+		metrics.Channels[name] = c.Channel.Metrics()
+	}
+	writeJson(res, metrics)
+}
+
+func (self *MsgServer) serveSessionMetrics(res http.ResponseWriter, req *http.Request) {
+	by := req.FormValue("by")
+	if by == "" {
+		by = "msg_in"
+	}
+	key, ok := sessionMetricsKeys[by]
+	if !ok {
+		http.Error(res, "unknown by "+by, http.StatusBadRequest)
+		return
+	}
+	top, err := strconv.Atoi(req.FormValue("top"))
+	if err != nil {
+		top = 20
+	}
+	var list []libnet.SessionMetrics
+	for _, server := range self.servers {
+		list = append(list, server.TopSessions(top, key)...)
+	}
+	sort.Slice(list, func(i, j int) bool { return key(list[i]) > key(list[j]) })
+	if top > 0 && top < len(list) {
+		list = list[:top]
+	}
+	writeJson(res, list)
+}
+
+//所有监听地址的连接合计
+func (self *MsgServer) metrics() libnet.Metrics {
+	var metrics libnet.Metrics
+	for _, server := range self.servers {
+		metrics.Add(server.Metrics())
+	}
+	return metrics
+}
+
+func writeJson(res http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Error(err.Error())
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.Write(data)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
 	//"time"
 	"flag"
@@ -8,10 +9,14 @@ import (
 	//"goProject/base"
 	"goProject/libnet"
 	"goProject/protocol"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime/pprof"
+	"sync"
 	"syscall"
+	"time"
 )
 
 /*
@@ -57,11 +62,105 @@ func handleSession(ms *MsgServer, session *libnet.Session) {
 			break
 		}
 
+		ms.handlerWait.Add(1)
 		err := ms.parseProtocol(msg, session)
+		ms.handlerWait.Done()
 		if err != nil {
 			log.Error(err.Error())
 		}
 	}
+
+	ms.closeSession(session)
+}
+
+func acceptSessions(ms *MsgServer, server *libnet.Server) {
+	for {
+		session, err := server.Accept()
+		if err != nil {
+			break
+		}
+
+		session.SetIdleTimeout(ms.cfg.ReadIdleTimeout*time.Second, ms.cfg.WriteIdleTimeout*time.Second, ms.sessionIdle)
+		go handleSession(ms, session)
+	}
+}
+
+func newCodecType(cfg *ListenerConfig) libnet.CodecType {
+	codecType := libnet.JsonOrMsgPack()
+	//大于阈值的包压缩发送,只对发过压缩包的客户端生效.
+	//压缩要在Packet里面用,WebSocket一个消息一个包,不压缩
+	if cfg.CompressThreshold > 0 && !cfg.WebSocket.Enable {
+		codecType = libnet.Compress(codecType, cfg.CompressThreshold)
+	}
+	return codecType
+}
+
+func listen(cfg *ListenerConfig) (net.Listener, error) {
+	//本机工具用的unix socket,上次没删掉的文件会导致监听失败
+	if cfg.TransportProtocols == "unix" {
+		os.Remove(cfg.Listen)
+	}
+	listener, err := net.Listen(cfg.TransportProtocols, cfg.Listen)
+	if err != nil {
+		return nil, err
+	}
+
+	//在负载均衡后面时从PROXY协议头取客户端真实地址,要在TLS之前
+	if cfg.ProxyProtocol.Enable {
+		listener = libnet.NewProxyListener(listener, cfg.ProxyProtocol.Timeout*time.Second)
+	}
+
+	if cfg.TLS.Enable {
+		tlsConfig, err := cfg.TLS.ServerConfig()
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	return listener, nil
+}
+
+//每个监听地址一个server,用各自的编码设置,State保存它的ListenerConfig
+func serve(cfg *ListenerConfig) (*libnet.Server, error) {
+	listener, err := listen(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var server *libnet.Server
+	if cfg.WebSocket.Enable {
+		if cfg.CompressThreshold > 0 {
+			log.Warning("CompressThreshold is ignored on WebSocket listener ", cfg.Listen)
+		}
+		server = libnet.NewServer(libnet.NewWebSocketListener(listener, webSocketConfig(cfg)), libnet.WebSocketMessage(newCodecType(cfg)))
+	} else {
+		//超过MaxPacketSize的包断开连接,压缩的包按解压后的大小算,0不限制
+		server = libnet.NewServer(listener, libnet.PacketLimit(libnet.Uint16BE, cfg.MaxPacketSize, newCodecType(cfg)))
+	}
+	server.State = cfg
+	return server, nil
+}
+
+//浏览器客户端用WebSocket接入,一个WebSocket消息一个包,其他和TCP相同
+func webSocketConfig(cfg *ListenerConfig) libnet.WebSocketConfig {
+	wsConfig := libnet.WebSocketConfig{
+		Path:           cfg.WebSocket.Path,
+		MaxMessageSize: int64(cfg.MaxPacketSize),
+	}
+	//不配置Origins时只允许同源的页面
+	if origins := cfg.WebSocket.Origins; len(origins) > 0 {
+		wsConfig.CheckOrigin = func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			for _, v := range origins {
+				if v == "*" || v == origin {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return wsConfig
 }
 
 func main() {
@@ -84,41 +183,63 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	ms := NewMsgServer(cfg)
+	ms.Init()
+
+	//超过连接数或接入速率时拒绝新连接,gateway不再分配用户到本服务器,所有监听地址一起计算
+	admission := libnet.NewAdmission(cfg.Admission, ms.rejectSession)
+	listeners := cfg.listeners()
+	for i := range listeners {
+		server, err := serve(&listeners[i])
+		if err != nil {
+			panic(err)
+		}
+		//没有PROXY协议时负载均衡后面的用户都是同一个IP
+		if cfg.Admission.MaxPerIP > 0 && !listeners[i].ProxyProtocol.Enable {
+			log.Warning("Admission.MaxPerIP applies to the load balancer address on ", listeners[i].Listen, " without ProxyProtocol")
+		}
+		server.UseAdmission(admission)
+		log.Info("msg_server running at  ", server.Listener().Addr().String())
+		ms.servers = append(ms.servers, server)
+	}
+
+	//流量统计的HTTP接口,不配置不开启
+	if cfg.MetricsListen != "" {
+		ms.startMetrics(cfg.MetricsListen)
+	}
+
+	//第一次信号排空后退出,第二次直接退出
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	signal.Notify(c, syscall.SIGTERM)
 	go func() {
+		<-c
+		log.Info("Ctrl+C to drain and quit.")
+		go ms.drain()
 		<-c
 		log.Info("Ctrl+C to quit.")
 		pprof.StopCPUProfile()
 		os.Exit(1)
 	}()
 
-	ms := NewMsgServer(cfg)
-	ms.Init()
-
-	ms.server, err = libnet.Serve(cfg.TransportProtocols, cfg.Listen, libnet.Packet(libnet.Uint16BE, libnet.Json()))
-	if err != nil {
-		panic(err)
-	}
-	log.Info("msg_server running at  ", ms.server.Listener().Addr().String())
-
 	ms.createChannels()
 
-	go ms.scanDeadSession()
-
 	go ms.sendMonitorData()
 
 	go ms.sendServiceDiscoveryData()
 
 	go ms.scanTimeoutAck()
 
-	for {
-		session, err := ms.server.Accept()
-		if err != nil {
-			break
-		}
-
-		go handleSession(ms, session)
+	//所有监听地址的连接共用sessions和处理函数
+	var acceptWait sync.WaitGroup
+	for _, server := range ms.servers {
+		acceptWait.Add(1)
+		go func(server *libnet.Server) {
+			defer acceptWait.Done()
+			acceptSessions(ms, server)
+		}(server)
 	}
+	acceptWait.Wait()
+
+	ms.waitDrain()
 }
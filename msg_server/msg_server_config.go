@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"goProject/libnet"
 	"goProject/log"
 	"os"
 	"time"
@@ -13,14 +14,32 @@ type MsgServerConfig struct {
 	PublicIP                 string
 	TransportProtocols       string
 	Listen                   string
+	Listeners                []ListenerConfig
+	MetricsListen            string
+	TLS                      libnet.TLSConfig
+	ProxyProtocol            ProxyProtocolConfig
+	WebSocket                WebSocketConfig
+	CompressThreshold        int
+	MaxPacketSize            int
+	Admission                libnet.AdmissionLimit
+	CommandRates             map[string]int
 	LogFile                  string
 	EtcdServer               string
 	ScanDeadSessionTimeout   time.Duration
+	ReadIdleTimeout          time.Duration
+	WriteIdleTimeout         time.Duration
 	ScanTimeoutAck           time.Duration
 	Expire                   time.Duration
 	MonitorBeatTime          time.Duration
+	DrainTimeout             time.Duration
+	MessageDedupeWindow      time.Duration
 	SessionManagerServerList []string
-	Redis                    struct {
+	AsyncSend                struct {
+		QueueSize    int
+		Policy       string
+		BlockTimeout time.Duration
+	}
+	Redis struct {
 		Addr           string
 		Port           string
 		ConnectTimeout time.Duration
@@ -39,6 +58,30 @@ type MsgServerConfig struct {
 	PushUrl           string
 }
 
+//一个监听地址和它的编码设置
+type ListenerConfig struct {
+	TransportProtocols string
+	Listen             string
+	TLS                libnet.TLSConfig
+	ProxyProtocol      ProxyProtocolConfig
+	WebSocket          WebSocketConfig
+	CompressThreshold  int
+	MaxPacketSize      int
+}
+
+type ProxyProtocolConfig struct {
+	Enable  bool
+	Timeout time.Duration
+}
+
+//Listeners中的WebSocket不用Listen,监听ListenerConfig.Listen
+type WebSocketConfig struct {
+	Enable  bool
+	Listen  string
+	Path    string
+	Origins []string
+}
+
 func NewMsgServerConfig(configfile string) *MsgServerConfig {
 	return &MsgServerConfig{
 		configfile: configfile,
@@ -61,6 +104,40 @@ func (self *MsgServerConfig) LoadConfig() error {
 	return nil
 }
 
+//没配置Listeners时用TransportProtocols和Listen等旧配置,开启WebSocket时再加一个
+func (self *MsgServerConfig) listeners() []ListenerConfig {
+	if len(self.Listeners) > 0 {
+		return self.Listeners
+	}
+	listener := ListenerConfig{
+		TransportProtocols: self.TransportProtocols,
+		Listen:             self.Listen,
+		TLS:                self.TLS,
+		ProxyProtocol:      self.ProxyProtocol,
+		CompressThreshold:  self.CompressThreshold,
+		MaxPacketSize:      self.MaxPacketSize,
+	}
+	listeners := []ListenerConfig{listener}
+	if self.WebSocket.Enable {
+		listener.TransportProtocols = "tcp"
+		listener.Listen = self.WebSocket.Listen
+		listener.WebSocket = self.WebSocket
+		listener.CompressThreshold = 0
+		listeners = append(listeners, listener)
+	}
+	return listeners
+}
+
+//session从哪个监听地址接入
+func listenerOf(session *libnet.Session) *ListenerConfig {
+	if server := session.Server(); server != nil {
+		if cfg, ok := server.State.(*ListenerConfig); ok {
+			return cfg
+		}
+	}
+	return new(ListenerConfig)
+}
+
 func (self *MsgServerConfig) DumpConfig() {
 	//fmt.Printf("Mode: %s\nListen: %s\nServer: %s\nLogfile: %s\n",
 	//cfg.Mode, cfg.Listen, cfg.Server, cfg.Logfile)
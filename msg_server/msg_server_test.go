@@ -0,0 +1,52 @@
+package main
+
+import (
+	"goProject/protocol"
+	"testing"
+
+	"github.com/funny/unitest"
+	"github.com/gorilla/websocket"
+)
+
+// The WebSocket listener of the shipped config serves browser clients.
+func Test_WebSocketListener(t *testing.T) {
+	cfg := NewMsgServerConfig("msg_server.19000.json")
+	unitest.NotError(t, cfg.LoadConfig())
+	unitest.Pass(t, cfg.CompressThreshold > 0)
+	cfg.WebSocket.Enable = true
+	cfg.WebSocket.Listen = "127.0.0.1:0"
+
+	listeners := cfg.listeners()
+	unitest.Pass(t, len(listeners) == 2)
+	wsConfig := listeners[1]
+	unitest.Pass(t, wsConfig.WebSocket.Enable)
+	unitest.Pass(t, wsConfig.CompressThreshold == 0)
+
+	//单独配置Listeners时也不压缩
+	wsConfig.CompressThreshold = 1024
+	server, err := serve(&wsConfig)
+	unitest.NotError(t, err)
+	defer server.Stop()
+
+	go func() {
+		session, err := server.Accept()
+		if err != nil {
+			return
+		}
+		var msg protocol.CmdSimple
+		if err := session.Receive(&msg); err != nil {
+			return
+		}
+		session.Send(protocol.NewCmdResponse(protocol.RESP_PONG_CMD))
+	}()
+
+	url := "ws://" + server.Listener().Addr().String() + cfg.WebSocket.Path
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	unitest.NotError(t, err)
+	defer ws.Close()
+
+	unitest.NotError(t, ws.WriteMessage(websocket.TextMessage, []byte(`{"cmd":"ping","obj":[]}`)))
+	_, data, err := ws.ReadMessage()
+	unitest.NotError(t, err)
+	unitest.Pass(t, len(data) > 0 && data[0] == '{')
+}
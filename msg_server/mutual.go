@@ -44,31 +44,34 @@ func (self *ProtoProc) procAsk(cmd protocol.Cmd, session *libnet.Session) error
 	var err error
 
 	if session.State == nil {
-		self.respCmd(protocol.RESP_ASK_CMD, session, cmd.GetReport(), false, info.YOU_HAVE_NOT_LANDED)
+		self.respCmd(protocol.RESP_ASK_CMD, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
 		return nil
 	}
-	if len(cmd.GetArgs()) < protocol.SEND_ASK_CMD_ARGS_NUM {
-		log.Info(info.NOT_ENOUGH_ARGUMENTS)
-		self.respCmd(protocol.RESP_ASK_CMD, session, cmd.GetReport(), false, info.NOT_ENOUGH_ARGUMENTS)
+	req, ok := self.payload(cmd, session, protocol.RESP_ASK_CMD).(*protocol.AskData)
+	if !ok {
 		return nil
 	}
 
 	clientId := session.State.(*base.SessionState).ClientID
-	msgType := cmd.GetArgs()[0]
-	friendId := cmd.GetArgs()[1]
+	msgType := req.Type
+	friendId := req.Target
 	send2Time := time.Now().Unix()
 	uuid := common.NewV4().String()
 
-	//保存消息到mongodb中
-	data := mongo_store.MutualRecordMessageData{clientId, friendId, msgType, send2Time, uuid, false}
-	err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_MUTUAL_MESSAGE_COLLECTION, &data)
+	//保存消息到mongodb中, 接收者的请求按序号同步
+	conversationID := mongo_store.AskConversationID(friendId)
+	seq, err := self.msgServer.mongoStore.NextSequence(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_SEQUENCE_COLLECTION, conversationID)
+	data := mongo_store.MutualRecordMessageData{clientId, friendId, msgType, send2Time, uuid, false, conversationID, seq}
+	if err == nil {
+		err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_MUTUAL_MESSAGE_COLLECTION, &data)
+	}
 	if err != nil {
 		log.Error("error:", err)
-		self.respCmd(protocol.RESP_ASK_CMD, session, cmd.GetReport(), false, info.ERROR)
+		self.respCmd(protocol.RESP_ASK_CMD, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 		return err
 	}
 
-	switch cmd.GetArgs()[0] {
+	switch req.Type {
 	case protocol.SEND_ASK_CMD_TYPE_ADD_FRIEND:
 		err = self.procAskAddFriend(cmd, session, data)
 		if err != nil {
@@ -80,7 +83,7 @@ func (self *ProtoProc) procAsk(cmd protocol.Cmd, session *libnet.Session) error
 	case protocol.SEND_ASK_CMD_TYPE_INVITE_TOPIC:
 	default:
 		log.Info(info.THE_ASK_TYPE_IS_UNDEFINED, cmd)
-		self.respCmd(protocol.RESP_ASK_CMD, session, cmd.GetReport(), false, info.THE_ASK_TYPE_IS_UNDEFINED)
+		self.respCmd(protocol.RESP_ASK_CMD, session, cmd.GetReport(), info.CODE_THE_ASK_TYPE_IS_UNDEFINED)
 		return err
 	}
 
@@ -96,13 +99,13 @@ func (self *ProtoProc) procAskAddFriend(cmd protocol.Cmd, session *libnet.Sessio
 		mongo_store.CLIENT_INFO_COLLECTION, data.FromID)
 	if err != nil {
 		log.Error("error:", err)
-		self.respCmd(protocol.RESP_ASK_CMD, session, cmd.GetReport(), false, info.ERROR)
+		self.respCmd(protocol.RESP_ASK_CMD, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 		return err
 	}
 
 	//检测是不是好友
 	if common.InArray(storeSession.Friends, data.ToID) {
-		self.respCmd(protocol.RESP_ASK_CMD, session, cmd.GetReport(), false, info.THE_ID_IS_ALREADY_YOUR_FRIEND)
+		self.respCmd(protocol.RESP_ASK_CMD, session, cmd.GetReport(), info.CODE_THE_ID_IS_ALREADY_YOUR_FRIEND)
 		log.Error(info.THE_ID_IS_ALREADY_YOUR_FRIEND)
 		return err
 	}
@@ -115,6 +118,7 @@ func (self *ProtoProc) procAskAddFriend(cmd protocol.Cmd, session *libnet.Sessio
 		receive.AddArg(data.FromID)
 		receive.AddArg(strconv.FormatInt(data.Time, 10))
 		receive.AddArg(data.UUID)
+		receive.AddArg(strconv.FormatInt(data.Seq, 10))
 
 		if self.msgServer.sessions[data.ToID] != nil {
 			self.msgServer.sessions[data.ToID].Send(receive)
@@ -139,11 +143,12 @@ func (self *ProtoProc) procAskAddFriend(cmd protocol.Cmd, session *libnet.Sessio
 			rcmd.AddArg(data.ToID)
 			rcmd.AddArg(strconv.FormatInt(data.Time, 10))
 			rcmd.AddArg(data.UUID)
+			rcmd.AddArg(strconv.FormatInt(data.Seq, 10))
 
 			temp, err := json.Marshal(rcmd)
 			if err != nil {
 				log.Error(err.Error())
-				self.respCmd(protocol.RESP_ASK_CMD, session, cmd.GetReport(), false, info.ERROR)
+				self.respCmd(protocol.RESP_ASK_CMD, session, cmd.GetReport(), info.CODE_ENCODE_ERROR)
 				return err
 			}
 
@@ -154,23 +159,23 @@ func (self *ProtoProc) procAskAddFriend(cmd protocol.Cmd, session *libnet.Sessio
 			err = self.msgServer.channels[protocol.SYSCTRL_SEND].Channel.Broadcast(routerMsg)
 			if err != nil {
 				log.Error(err.Error())
-				self.respCmd(protocol.RESP_ASK_CMD, session, cmd.GetReport(), false, info.ERROR)
+				self.respCmd(protocol.RESP_ASK_CMD, session, cmd.GetReport(), info.CODE_ROUTE_ERROR)
 				return err
 			}
 		}
 
 	}
 
-	self.respCmd(protocol.RESP_ASK_CMD, session, cmd.GetReport(), true, "")
+	self.respCmd(protocol.RESP_ASK_CMD, session, cmd.GetReport(), info.CODE_OK)
 	return err
 }
 
-//获取用户P2P未读信息
+//获取用户未回应的请求
 func (self *ProtoProc) procAskOfflineMsg(session *libnet.Session, cid string) error {
 	var err error
 
 	//从mongo读取信息
-	recordData, err := self.msgServer.mongoStore.ReadMutualRecordMessage(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_P2P_MESSAGE_COLLECTION, cid)
+	recordData, err := self.msgServer.mongoStore.ReadMutualRecordMessage(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_MUTUAL_MESSAGE_COLLECTION, cid)
 	if err != nil {
 		log.Error(err.Error())
 		return err
@@ -184,6 +189,7 @@ func (self *ProtoProc) procAskOfflineMsg(session *libnet.Session, cid string) er
 		receive.AddArg(v.FromID)
 		receive.AddArg(strconv.FormatInt(v.Time, 10))
 		receive.AddArg(v.UUID)
+		receive.AddArg(strconv.FormatInt(v.Seq, 10))
 
 		// //缓存uuid,等待ack
 		// ack := new(base.AckFrequency)
@@ -230,22 +236,21 @@ func (self *ProtoProc) procReact(cmd protocol.Cmd, session *libnet.Session) erro
 	var err error
 
 	if session.State == nil {
-		self.respCmd(protocol.RESP_REACT_CMD, session, cmd.GetReport(), false, info.YOU_HAVE_NOT_LANDED)
+		self.respCmd(protocol.RESP_REACT_CMD, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
 		return nil
 	}
-	if len(cmd.GetArgs()) < protocol.SEND_REACT_CMD_ARGS_NUM {
-		log.Info(info.NOT_ENOUGH_ARGUMENTS)
-		self.respCmd(protocol.RESP_REACT_CMD, session, cmd.GetReport(), false, info.NOT_ENOUGH_ARGUMENTS)
+	req, ok := self.payload(cmd, session, protocol.RESP_REACT_CMD).(*protocol.ReactData)
+	if !ok {
 		return nil
 	}
 
-	reactType := cmd.GetArgs()[0]
-	uuid := cmd.GetArgs()[1]
+	reactType := req.Type
+	uuid := req.UUID
 
 	result := self.msgServer.mongoStore.ReadMutualRecordMessageFromUuid(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_MUTUAL_MESSAGE_COLLECTION, uuid)
 	if result == nil {
 		log.Error(info.NO_INITIATE_THIS_REQUEST)
-		self.respCmd(protocol.RESP_REACT_CMD, session, cmd.GetReport(), false, info.NO_INITIATE_THIS_REQUEST)
+		self.respCmd(protocol.RESP_REACT_CMD, session, cmd.GetReport(), info.CODE_NO_INITIATE_THIS_REQUEST)
 		return err
 	}
 
@@ -262,7 +267,7 @@ func (self *ProtoProc) procReact(cmd protocol.Cmd, session *libnet.Session) erro
 		case protocol.SEND_REACT_CMD_TYPE_INVITE_TOPIC:
 		default:
 			log.Info(info.THE_REACT_TYPE_IS_UNDEFINED, cmd)
-			self.respCmd(protocol.RESP_REACT_CMD, session, cmd.GetReport(), false, info.THE_REACT_TYPE_IS_UNDEFINED)
+			self.respCmd(protocol.RESP_REACT_CMD, session, cmd.GetReport(), info.CODE_THE_REACT_TYPE_IS_UNDEFINED)
 			return err
 		}
 	}
@@ -270,7 +275,7 @@ func (self *ProtoProc) procReact(cmd protocol.Cmd, session *libnet.Session) erro
 	err = self.msgServer.mongoStore.RemoveMutualRecordMessageFromUuid(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_MUTUAL_MESSAGE_COLLECTION, uuid)
 	if err != nil {
 		log.Error(err.Error())
-		self.respCmd(protocol.RESP_REACT_CMD, session, cmd.GetReport(), false, info.ERROR)
+		self.respCmd(protocol.RESP_REACT_CMD, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 		return err
 	}
 
@@ -290,7 +295,7 @@ func (self *ProtoProc) procReactAddFriend(cmd protocol.Cmd, session *libnet.Sess
 	clientInfo := self.msgServer.mongoStore.GetClientsFromIds(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, []string{data.FromID, data.ToID})
 	if len(clientInfo) != 2 {
 		log.Error(err.Error())
-		self.respCmd(protocol.RESP_REACT_CMD, session, cmd.GetReport(), false, info.NO_CLIENT_INFO)
+		self.respCmd(protocol.RESP_REACT_CMD, session, cmd.GetReport(), info.CODE_NO_CLIENT_INFO)
 		return err
 	} else {
 
@@ -307,7 +312,7 @@ func (self *ProtoProc) procReactAddFriend(cmd protocol.Cmd, session *libnet.Sess
 			err = self.msgServer.mongoStore.UpdateFriendsFromId(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, my.ClientID, append(my.Friends, myFriend.ClientID))
 			if err != nil {
 				log.Error(err.Error())
-				self.respCmd(protocol.RESP_REACT_CMD, session, cmd.GetReport(), false, info.ERROR)
+				self.respCmd(protocol.RESP_REACT_CMD, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 				return err
 			}
 		}
@@ -315,7 +320,7 @@ func (self *ProtoProc) procReactAddFriend(cmd protocol.Cmd, session *libnet.Sess
 			err = self.msgServer.mongoStore.UpdateFriendsFromId(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, myFriend.ClientID, append(myFriend.Friends, my.ClientID))
 			if err != nil {
 				log.Error(err.Error())
-				self.respCmd(protocol.RESP_REACT_CMD, session, cmd.GetReport(), false, info.ERROR)
+				self.respCmd(protocol.RESP_REACT_CMD, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 				return err
 			}
 		}
@@ -44,6 +44,12 @@ func (self *ProtoProc) procSubscribeChannel(cmd protocol.Cmd, session *libnet.Se
 	channelName := cmd.GetArgs()[0]
 	cUUID := cmd.GetArgs()[1]
 	log.Info(channelName)
+
+	//从开启双向TLS的地址接入时,只允许持有CA签发证书的router/monitor订阅
+	if tlsConfig := listenerOf(session).TLS; tlsConfig.Enable && tlsConfig.CAFile != "" && session.VerifiedChains() == nil {
+		log.Warning(session.Conn().RemoteAddr().String() + " has no client certificate, subscribe refused")
+		return
+	}
 	if self.msgServer.channels[channelName] != nil {
 		//fixme
 		session.EnableAsyncSend(1024)
@@ -61,14 +67,14 @@ func (self *ProtoProc) procPing(cmd protocol.Cmd, session *libnet.Session) error
 	// log.Info("procPing")
 
 	if session.State == nil {
-		self.respCmd(protocol.RESP_PONG_CMD, session, cmd.GetReport(), false, info.YOU_HAVE_NOT_LANDED)
+		self.respCmd(protocol.RESP_PONG_CMD, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
 		return nil
 	}
 
 	cid := session.State.(*base.SessionState).ClientID
 
 	if self.msgServer.sessions[cid] == nil || self.msgServer.sessions[cid].State == nil {
-		self.respCmd(protocol.RESP_PONG_CMD, session, cmd.GetReport(), false, info.YOU_HAVE_NOT_LANDED)
+		self.respCmd(protocol.RESP_PONG_CMD, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
 		return nil
 	}
 
@@ -78,7 +84,7 @@ func (self *ProtoProc) procPing(cmd protocol.Cmd, session *libnet.Session) error
 
 	// self.msgServer.mongoStore.UpdateSessionAlive(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, cid, true)
 
-	self.respCmd(protocol.RESP_PONG_CMD, session, cmd.GetReport(), true, "")
+	self.respCmd(protocol.RESP_PONG_CMD, session, cmd.GetReport(), info.CODE_OK)
 	return nil
 }
 
@@ -98,10 +104,9 @@ func (self *ProtoProc) procOfflineMsg(session *libnet.Session, cid string) error
 	if err != nil {
 		return err
 	}
-	return err
 
 	log.Info("Read ask offline message")
-	//获取用户未读群组信息
+	//获取用户未回应的请求
 	err = self.procAskOfflineMsg(session, cid)
 	if err != nil {
 		return err
@@ -128,6 +133,7 @@ func (self *ProtoProc) procP2POfflineMsg(session *libnet.Session, cid string) er
 		// strconv.FormatInt(v.Time, 10)
 		receive.AddArg(strconv.FormatInt(v.Time, 10))
 		receive.AddArg(v.UUID)
+		addSequenceArgs(receive, v.Seq, v.MsTime)
 
 		//缓存uuid,等待ack
 		ack := new(base.AckFrequency)
@@ -154,19 +160,12 @@ func (self *ProtoProc) procClientID(cmd protocol.Cmd, session *libnet.Session) e
 	log.Info("procClientID")
 	var err error
 
-	if len(cmd.GetArgs()) < protocol.SEND_CLIENT_ID_CMD_ARGS_NUM {
-		log.Info(info.NOT_ENOUGH_ARGUMENTS)
-		self.respCmd(protocol.RESP_CLIENT_ID_CMD, session, cmd.GetReport(), false, info.NOT_ENOUGH_ARGUMENTS)
-		self.clientQuit(session)
-		return nil
-	}
-	ClientID := cmd.GetArgs()[0]
-	if len(ClientID) < 1 {
-		log.Info(info.NOT_ENOUGH_ARGUMENTS)
-		self.respCmd(protocol.RESP_CLIENT_ID_CMD, session, cmd.GetReport(), false, info.NOT_ENOUGH_ARGUMENTS)
+	req, ok := self.payload(cmd, session, protocol.RESP_CLIENT_ID_CMD).(*protocol.ClientIDData)
+	if !ok {
 		self.clientQuit(session)
 		return nil
 	}
+	ClientID := req.ClientID
 
 	//查找用户信息
 	clientInfo, err := self.msgServer.mongoStore.GetClientFromId(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, ClientID)
@@ -185,7 +184,7 @@ func (self *ProtoProc) procClientID(cmd protocol.Cmd, session *libnet.Session) e
 				temp, err := json.Marshal(bMsg)
 				if err != nil {
 					log.Error(err.Error())
-					self.respCmd(protocol.RESP_CLIENT_ID_CMD, session, cmd.GetReport(), false, info.ERROR)
+					self.respCmd(protocol.RESP_CLIENT_ID_CMD, session, cmd.GetReport(), info.CODE_ENCODE_ERROR)
 					return err
 				}
 
@@ -196,13 +195,13 @@ func (self *ProtoProc) procClientID(cmd protocol.Cmd, session *libnet.Session) e
 				err = self.msgServer.channels[protocol.SYSCTRL_SEND].Channel.Broadcast(routerMsg)
 				if err != nil {
 					log.Error(err.Error())
-					self.respCmd(protocol.RESP_CLIENT_ID_CMD, session, cmd.GetReport(), false, info.ERROR)
+					self.respCmd(protocol.RESP_CLIENT_ID_CMD, session, cmd.GetReport(), info.CODE_ROUTE_ERROR)
 					return err
 				}
 			} else {
 				if self.msgServer.sessions[ClientID] != nil {
 					sMsg := protocol.NewCmdResponse(protocol.RESP_LOGOUT_CMD)
-					sMsg.Message = info.YOU_HAVE_TO_RE_LOGIN
+					setCode(sMsg, self.msgServer.sessions[ClientID], info.CODE_YOU_HAVE_TO_RE_LOGIN)
 					err = self.msgServer.sessions[ClientID].Send(sMsg)
 					if err != nil {
 						log.Error(err.Error())
@@ -219,7 +218,7 @@ func (self *ProtoProc) procClientID(cmd protocol.Cmd, session *libnet.Session) e
 		err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, &sessionStoreData)
 		if err != nil {
 			log.Error(err.Error())
-			self.respCmd(protocol.RESP_CLIENT_ID_CMD, session, cmd.GetReport(), false, info.ERROR)
+			self.respCmd(protocol.RESP_CLIENT_ID_CMD, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 			return err
 		}
 	} else {
@@ -230,22 +229,27 @@ func (self *ProtoProc) procClientID(cmd protocol.Cmd, session *libnet.Session) e
 		err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, &sessionStoreData)
 		if err != nil {
 			log.Error(err.Error())
-			self.respCmd(protocol.RESP_CLIENT_ID_CMD, session, cmd.GetReport(), false, info.ERROR)
+			self.respCmd(protocol.RESP_CLIENT_ID_CMD, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 			return err
 		}
 	}
 
 	self.msgServer.sessions[ClientID] = session
-	self.msgServer.sessions[ClientID].State = base.NewSessionState(ClientID, time.Now().Unix())
+	state := base.NewSessionState(ClientID, time.Now().Unix())
+	state.Version = cmdVersion(cmd)
+	state.Locale = info.Locale(req.Locale)
+	self.msgServer.sessions[ClientID].State = state
 
-	//获取用户未读信息
-	go self.procOfflineMsg(session, ClientID)
+	//获取用户未读信息, 支持send_sync的客户端自己按游标拉取
+	if state.Version < protocol.PROTOCOL_VERSION_SYNC {
+		go self.procOfflineMsg(session, ClientID)
+	}
 
 	// 广播消息通知其好友
 	go self.broadcastToFriends(ClientID, session, true)
 
-	session.EnableAsyncSend(10)
-	self.respCmd(protocol.RESP_CLIENT_ID_CMD, session, cmd.GetReport(), true, "")
+	self.msgServer.enableAsyncSend(session)
+	self.respCmd(protocol.RESP_CLIENT_ID_CMD, session, cmd.GetReport(), info.CODE_OK)
 	return err
 }
 
@@ -261,18 +265,17 @@ func (self *ProtoProc) procToken(cmd protocol.Cmd, session *libnet.Session) erro
 		temp      []byte
 	)
 
-	if len(cmd.GetArgs()) < protocol.SEND_CLIENT_ID_CMD_ARGS_NUM {
-		log.Info(info.NOT_ENOUGH_ARGUMENTS)
-		self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), false, info.NOT_ENOUGH_ARGUMENTS)
+	req, ok := self.payload(cmd, session, protocol.RESP_TOKEN_CMD).(*protocol.TokenData)
+	if !ok {
 		self.clientQuit(session)
 		return nil
 	}
 
-	token := cmd.GetArgs()[0]
+	token := req.Token
 	resp, err = http.Get(self.msgServer.cfg.VerifyTokenServer + self.msgServer.cfg.VerifyTokenUrl + "?IMToken=" + token)
 	if err != nil {
 		log.Error("Error:", err)
-		self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), false, info.UNABLE_TO_ACCESS_THE_AUTH_SERVER)
+		self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), info.CODE_UNABLE_TO_ACCESS_THE_AUTH_SERVER)
 		self.clientQuit(session)
 		return err
 	}
@@ -281,7 +284,7 @@ func (self *ProtoProc) procToken(cmd protocol.Cmd, session *libnet.Session) erro
 	temp, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
 		log.Error("Error:", err)
-		self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), false, info.FAILED_TO_PARSE_DATA)
+		self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), info.CODE_FAILED_TO_PARSE_DATA)
 		self.clientQuit(session)
 		return err
 	}
@@ -289,7 +292,7 @@ func (self *ProtoProc) procToken(cmd protocol.Cmd, session *libnet.Session) erro
 	err = json.Unmarshal(temp, &tokenData)
 	if err != nil {
 		log.Error("Error:", err)
-		self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), false, info.FAILED_TO_PARSE_DATA)
+		self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), info.CODE_FAILED_TO_PARSE_DATA)
 		self.clientQuit(session)
 		return err
 	}
@@ -300,14 +303,14 @@ func (self *ProtoProc) procToken(cmd protocol.Cmd, session *libnet.Session) erro
 		log.Error("CLientID:", ClientID)
 		log.Error("Platform:", Platform)
 	} else {
-		self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), false, info.INVALID_TOKEN)
+		self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), info.CODE_INVALID_TOKEN)
 		self.clientQuit(session)
 		return err
 	}
 
 	if len(ClientID) < 1 {
 		log.Info(info.NOT_ENOUGH_ARGUMENTS)
-		self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), false, info.NOT_ENOUGH_ARGUMENTS)
+		self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), info.CODE_NOT_ENOUGH_ARGUMENTS)
 		self.clientQuit(session)
 		return nil
 	}
@@ -329,7 +332,7 @@ func (self *ProtoProc) procToken(cmd protocol.Cmd, session *libnet.Session) erro
 				temp, err := json.Marshal(bMsg)
 				if err != nil {
 					log.Error(err.Error())
-					self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), false, info.ERROR)
+					self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), info.CODE_ENCODE_ERROR)
 					return err
 				}
 
@@ -340,13 +343,13 @@ func (self *ProtoProc) procToken(cmd protocol.Cmd, session *libnet.Session) erro
 				err = self.msgServer.channels[protocol.SYSCTRL_SEND].Channel.Broadcast(routerMsg)
 				if err != nil {
 					log.Error(err.Error())
-					self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), false, info.ERROR)
+					self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), info.CODE_ROUTE_ERROR)
 					return err
 				}
 			} else {
 				if self.msgServer.sessions[ClientID] != nil {
 					sMsg := protocol.NewCmdResponse(protocol.RESP_LOGOUT_CMD)
-					sMsg.Message = info.YOU_HAVE_TO_RE_LOGIN
+					setCode(sMsg, self.msgServer.sessions[ClientID], info.CODE_YOU_HAVE_TO_RE_LOGIN)
 					err = self.msgServer.sessions[ClientID].Send(sMsg)
 					if err != nil {
 						log.Error(err.Error())
@@ -363,7 +366,7 @@ func (self *ProtoProc) procToken(cmd protocol.Cmd, session *libnet.Session) erro
 		err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, &sessionStoreData)
 		if err != nil {
 			log.Error(err.Error())
-			self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), false, info.ERROR)
+			self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 			return err
 		}
 	} else {
@@ -374,22 +377,27 @@ func (self *ProtoProc) procToken(cmd protocol.Cmd, session *libnet.Session) erro
 		err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, &sessionStoreData)
 		if err != nil {
 			log.Error(err.Error())
-			self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), false, info.ERROR)
+			self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 			return err
 		}
 	}
 
 	self.msgServer.sessions[ClientID] = session
-	self.msgServer.sessions[ClientID].State = base.NewSessionState(ClientID, time.Now().Unix())
+	state := base.NewSessionState(ClientID, time.Now().Unix())
+	state.Version = cmdVersion(cmd)
+	state.Locale = info.Locale(req.Locale)
+	self.msgServer.sessions[ClientID].State = state
 
-	//获取用户未读信息
-	go self.procOfflineMsg(session, ClientID)
+	//获取用户未读信息, 支持send_sync的客户端自己按游标拉取
+	if state.Version < protocol.PROTOCOL_VERSION_SYNC {
+		go self.procOfflineMsg(session, ClientID)
+	}
 
 	// 广播消息通知其好友
 	go self.broadcastToFriends(ClientID, session, true)
 
-	session.EnableAsyncSend(10)
-	self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), true, "")
+	self.msgServer.enableAsyncSend(session)
+	self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), info.CODE_OK)
 	return err
 }
 
@@ -399,7 +407,7 @@ func (self *ProtoProc) procLogout(cmd protocol.Cmd, session *libnet.Session) err
 	var err error
 
 	if session.State == nil {
-		self.respCmd(protocol.RESP_LOGOUT_CMD, session, cmd.GetReport(), false, info.YOU_HAVE_NOT_LANDED)
+		self.respCmd(protocol.RESP_LOGOUT_CMD, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
 		return nil
 	}
 	clientID := session.State.(*base.SessionState).ClientID
@@ -408,12 +416,12 @@ func (self *ProtoProc) procLogout(cmd protocol.Cmd, session *libnet.Session) err
 		_, err := self.msgServer.mongoStore.UpdateSessionAlive(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, clientID, self.msgServer.cfg.LocalIP, false)
 		if err != nil {
 			log.Error(err.Error())
-			self.respCmd(protocol.RESP_LOGOUT_CMD, session, cmd.GetReport(), false, info.ERROR)
+			self.respCmd(protocol.RESP_LOGOUT_CMD, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 			return err
 		}
 	}
 
-	self.respCmd(protocol.RESP_LOGOUT_CMD, session, cmd.GetReport(), true, "")
+	self.respCmd(protocol.RESP_LOGOUT_CMD, session, cmd.GetReport(), info.CODE_OK)
 
 	// 广播消息通知其好友
 	go self.broadcastToFriends(clientID, session, false)
@@ -430,29 +438,51 @@ func (self *ProtoProc) procSendMessageP2P(cmd protocol.Cmd, session *libnet.Sess
 	msgType := cmd.GetCmdName()
 
 	if session.State == nil {
-		self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false, info.YOU_HAVE_NOT_LANDED)
+		self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
 		return nil
 	}
-	if len(cmd.GetArgs()) < protocol.SEND_MESSAGE_P2P_CMD_ARGS_NUM {
-		log.Info(info.NOT_ENOUGH_ARGUMENTS)
-		self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false, info.NOT_ENOUGH_ARGUMENTS)
+	req, ok := self.payload(cmd, session, NCommendMappedMap[msgType].RespCmd).(*protocol.MessageP2PData)
+	if !ok {
 		return nil
 	}
 
 	fromID := session.State.(*base.SessionState).ClientID
-	send2Msg := cmd.GetArgs()[0]
-	send2ID := cmd.GetArgs()[1]
-	send2Time := time.Now().Unix()
-	uuid := common.NewV4().String()
-
-	//保存消息到mongodb中
-	data := mongo_store.P2PRecordMessageData{msgType, fromID, send2ID, send2Msg, send2Time, uuid, false}
-	err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_P2P_MESSAGE_COLLECTION, &data)
+	send2Msg := req.Msg
+	send2ID := req.ToID
+	now := time.Now()
+	send2Time := now.Unix()
+	sent := sentMessage{UUID: common.NewV4().String(), Time: send2Time, MsTime: now.UnixNano() / int64(time.Millisecond)}
+	uuid := sent.UUID
+	sentKey := dedupeKey(mongo_store.RECORD_P2P_MESSAGE_COLLECTION, fromID, req.ClientMsgID)
+
+	//客户端重发的消息不再保存和投递, 返回第一次的消息ID和时间
+	if req.ClientMsgID != "" {
+		if found, ok := self.findSentMessage(mongo_store.RECORD_P2P_MESSAGE_COLLECTION, fromID, req.ClientMsgID, sent); ok {
+			log.Info("repeated message: ", req.ClientMsgID)
+			self.respMessageSent(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), found)
+			return nil
+		}
+	}
+
+	//保存消息到mongodb中, 会话内的序号用于排序和发现丢失的消息
+	conversationID := mongo_store.P2PConversationID(fromID, send2ID)
+	sent.Seq, err = self.msgServer.mongoStore.NextSequence(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_SEQUENCE_COLLECTION, conversationID)
+	if err == nil {
+		data := mongo_store.P2PRecordMessageData{msgType, fromID, send2ID, send2Msg, send2Time, uuid, false, req.ClientMsgID,
+			conversationID, sent.Seq, sent.MsTime}
+		err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_P2P_MESSAGE_COLLECTION, &data)
+	}
 	if err != nil {
 		log.Error(err.Error())
-		self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false, info.ERROR)
+		if req.ClientMsgID != "" {
+			self.msgServer.msgDedupe.release(sentKey)
+		}
+		self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 		return err
 	}
+	if req.ClientMsgID != "" {
+		self.msgServer.msgDedupe.save(sentKey, uuid, sent)
+	}
 
 	if self.msgServer.sessions[send2ID] != nil {
 		log.Info("In the same server")
@@ -462,12 +492,13 @@ func (self *ProtoProc) procSendMessageP2P(cmd protocol.Cmd, session *libnet.Sess
 		receive.AddArg(fromID)
 		receive.AddArg(strconv.FormatInt(send2Time, 10))
 		receive.AddArg(uuid)
+		addSequenceArgs(receive, sent.Seq, sent.MsTime)
 
 		if self.msgServer.sessions[send2ID] != nil {
 			self.msgServer.sessions[send2ID].Send(receive)
 			if err != nil {
 				log.Error(err.Error())
-				self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false, info.ERROR)
+				self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), info.CODE_SEND_MESSAGE_ERROR)
 				return err
 			}
 			//储存ACK，用来验证
@@ -484,7 +515,7 @@ func (self *ProtoProc) procSendMessageP2P(cmd protocol.Cmd, session *libnet.Sess
 				mongo_store.CLIENT_INFO_COLLECTION, send2ID)
 			if err != nil {
 				log.Error(err.Error())
-				self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false, info.ERROR)
+				self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 				return err
 			}
 
@@ -513,7 +544,7 @@ func (self *ProtoProc) procSendMessageP2P(cmd protocol.Cmd, session *libnet.Sess
 					strings.NewReader("userId="+send2ID+"&message="+send2Msg+"&msgNum="+strconv.Itoa(send2IDMsgNum)))
 				if err != nil {
 					log.Error(err.Error())
-					self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false, info.UNABLE_TO_ACCESS_THE_PUSH_SERVER)
+					self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), info.CODE_UNABLE_TO_ACCESS_THE_PUSH_SERVER)
 					return err
 				}
 
@@ -538,7 +569,7 @@ func (self *ProtoProc) procSendMessageP2P(cmd protocol.Cmd, session *libnet.Sess
 				resp, err := defaultClient.Do(reqPost)
 				if err != nil {
 					log.Error(err.Error())
-					self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false, info.UNABLE_TO_ACCESS_THE_PUSH_SERVER)
+					self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), info.CODE_UNABLE_TO_ACCESS_THE_PUSH_SERVER)
 					return err
 				}
 
@@ -548,12 +579,12 @@ func (self *ProtoProc) procSendMessageP2P(cmd protocol.Cmd, session *libnet.Sess
 					_, err := ioutil.ReadAll(resp.Body)
 					if err != nil {
 						log.Error(err.Error())
-						self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false, info.UNABLE_TO_ACCESS_THE_PUSH_SERVER)
+						self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), info.CODE_UNABLE_TO_ACCESS_THE_PUSH_SERVER)
 						return err
 					}
 				} else {
-					self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false,
-						info.PUSH_SERVER_ERROR+strconv.Itoa(resp.StatusCode))
+					self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(),
+						info.CODE_PUSH_SERVER_ERROR, resp.StatusCode)
 					return err
 				}
 
@@ -564,11 +595,12 @@ func (self *ProtoProc) procSendMessageP2P(cmd protocol.Cmd, session *libnet.Sess
 				rcmd.AddArg(send2ID)
 				rcmd.AddArg(strconv.FormatInt(send2Time, 10))
 				rcmd.AddArg(uuid)
+				addSequenceArgs(rcmd, sent.Seq, sent.MsTime)
 
 				temp, err := json.Marshal(rcmd)
 				if err != nil {
 					log.Error(err.Error())
-					self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false, info.ERROR)
+					self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), info.CODE_ENCODE_ERROR)
 					return err
 				}
 				routerMsg := protocol.NewCmdSimple(protocol.ROUTE_MSG_CMD)
@@ -578,28 +610,28 @@ func (self *ProtoProc) procSendMessageP2P(cmd protocol.Cmd, session *libnet.Sess
 				err = self.msgServer.channels[protocol.SYSCTRL_SEND].Channel.Broadcast(routerMsg)
 				if err != nil {
 					log.Error(err.Error())
-					self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false, info.ERROR)
+					self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), info.CODE_ROUTE_ERROR)
 					return err
 				}
 			}
 		}
 	}
 
-	self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), true, "")
+	self.respMessageSent(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), &sent)
 	return err
 }
 
 // 解析P2P ACK信息
 func (self *ProtoProc) procP2pAck(cmd protocol.Cmd, session *libnet.Session) error {
 	log.Info("procP2pAck")
-	if len(cmd.GetArgs()) < protocol.P2P_ACK_CMD_ARGS_NUM {
-		log.Info(info.NOT_ENOUGH_ARGUMENTS)
+	req, ok := self.payload(cmd, session, "").(*protocol.AckData)
+	if !ok {
 		return nil
 	}
 	log.Info(cmd)
 
 	var err error
-	uuid := cmd.GetArgs()[0]
+	uuid := req.UUID
 
 	if self.msgServer.p2pAckMap[uuid] != nil {
 		//InACK
@@ -646,6 +678,7 @@ func (self *ProtoProc) procP2pTimeoutRetransmission() {
 			// strconv.FormatInt(recordData.Time, 10)
 			receive.AddArg(strconv.FormatInt(recordData.Time, 10))
 			receive.AddArg(recordData.UUID)
+			addSequenceArgs(receive, recordData.Seq, recordData.MsTime)
 
 			if self.msgServer.sessions[recordData.ToID] != nil {
 				err := self.msgServer.sessions[recordData.ToID].Send(receive)
@@ -663,22 +696,21 @@ func (self *ProtoProc) procCreateTopic(cmd protocol.Cmd, session *libnet.Session
 	var err error
 
 	if session.State == nil {
-		self.respCmd(protocol.RESP_CREATE_TOPIC_CMD, session, cmd.GetReport(), false, info.YOU_HAVE_NOT_LANDED)
+		self.respCmd(protocol.RESP_CREATE_TOPIC_CMD, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
 		return nil
 	}
-	if len(cmd.GetArgs()) < protocol.SEND_CREATE_TOPIC_CMD_ARGS_NUM {
-		log.Info(info.NOT_ENOUGH_ARGUMENTS)
-		self.respCmd(protocol.RESP_CREATE_TOPIC_CMD, session, cmd.GetReport(), false, info.NOT_ENOUGH_ARGUMENTS)
+	req, ok := self.payload(cmd, session, protocol.RESP_CREATE_TOPIC_CMD).(*protocol.TopicData)
+	if !ok {
 		return nil
 	}
 
 	//群组ID
-	topicId := cmd.GetArgs()[0]
+	topicId := req.TopicID
 	founderId := session.State.(*base.SessionState).ClientID
 
 	// 如果群组不存在,才添加群组
 	if result := self.msgServer.mongoStore.GetTopicFromTopicID(mongo_store.DATA_BASE_NAME, mongo_store.TOPIC_INFO_COLLECTION, topicId); result != nil {
-		self.respCmd(protocol.RESP_CREATE_TOPIC_CMD, session, cmd.GetReport(), false, info.TOPIC_ALREADY_EXISTS)
+		self.respCmd(protocol.RESP_CREATE_TOPIC_CMD, session, cmd.GetReport(), info.CODE_TOPIC_ALREADY_EXISTS)
 		return err
 	}
 	//要存入数据库的数据
@@ -688,11 +720,11 @@ func (self *ProtoProc) procCreateTopic(cmd protocol.Cmd, session *libnet.Session
 	err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.TOPIC_INFO_COLLECTION, &TopicStoreData)
 	if err != nil {
 		log.Error(err.Error())
-		self.respCmd(protocol.RESP_CREATE_TOPIC_CMD, session, cmd.GetReport(), false, info.ERROR)
+		self.respCmd(protocol.RESP_CREATE_TOPIC_CMD, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 		return err
 	}
 
-	self.respCmd(protocol.RESP_CREATE_TOPIC_CMD, session, cmd.GetReport(), true, "")
+	self.respCmd(protocol.RESP_CREATE_TOPIC_CMD, session, cmd.GetReport(), info.CODE_OK)
 	return nil
 }
 
@@ -702,30 +734,29 @@ func (self *ProtoProc) procJoinTopic(cmd protocol.Cmd, session *libnet.Session)
 	var err error
 
 	if session.State == nil {
-		self.respCmd(protocol.RESP_JOIN_TOPIC_CMD, session, cmd.GetReport(), false, info.YOU_HAVE_NOT_LANDED)
+		self.respCmd(protocol.RESP_JOIN_TOPIC_CMD, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
 		return nil
 	}
-	if len(cmd.GetArgs()) < protocol.SEND_JOIN_TOPIC_CMD_ARGS_NUM {
-		log.Info(info.NOT_ENOUGH_ARGUMENTS)
-		self.respCmd(protocol.RESP_JOIN_TOPIC_CMD, session, cmd.GetReport(), false, info.NOT_ENOUGH_ARGUMENTS)
+	req, ok := self.payload(cmd, session, protocol.RESP_JOIN_TOPIC_CMD).(*protocol.TopicData)
+	if !ok {
 		return nil
 	}
 
 	//群组ID
-	topicId := cmd.GetArgs()[0]
+	topicId := req.TopicID
 	clientId := session.State.(*base.SessionState).ClientID
 
 	//如果群组存在,群组存在
 	result := self.msgServer.mongoStore.GetTopicFromTopicID(mongo_store.DATA_BASE_NAME, mongo_store.TOPIC_INFO_COLLECTION, topicId)
 	if result == nil {
 		log.Error(info.TOPIC_DOES_NOT_EXISTS)
-		self.respCmd(protocol.RESP_JOIN_TOPIC_CMD, session, cmd.GetReport(), false, info.TOPIC_DOES_NOT_EXISTS)
+		self.respCmd(protocol.RESP_JOIN_TOPIC_CMD, session, cmd.GetReport(), info.CODE_TOPIC_DOES_NOT_EXISTS)
 		return err
 	}
 	users := result.ClientsID
 	if common.InArray(users, clientId) {
 		log.Error(info.YOU_ARE_ALREADY_IN_THE_TOPIC)
-		self.respCmd(protocol.RESP_JOIN_TOPIC_CMD, session, cmd.GetReport(), false, info.YOU_ARE_ALREADY_IN_THE_TOPIC)
+		self.respCmd(protocol.RESP_JOIN_TOPIC_CMD, session, cmd.GetReport(), info.CODE_YOU_ARE_ALREADY_IN_THE_TOPIC)
 		return err
 	}
 
@@ -734,11 +765,11 @@ func (self *ProtoProc) procJoinTopic(cmd protocol.Cmd, session *libnet.Session)
 	err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.TOPIC_INFO_COLLECTION, &TopicStoreData)
 	if err != nil {
 		log.Error(err.Error())
-		self.respCmd(protocol.RESP_JOIN_TOPIC_CMD, session, cmd.GetReport(), false, info.JOIN_TOPIC_FAILURE)
+		self.respCmd(protocol.RESP_JOIN_TOPIC_CMD, session, cmd.GetReport(), info.CODE_JOIN_TOPIC_FAILURE)
 		return err
 	}
 
-	self.respCmd(protocol.RESP_JOIN_TOPIC_CMD, session, cmd.GetReport(), true, "")
+	self.respCmd(protocol.RESP_JOIN_TOPIC_CMD, session, cmd.GetReport(), info.CODE_OK)
 
 	// user string, timeNow int64
 	err = self.msgServer.mongoStore.MarkTopicRecordMessageFromUserAndTime(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_TOPIC_MESSAGE_COLLECTION, clientId, time.Now().Unix(), topicId)
@@ -756,12 +787,11 @@ func (self *ProtoProc) procInviteTopic(cmd protocol.Cmd, session *libnet.Session
 	var err error
 
 	if session.State == nil {
-		self.respCmd(protocol.RESP_INVITE_TOPIC_CMD, session, cmd.GetReport(), false, info.YOU_HAVE_NOT_LANDED)
+		self.respCmd(protocol.RESP_INVITE_TOPIC_CMD, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
 		return nil
 	}
-	if len(cmd.GetArgs()) < protocol.SEND_INVITE_TOPIC_CMD_ARGS_NUM {
-		log.Info(info.NOT_ENOUGH_ARGUMENTS)
-		self.respCmd(protocol.RESP_INVITE_TOPIC_CMD, session, cmd.GetReport(), false, info.NOT_ENOUGH_ARGUMENTS)
+	req, ok := self.payload(cmd, session, protocol.RESP_INVITE_TOPIC_CMD).(*protocol.InviteTopicData)
+	if !ok {
 		return nil
 	}
 
@@ -773,18 +803,15 @@ func (self *ProtoProc) procInviteTopic(cmd protocol.Cmd, session *libnet.Session
 	resp.Repo = cmd.GetReport()
 
 	//群组ID
-	topicId := cmd.GetArgs()[0]
+	topicId := req.TopicID
 	clientId := session.State.(*base.SessionState).ClientID
-	friendList := []string{}
-	for i := 1; i < len(cmd.GetArgs()); i++ {
-		friendList = append(friendList, cmd.GetArgs()[i])
-	}
+	friendList := req.Members
 
 	//判断群组是否存在
 	result := self.msgServer.mongoStore.GetTopicFromTopicID(mongo_store.DATA_BASE_NAME, mongo_store.TOPIC_INFO_COLLECTION, topicId)
 	if result == nil {
 		log.Error(info.TOPIC_DOES_NOT_EXISTS)
-		self.respCmd(protocol.RESP_INVITE_TOPIC_CMD, session, cmd.GetReport(), false, info.TOPIC_DOES_NOT_EXISTS)
+		self.respCmd(protocol.RESP_INVITE_TOPIC_CMD, session, cmd.GetReport(), info.CODE_TOPIC_DOES_NOT_EXISTS)
 		return err
 	}
 
@@ -792,7 +819,7 @@ func (self *ProtoProc) procInviteTopic(cmd protocol.Cmd, session *libnet.Session
 	users := result.ClientsID
 	if !common.InArray(users, clientId) {
 		log.Error(info.YOU_WERE_NOT_IN_TOPIC)
-		self.respCmd(protocol.RESP_INVITE_TOPIC_CMD, session, cmd.GetReport(), false, info.YOU_WERE_NOT_IN_TOPIC)
+		self.respCmd(protocol.RESP_INVITE_TOPIC_CMD, session, cmd.GetReport(), info.CODE_YOU_WERE_NOT_IN_TOPIC)
 		return err
 	}
 
@@ -810,7 +837,7 @@ func (self *ProtoProc) procInviteTopic(cmd protocol.Cmd, session *libnet.Session
 	err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.TOPIC_INFO_COLLECTION, &TopicStoreData)
 	if err != nil {
 		log.Error(err.Error())
-		self.respCmd(protocol.RESP_JOIN_TOPIC_CMD, session, cmd.GetReport(), false, info.JOIN_TOPIC_FAILURE)
+		self.respCmd(protocol.RESP_JOIN_TOPIC_CMD, session, cmd.GetReport(), info.CODE_JOIN_TOPIC_FAILURE)
 		return err
 	}
 
@@ -819,8 +846,7 @@ func (self *ProtoProc) procInviteTopic(cmd protocol.Cmd, session *libnet.Session
 			resp.AddArg(readyToJoinTopic[i])
 		}
 	} else {
-		resp.Ok = false
-		resp.Message = info.JOIN_TOPIC_FAILURE
+		setCode(resp, session, info.CODE_JOIN_TOPIC_FAILURE)
 	}
 
 	//返回用户请求
@@ -850,30 +876,29 @@ func (self *ProtoProc) procLeaveTopic(cmd protocol.Cmd, session *libnet.Session)
 	var err error
 
 	if session.State == nil {
-		self.respCmd(protocol.RESP_LEAVE_TOPIC_CMD, session, cmd.GetReport(), false, info.YOU_HAVE_NOT_LANDED)
+		self.respCmd(protocol.RESP_LEAVE_TOPIC_CMD, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
 		return nil
 	}
-	if len(cmd.GetArgs()) < protocol.SEND_LEAVE_TOPIC_CMD_ARGS_NUM {
-		log.Info(info.NOT_ENOUGH_ARGUMENTS)
-		self.respCmd(protocol.RESP_LEAVE_TOPIC_CMD, session, cmd.GetReport(), false, info.NOT_ENOUGH_ARGUMENTS)
+	req, ok := self.payload(cmd, session, protocol.RESP_LEAVE_TOPIC_CMD).(*protocol.TopicData)
+	if !ok {
 		return nil
 	}
 
 	//群组ID
-	topicId := cmd.GetArgs()[0]
+	topicId := req.TopicID
 	clientId := session.State.(*base.SessionState).ClientID
 
 	//如果群组存在,群组存在
 	result := self.msgServer.mongoStore.GetTopicFromTopicID(mongo_store.DATA_BASE_NAME, mongo_store.TOPIC_INFO_COLLECTION, topicId)
 	if result == nil {
 		log.Error(info.TOPIC_DOES_NOT_EXISTS)
-		self.respCmd(protocol.RESP_LEAVE_TOPIC_CMD, session, cmd.GetReport(), false, info.TOPIC_DOES_NOT_EXISTS)
+		self.respCmd(protocol.RESP_LEAVE_TOPIC_CMD, session, cmd.GetReport(), info.CODE_TOPIC_DOES_NOT_EXISTS)
 		return err
 	}
 	users := result.ClientsID
 	if !common.InArray(users, clientId) {
 		log.Error(info.YOU_WERE_NOT_IN_TOPIC)
-		self.respCmd(protocol.RESP_LEAVE_TOPIC_CMD, session, cmd.GetReport(), false, info.ERROR)
+		self.respCmd(protocol.RESP_LEAVE_TOPIC_CMD, session, cmd.GetReport(), info.CODE_YOU_WERE_NOT_IN_TOPIC)
 		return err
 	}
 	users = common.DeleteChild(users, clientId)
@@ -883,7 +908,7 @@ func (self *ProtoProc) procLeaveTopic(cmd protocol.Cmd, session *libnet.Session)
 		err = self.msgServer.mongoStore.RemoveTopicsFromTopicId(mongo_store.DATA_BASE_NAME, mongo_store.TOPIC_INFO_COLLECTION, topicId)
 		if err != nil {
 			log.Error(err.Error())
-			self.respCmd(protocol.RESP_LEAVE_TOPIC_CMD, session, cmd.GetReport(), false, info.ERROR)
+			self.respCmd(protocol.RESP_LEAVE_TOPIC_CMD, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 			return err
 		}
 	} else {
@@ -891,12 +916,12 @@ func (self *ProtoProc) procLeaveTopic(cmd protocol.Cmd, session *libnet.Session)
 		err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.TOPIC_INFO_COLLECTION, &TopicStoreData)
 		if err != nil {
 			log.Error(err.Error())
-			self.respCmd(protocol.RESP_LEAVE_TOPIC_CMD, session, cmd.GetReport(), false, info.ERROR)
+			self.respCmd(protocol.RESP_LEAVE_TOPIC_CMD, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 			return err
 		}
 	}
 
-	self.respCmd(protocol.RESP_LEAVE_TOPIC_CMD, session, cmd.GetReport(), true, "")
+	self.respCmd(protocol.RESP_LEAVE_TOPIC_CMD, session, cmd.GetReport(), info.CODE_OK)
 	return nil
 }
 
@@ -906,7 +931,7 @@ func (self *ProtoProc) procListTopic(cmd protocol.Cmd, session *libnet.Session)
 	var err error
 
 	if session.State == nil {
-		self.respCmd(protocol.RESP_LIST_TOPIC_CMD, session, cmd.GetReport(), false, info.YOU_HAVE_NOT_LANDED)
+		self.respCmd(protocol.RESP_LIST_TOPIC_CMD, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
 		return nil
 	}
 	clientId := session.State.(*base.SessionState).ClientID
@@ -920,7 +945,7 @@ func (self *ProtoProc) procListTopic(cmd protocol.Cmd, session *libnet.Session)
 	result := self.msgServer.mongoStore.GetTopicsFromClientID(mongo_store.DATA_BASE_NAME, mongo_store.TOPIC_INFO_COLLECTION, clientId)
 	if result == nil {
 		log.Info("No topic")
-		self.respCmd(protocol.RESP_LIST_TOPIC_CMD, session, cmd.GetReport(), false, info.TOPIC_DOES_NOT_EXISTS)
+		self.respCmd(protocol.RESP_LIST_TOPIC_CMD, session, cmd.GetReport(), info.CODE_TOPIC_DOES_NOT_EXISTS)
 		return err
 	}
 	topicsNameArr := make([]string, 0)
@@ -931,7 +956,7 @@ func (self *ProtoProc) procListTopic(cmd protocol.Cmd, session *libnet.Session)
 	temp, err := json.Marshal(topicsNameArr)
 	if err != nil {
 		log.Error(err.Error())
-		self.respCmd(protocol.RESP_LIST_TOPIC_CMD, session, cmd.GetReport(), false, info.ERROR)
+		self.respCmd(protocol.RESP_LIST_TOPIC_CMD, session, cmd.GetReport(), info.CODE_ENCODE_ERROR)
 		return err
 	}
 
@@ -951,17 +976,16 @@ func (self *ProtoProc) procTopicMembersList(cmd protocol.Cmd, session *libnet.Se
 	var err error
 
 	if session.State == nil {
-		self.respCmd(protocol.RESP_TOPIC_MEMBERS_LIST_CMD, session, cmd.GetReport(), false, info.YOU_HAVE_NOT_LANDED)
+		self.respCmd(protocol.RESP_TOPIC_MEMBERS_LIST_CMD, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
 		return nil
 	}
-	if len(cmd.GetArgs()) < protocol.SEND_TOPIC_MEMBERS_LIST_CMD_ARGS_NUM {
-		log.Info(info.NOT_ENOUGH_ARGUMENTS)
-		self.respCmd(protocol.RESP_TOPIC_MEMBERS_LIST_CMD, session, cmd.GetReport(), false, info.NOT_ENOUGH_ARGUMENTS)
+	req, ok := self.payload(cmd, session, protocol.RESP_TOPIC_MEMBERS_LIST_CMD).(*protocol.TopicData)
+	if !ok {
 		return nil
 	}
 
 	//群组ID
-	topicId := cmd.GetArgs()[0]
+	topicId := req.TopicID
 	clientId := session.State.(*base.SessionState).ClientID
 
 	//定义返回用户请求信息
@@ -973,7 +997,7 @@ func (self *ProtoProc) procTopicMembersList(cmd protocol.Cmd, session *libnet.Se
 	result := self.msgServer.mongoStore.GetTopicFromTopicID(mongo_store.DATA_BASE_NAME, mongo_store.TOPIC_INFO_COLLECTION, topicId)
 	if result == nil {
 		log.Error(info.NO_CLIENTS_IN_TOPIC)
-		self.respCmd(protocol.RESP_TOPIC_MEMBERS_LIST_CMD, session, cmd.GetReport(), false, info.NO_CLIENTS_IN_TOPIC)
+		self.respCmd(protocol.RESP_TOPIC_MEMBERS_LIST_CMD, session, cmd.GetReport(), info.CODE_NO_CLIENTS_IN_TOPIC)
 		return err
 	}
 
@@ -981,7 +1005,7 @@ func (self *ProtoProc) procTopicMembersList(cmd protocol.Cmd, session *libnet.Se
 	users := result.ClientsID
 	if !common.InArray(users, clientId) {
 		log.Error(info.YOU_WERE_NOT_IN_TOPIC)
-		self.respCmd(protocol.RESP_TOPIC_MEMBERS_LIST_CMD, session, cmd.GetReport(), false, info.YOU_WERE_NOT_IN_TOPIC)
+		self.respCmd(protocol.RESP_TOPIC_MEMBERS_LIST_CMD, session, cmd.GetReport(), info.CODE_YOU_WERE_NOT_IN_TOPIC)
 		return err
 	}
 
@@ -989,14 +1013,14 @@ func (self *ProtoProc) procTopicMembersList(cmd protocol.Cmd, session *libnet.Se
 	clientInfo := self.msgServer.mongoStore.GetFriendsFromIds(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, users)
 	if clientInfo == nil {
 		log.Error("no client list")
-		self.respCmd(protocol.RESP_TOPIC_MEMBERS_LIST_CMD, session, cmd.GetReport(), false, info.ERROR)
+		self.respCmd(protocol.RESP_TOPIC_MEMBERS_LIST_CMD, session, cmd.GetReport(), info.CODE_NO_CLIENTS_IN_TOPIC)
 		return err
 	}
 
 	temp, err := json.Marshal(clientInfo)
 	if err != nil {
 		log.Error(err.Error())
-		self.respCmd(protocol.RESP_TOPIC_MEMBERS_LIST_CMD, session, cmd.GetReport(), false, info.ERROR)
+		self.respCmd(protocol.RESP_TOPIC_MEMBERS_LIST_CMD, session, cmd.GetReport(), info.CODE_ENCODE_ERROR)
 		return err
 	}
 	resp.AddArg(topicId)
@@ -1020,35 +1044,37 @@ func (self *ProtoProc) procSendMessageTopic(cmd protocol.Cmd, session *libnet.Se
 	msgType := cmd.GetCmdName()
 
 	if session.State == nil {
-		self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false, info.YOU_HAVE_NOT_LANDED)
+		self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
 		return nil
 	}
-	if len(cmd.GetArgs()) < protocol.SEND_MESSAGE_TOPIC_CMD_ARGS_NUM {
-		log.Info(info.NOT_ENOUGH_ARGUMENTS)
-		self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false, info.NOT_ENOUGH_ARGUMENTS)
+	req, ok := self.payload(cmd, session, NCommendMappedMap[msgType].RespCmd).(*protocol.MessageTopicData)
+	if !ok {
 		return nil
 	}
 
-	send2Msg := cmd.GetArgs()[0]
-	topicId := cmd.GetArgs()[1]
+	send2Msg := req.Msg
+	topicId := req.TopicID
 
 	fromID := session.State.(*base.SessionState).ClientID
-	send2Time := time.Now().Unix()
+	now := time.Now()
+	send2Time := now.Unix()
 
-	uuid := common.NewV4().String()
+	sent := sentMessage{UUID: common.NewV4().String(), Time: send2Time, MsTime: now.UnixNano() / int64(time.Millisecond)}
+	uuid := sent.UUID
+	sentKey := dedupeKey(mongo_store.RECORD_TOPIC_MESSAGE_COLLECTION, fromID, req.ClientMsgID)
 
 	//获取Topic的信息
 	topicResult := self.msgServer.mongoStore.GetTopicFromTopicID(mongo_store.DATA_BASE_NAME, mongo_store.TOPIC_INFO_COLLECTION, topicId)
 	if topicResult == nil {
 		log.Error(info.TOPIC_DOES_NOT_EXISTS)
-		self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false, info.TOPIC_DOES_NOT_EXISTS)
+		self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), info.CODE_TOPIC_DOES_NOT_EXISTS)
 		return err
 	}
 
 	//判断用户是否属于该Topic
 	if !common.InArray(topicResult.ClientsID, fromID) {
 		log.Info(fromID + " don't belong to the " + topicId)
-		self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false, info.YOU_WERE_NOT_IN_TOPIC)
+		self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), info.CODE_YOU_WERE_NOT_IN_TOPIC)
 		return err
 	}
 
@@ -1056,7 +1082,7 @@ func (self *ProtoProc) procSendMessageTopic(cmd protocol.Cmd, session *libnet.Se
 	msgResult := self.msgServer.mongoStore.GetOnlineClientsFromIds(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, topicResult.ClientsID)
 	if msgResult == nil {
 		log.Info("no client list")
-		self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false, info.ERROR)
+		self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), info.CODE_NO_CLIENTS_IN_TOPIC)
 		return err
 	}
 
@@ -1074,14 +1100,34 @@ func (self *ProtoProc) procSendMessageTopic(cmd protocol.Cmd, session *libnet.Se
 		onlineUsers = append(onlineUsers, v.ClientID)
 	}
 
-	//保存消息到mongodb中
-	data := mongo_store.TopicRecordMessageData{msgType, fromID, topicId, send2Msg, send2Time, uuid, []string{}}
-	err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_TOPIC_MESSAGE_COLLECTION, &data)
+	//客户端重发的消息不再保存和投递, 返回第一次的消息ID和时间
+	if req.ClientMsgID != "" {
+		if found, ok := self.findSentMessage(mongo_store.RECORD_TOPIC_MESSAGE_COLLECTION, fromID, req.ClientMsgID, sent); ok {
+			log.Info("repeated message: ", req.ClientMsgID)
+			self.respMessageSent(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), found)
+			return nil
+		}
+	}
+
+	//保存消息到mongodb中, 会话内的序号用于排序和发现丢失的消息
+	conversationID := mongo_store.TopicConversationID(topicId)
+	sent.Seq, err = self.msgServer.mongoStore.NextSequence(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_SEQUENCE_COLLECTION, conversationID)
+	if err == nil {
+		data := mongo_store.TopicRecordMessageData{msgType, fromID, topicId, send2Msg, send2Time, uuid, []string{}, req.ClientMsgID,
+			conversationID, sent.Seq, sent.MsTime}
+		err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_TOPIC_MESSAGE_COLLECTION, &data)
+	}
 	if err != nil {
 		log.Error(err.Error())
-		self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false, info.ERROR)
+		if req.ClientMsgID != "" {
+			self.msgServer.msgDedupe.release(sentKey)
+		}
+		self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 		return err
 	}
+	if req.ClientMsgID != "" {
+		self.msgServer.msgDedupe.save(sentKey, uuid, sent)
+	}
 
 	//直接到客户端的信息
 	receive := protocol.NewCmdResponse(NCommendMappedMap[msgType].ReceiveCmd)
@@ -1090,6 +1136,9 @@ func (self *ProtoProc) procSendMessageTopic(cmd protocol.Cmd, session *libnet.Se
 	receive.AddArg(fromID)
 	receive.AddArg(strconv.FormatInt(send2Time, 10))
 	receive.AddArg(uuid)
+	addSequenceArgs(receive, sent.Seq, sent.MsTime)
+	//同一消息只编码一次
+	frame := libnet.NewFrame(receive)
 
 	// map[127.0.0.1:19001:[{aa 192.168.60.101:57826 127.0.0.1:19001 false} {bb 192.168.60.101:57829 127.0.0.1:19001 true} {cc 192.168.60.101:57845 127.0.0.1:19001 true}]]
 	//&{SEND_MESSAGE_TOPIC [hello topics aa]}
@@ -1098,17 +1147,17 @@ func (self *ProtoProc) procSendMessageTopic(cmd protocol.Cmd, session *libnet.Se
 			log.Info("In the same server")
 			for _, client := range v {
 				if self.msgServer.sessions[client.ClientID] != nil {
-					err = self.msgServer.sessions[client.ClientID].AsyncSend(receive)
-					if err != nil {
-						log.Error(err.Error())
-					}
-
-					//缓存uuid,等待ack
+					//缓存uuid,等待ack, 先于发送登记, 溢出时会被去掉
 					ack := new(base.AckFrequency)
 					ack.Frequency = 1
 					ack.LastTime = send2Time
 					//用uuid+ClientID做key
 					self.msgServer.topicAckMap[client.ClientID+uuid] = ack
+
+					err = self.msgServer.sessions[client.ClientID].AsyncSend(frame)
+					if err != nil {
+						log.Error(err.Error())
+					}
 				}
 			}
 		} else {
@@ -1116,7 +1165,7 @@ func (self *ProtoProc) procSendMessageTopic(cmd protocol.Cmd, session *libnet.Se
 			sjm, err := json.Marshal(v)
 			if err != nil {
 				log.Error(err.Error())
-				self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false, info.ERROR)
+				self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), info.CODE_ENCODE_ERROR)
 				return err
 			}
 
@@ -1129,11 +1178,12 @@ func (self *ProtoProc) procSendMessageTopic(cmd protocol.Cmd, session *libnet.Se
 			tempCmd.AddArg(strconv.FormatInt(send2Time, 10))
 			tempCmd.AddArg(string(sjm))
 			tempCmd.AddArg(uuid)
+			addSequenceArgs(tempCmd, sent.Seq, sent.MsTime)
 
 			jcmd, err := json.Marshal(tempCmd)
 			if err != nil {
 				log.Error(err.Error())
-				self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), false, info.ERROR)
+				self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), info.CODE_ENCODE_ERROR)
 				return err
 			}
 
@@ -1150,7 +1200,7 @@ func (self *ProtoProc) procSendMessageTopic(cmd protocol.Cmd, session *libnet.Se
 		}
 	}
 
-	self.respCmd(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), true, "")
+	self.respMessageSent(NCommendMappedMap[msgType].RespCmd, session, cmd.GetReport(), &sent)
 	return err
 }
 
@@ -1184,6 +1234,7 @@ func (self *ProtoProc) procTopicOfflineMsg(session *libnet.Session, cid string)
 		resp.AddArg(v.FromID)
 		resp.AddArg(strconv.FormatInt(v.Time, 10))
 		resp.AddArg(v.UUID)
+		addSequenceArgs(resp, v.Seq, v.MsTime)
 
 		time.Sleep(100)
 
@@ -1213,13 +1264,13 @@ func (self *ProtoProc) procTopicAck(cmd protocol.Cmd, session *libnet.Session) e
 	if session.State == nil {
 		return nil
 	}
-	if len(cmd.GetArgs()) < protocol.TOPIC_ACK_CMD_ARGS_NUM {
-		log.Info(info.NOT_ENOUGH_ARGUMENTS)
+	req, ok := self.payload(cmd, session, "").(*protocol.AckData)
+	if !ok {
 		return nil
 	}
 
 	clientID := session.State.(*base.SessionState).ClientID
-	uuid := cmd.GetArgs()[0]
+	uuid := req.UUID
 
 	if self.msgServer.topicAckMap[clientID+uuid] != nil {
 		msg := self.msgServer.mongoStore.ReadTopicRecordMessageFromUuid(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_TOPIC_MESSAGE_COLLECTION, uuid)
@@ -1274,6 +1325,7 @@ func (self *ProtoProc) procTopicTimeoutRetransmission() {
 			resp.AddArg(recordData.FromID)
 			resp.AddArg(strconv.FormatInt(recordData.Time, 10))
 			resp.AddArg(recordData.UUID)
+			addSequenceArgs(resp, recordData.Seq, recordData.MsTime)
 
 			if self.msgServer.sessions[clientID] != nil {
 				err := self.msgServer.sessions[clientID].Send(resp)
@@ -1309,16 +1361,85 @@ func (self *ProtoProc) deleteWithMutex(parent interface{}, children string, dMut
 }
 
 //回复客户端统一
-func (self *ProtoProc) respCmd(respCmd string, session *libnet.Session, repo interface{}, ok bool, message string) {
+//解析命令的数据, 格式不对或缺少字段时回复respCmd失败并返回nil, ack等没有回复的命令respCmd为空
+func (self *ProtoProc) payload(cmd protocol.Cmd, session *libnet.Session, respCmd string) interface{} {
+	simple, ok := cmd.(*protocol.CmdSimple)
+	if !ok {
+		return nil
+	}
+	if err := simple.ParsePayload(); err != nil {
+		log.Info(err.Error())
+		if respCmd == "" {
+			return nil
+		}
+		if e, ok := err.(*protocol.MissingFieldError); ok {
+			self.respCmd(respCmd, session, cmd.GetReport(), info.CODE_MISSING_ARGUMENT, e.Field)
+		} else if err == protocol.ErrUnsupportedVersion {
+			self.respCmd(respCmd, session, cmd.GetReport(), info.CODE_UNSUPPORTED_VERSION)
+		} else {
+			self.respCmd(respCmd, session, cmd.GetReport(), info.CODE_INVALID_ARGUMENTS)
+		}
+		return nil
+	}
+	return simple.GetAnyData()
+}
+
+//命令带的协议版本, 旧客户端为PROTOCOL_VERSION_LEGACY
+func cmdVersion(cmd protocol.Cmd) int {
+	if simple, ok := cmd.(*protocol.CmdSimple); ok {
+		return simple.GetVersion()
+	}
+	return protocol.PROTOCOL_VERSION_LEGACY
+}
+
+//会话登录时带的语言, 没有登录的用默认语言
+func sessionLocale(session *libnet.Session) string {
+	if state, ok := session.State.(*base.SessionState); ok && state.Locale != "" {
+		return state.Locale
+	}
+	return info.DEFAULT_LOCALE
+}
+
+//设置返回的错误码, 提示信息按会话的语言, args为提示信息模板的参数
+func setCode(resp *protocol.CmdResponse, session *libnet.Session, code int, args ...interface{}) {
+	resp.Ok = code == info.CODE_OK
+	resp.Code = code
+	resp.Message = info.Message(sessionLocale(session), code, args...)
+}
+
+func (self *ProtoProc) respCmd(respCmd string, session *libnet.Session, repo interface{}, code int, args ...interface{}) {
 	//定义返回用户请求信息
 	resp := protocol.NewCmdResponse(respCmd)
 	resp.Repo = repo
-	resp.Ok = ok
-	resp.Message = message
+	setCode(resp, session, code, args...)
 	resp.Time = time.Now().Unix()
 
 	//返回用户请求
-	err := session.Send(resp)
+	err := self.msgServer.sendCmd(session, resp)
+	if err != nil {
+		log.Error("report :", err.Error())
+	}
+}
+
+//消息的会话序号和毫秒时间, 加在receive_*、route_*和发送回复的obj最后, 旧客户端不用理会
+func addSequenceArgs(cmd interface {
+	AddArg(arg string)
+}, seq int64, msTime int64) {
+	cmd.AddArg(strconv.FormatInt(seq, 10))
+	cmd.AddArg(strconv.FormatInt(msTime, 10))
+}
+
+//消息发送成功, obj中返回服务器的消息ID、时间、会话序号和毫秒时间, 客户端重发时也返回第一次的
+func (self *ProtoProc) respMessageSent(respCmd string, session *libnet.Session, repo interface{}, sent *sentMessage) {
+	resp := protocol.NewCmdResponse(respCmd)
+	resp.Repo = repo
+	resp.AddArg(sent.UUID)
+	resp.AddArg(strconv.FormatInt(sent.Time, 10))
+	addSequenceArgs(resp, sent.Seq, sent.MsTime)
+	setCode(resp, session, info.CODE_OK)
+	resp.Time = time.Now().Unix()
+
+	err := self.msgServer.sendCmd(session, resp)
 	if err != nil {
 		log.Error("report :", err.Error())
 	}
@@ -1398,24 +1519,23 @@ func (self *ProtoProc) procClientOnlineStatus(cmd protocol.Cmd, session *libnet.
 	var err error
 
 	if session.State == nil {
-		self.respCmd(protocol.RESP_CLIENT_ONLINE_STATUS, session, cmd.GetReport(), false, info.YOU_HAVE_NOT_LANDED)
+		self.respCmd(protocol.RESP_CLIENT_ONLINE_STATUS, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
 		return nil
 	}
 
-	if len(cmd.GetArgs()) < protocol.SEND_CLIENT_ONLINE_STATUS_ARGS_NUM {
-		log.Info(info.NOT_ENOUGH_ARGUMENTS)
-		self.respCmd(protocol.RESP_CLIENT_ONLINE_STATUS, session, cmd.GetReport(), false, info.NOT_ENOUGH_ARGUMENTS)
+	req, ok := self.payload(cmd, session, protocol.RESP_CLIENT_ONLINE_STATUS).(*protocol.FriendData)
+	if !ok {
 		return nil
 	}
 
-	friendId := cmd.GetArgs()[0]
+	friendId := req.FriendID
 
 	if friendId != "" {
 		// 标记用户离线
 		clientInfo, err := self.msgServer.mongoStore.GetClientFromId(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, friendId)
 		if err != nil {
 			log.Error(err.Error())
-			self.respCmd(protocol.RESP_CLIENT_ONLINE_STATUS, session, cmd.GetReport(), false, info.ERROR)
+			self.respCmd(protocol.RESP_CLIENT_ONLINE_STATUS, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
 			return err
 		}
 
@@ -1431,7 +1551,7 @@ func (self *ProtoProc) procClientOnlineStatus(cmd protocol.Cmd, session *libnet.
 		msg, err := json.Marshal(notifyMsg)
 		if err != nil {
 			log.Error(err.Error())
-			self.respCmd(protocol.RESP_CLIENT_ONLINE_STATUS, session, cmd.GetReport(), false, info.ERROR)
+			self.respCmd(protocol.RESP_CLIENT_ONLINE_STATUS, session, cmd.GetReport(), info.CODE_ENCODE_ERROR)
 			return err
 		}
 
@@ -1446,7 +1566,7 @@ func (self *ProtoProc) procClientOnlineStatus(cmd protocol.Cmd, session *libnet.
 			log.Error("report :", err.Error())
 		}
 	} else {
-		self.respCmd(protocol.RESP_CLIENT_ONLINE_STATUS, session, cmd.GetReport(), false, info.NOT_ENOUGH_ARGUMENTS)
+		self.respCmd(protocol.RESP_CLIENT_ONLINE_STATUS, session, cmd.GetReport(), info.CODE_NOT_ENOUGH_ARGUMENTS)
 	}
 
 	return err
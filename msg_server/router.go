@@ -104,7 +104,7 @@ func (self *ProtoProc) procRouterChangeMsgServer(cmd protocol.Cmd, session *libn
 		return nil
 	} else {
 		resp := protocol.NewCmdResponse(protocol.RESP_LOGOUT_CMD)
-		resp.Message = info.YOU_HAVE_TO_RE_LOGIN
+		setCode(resp, self.msgServer.sessions[clientID], info.CODE_YOU_HAVE_TO_RE_LOGIN)
 
 		err = self.msgServer.sessions[clientID].Send(resp)
 		if err != nil {
@@ -142,6 +142,10 @@ func (self *ProtoProc) procRouteMessageP2P(cmd protocol.Cmd, session *libnet.Ses
 	receive.AddArg(fromID)
 	receive.AddArg(send2Time)
 	receive.AddArg(uuid)
+	//旧版本的msg_server转发时没有序号
+	for _, arg := range cmd.GetArgs()[protocol.ROUTE_MESSAGE_P2P_CMD_ARGS_NUM:] {
+		receive.AddArg(arg)
+	}
 
 	if self.msgServer.sessions[send2ID] != nil {
 		self.msgServer.sessions[send2ID].Send(receive)
@@ -205,6 +209,10 @@ func (self *ProtoProc) procRouteAsk(cmd protocol.Cmd, session *libnet.Session) e
 	receive.AddArg(fromID)
 	receive.AddArg(msgtime)
 	receive.AddArg(uuid)
+	//旧版本的msg_server转发时没有序号
+	for _, arg := range cmd.GetArgs()[protocol.ROUTE_ASK_CMD_ARGS_NUM:] {
+		receive.AddArg(arg)
+	}
 
 	if self.msgServer.sessions[toID] != nil {
 		self.msgServer.sessions[toID].Send(receive)
@@ -241,15 +249,20 @@ func (self *ProtoProc) procRouteMessageTopic(cmd protocol.Cmd, session *libnet.S
 	var Clients []mongo_store.SessionStoreData
 	json.Unmarshal(getTargetListByte, &Clients)
 
-	for _, v := range Clients {
-		//router转发的信息
-		newCmd := protocol.NewCmdResponse(NCommendMappedMap[msgType].ReceiveCmd)
-		newCmd.AddArg(send2Msg)
-		newCmd.AddArg(topicId)
-		newCmd.AddArg(fromID)
-		newCmd.AddArg(send2Time)
-		newCmd.AddArg(uuid)
+	//router转发的信息,同一消息只编码一次
+	newCmd := protocol.NewCmdResponse(NCommendMappedMap[msgType].ReceiveCmd)
+	newCmd.AddArg(send2Msg)
+	newCmd.AddArg(topicId)
+	newCmd.AddArg(fromID)
+	newCmd.AddArg(send2Time)
+	newCmd.AddArg(uuid)
+	//旧版本的msg_server转发时没有序号
+	for _, arg := range args[protocol.ROUTE_MESSAGE_TOPIC_CMD_ARGS_NUM:] {
+		newCmd.AddArg(arg)
+	}
+	frame := libnet.NewFrame(newCmd)
 
+	for _, v := range Clients {
 		//缓存uuid,等待ack
 		ack := new(base.AckFrequency)
 		ack.Frequency = 1
@@ -258,7 +271,7 @@ func (self *ProtoProc) procRouteMessageTopic(cmd protocol.Cmd, session *libnet.S
 		self.msgServer.topicAckMap[v.ClientID+uuid] = ack
 
 		if self.msgServer.sessions[v.ClientID] != nil {
-			err = self.msgServer.sessions[v.ClientID].AsyncSend(newCmd)
+			err = self.msgServer.sessions[v.ClientID].AsyncSend(frame)
 			if err != nil {
 				log.Error(err.Error())
 			}
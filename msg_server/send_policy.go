@@ -0,0 +1,267 @@
+package main
+
+import (
+	"goProject/base"
+	"goProject/libnet"
+	"goProject/log"
+	"goProject/protocol"
+	"goProject/storage/mongo_store"
+	"strconv"
+	"time"
+)
+
+const DEFAULT_ASYNC_SEND_QUEUE_SIZE = 64
+
+var sendPolicyModes = map[string]int{
+	"close":         libnet.POLICY_CLOSE,
+	"block":         libnet.POLICY_BLOCK,
+	"drop_oldest":   libnet.POLICY_DROP_OLDEST,
+	"drop_priority": libnet.POLICY_DROP_PRIORITY,
+	"spill":         libnet.POLICY_SPILL,
+}
+
+//登录成功后开启异步发送, 队列满时按配置的策略处理
+func (self *MsgServer) enableAsyncSend(session *libnet.Session) {
+	mode, ok := sendPolicyModes[self.cfg.AsyncSend.Policy]
+	if !ok && self.cfg.AsyncSend.Policy != "" {
+		log.Warning("unknown AsyncSend policy " + self.cfg.AsyncSend.Policy + ", use close")
+	}
+	session.SetSendPolicy(libnet.SendPolicy{
+		Mode:     mode,
+		Timeout:  self.cfg.AsyncSend.BlockTimeout * time.Millisecond,
+		Priority: sendPriority,
+		Spill:    self.spillMessage,
+		Drained:  self.resendSpilled,
+	})
+
+	size := self.cfg.AsyncSend.QueueSize
+	if size <= 0 {
+		size = DEFAULT_ASYNC_SEND_QUEUE_SIZE
+	}
+	session.EnableAsyncSend(size)
+}
+
+//发给客户端的命令, receive_*和resp_*是CmdResponse, 没有实现protocol.Cmd
+type sentCmd interface {
+	GetCmdName() string
+	GetArgs() []string
+}
+
+//通知类消息最先丢弃, 其次是聊天消息, 命令应答最后
+func sendPriority(msg interface{}) int {
+	if frame, ok := msg.(*libnet.Frame); ok {
+		msg = frame.Msg()
+	}
+	cmd, ok := msg.(sentCmd)
+	if !ok {
+		return 0
+	}
+	switch cmd.GetCmdName() {
+	case protocol.RECEIVE_NOTIFY_P2P_CMD, protocol.RECEIVE_NOTIFY_TOPIC_CMD:
+		return 0
+	case protocol.RECEIVE_MESSAGE_P2P_CMD, protocol.RECEIVE_MESSAGE_TOPIC_CMD:
+		return 1
+	}
+	return 2
+}
+
+//控制类消息走高优先级队列, 不会排在大量聊天和离线消息后面, 客户端不会因为心跳回复太晚以为断线.
+//resp_logout发送后马上断开, 用Send直接发送, 同样不用等队列里的消息
+func sendLane(msg interface{}) int {
+	cmd, ok := msg.(sentCmd)
+	if !ok {
+		return libnet.PRIORITY_NORMAL
+	}
+	switch cmd.GetCmdName() {
+	case protocol.RESP_PONG_CMD, protocol.SEND_CHANGE_MESSAGE_SERVER_CMD:
+		return libnet.PRIORITY_HIGH
+	}
+	return libnet.PRIORITY_NORMAL
+}
+
+//按sendLane的优先级发送, 没开启异步发送或普通优先级时直接发送
+func (self *MsgServer) sendCmd(session *libnet.Session, msg interface{}) error {
+	if lane := sendLane(msg); lane > libnet.PRIORITY_NORMAL && session.IsAsyncSend() {
+		return session.AsyncSendPriority(msg, lane)
+	}
+	return session.Send(msg)
+}
+
+//溢出的消息, 会话还在线时等发送队列清空后按UUID从mongo读出重发
+type spilledMessage struct {
+	Collection string
+	UUID       string
+}
+
+//按UUID读取未读的消息记录, 由MongoStore实现
+type recordReader interface {
+	ReadP2PRecordMessageFromUuid(db string, c string, uuid string) *mongo_store.P2PRecordMessageData
+	ReadTopicRecordMessageFromUuid(db string, c string, uuid string) *mongo_store.TopicRecordMessageData
+	ReadMutualRecordMessageFromUuid(db string, c string, uuid string) *mongo_store.MutualRecordMessageData
+}
+
+//未发出的消息和请求在mongo中仍是未读状态, 去掉ack等待.
+//会话还在线时发送队列清空后重发, 已断开的用户下次登录时作为离线消息拉取
+func (self *MsgServer) spillMessage(session *libnet.Session, msg interface{}) {
+	if frame, ok := msg.(*libnet.Frame); ok {
+		msg = frame.Msg()
+	}
+	cmd, ok := msg.(sentCmd)
+	if !ok || session.State == nil {
+		return
+	}
+	clientID := session.State.(*base.SessionState).ClientID
+	args := cmd.GetArgs()
+
+	switch cmd.GetCmdName() {
+	case protocol.RECEIVE_MESSAGE_P2P_CMD, protocol.RECEIVE_NOTIFY_P2P_CMD:
+		if len(args) < 4 {
+			return
+		}
+		self.p2pAckMutex.Lock()
+		delete(self.p2pAckMap, args[3])
+		self.p2pAckMutex.Unlock()
+		self.addSpilled(session, mongo_store.RECORD_P2P_MESSAGE_COLLECTION, args[3])
+		log.Info("spill " + cmd.GetCmdName() + " " + args[3] + " of " + clientID)
+	case protocol.RECEIVE_MESSAGE_TOPIC_CMD, protocol.RECEIVE_NOTIFY_TOPIC_CMD:
+		if len(args) < 5 {
+			return
+		}
+		self.topicAckMutex.Lock()
+		delete(self.topicAckMap, clientID+args[4])
+		self.topicAckMutex.Unlock()
+		self.addSpilled(session, mongo_store.RECORD_TOPIC_MESSAGE_COLLECTION, args[4])
+		log.Info("spill " + cmd.GetCmdName() + " " + args[4] + " of " + clientID)
+	case protocol.RECEIVE_ASK_CMD:
+		if len(args) < 4 {
+			return
+		}
+		self.mutualAckMutex.Lock()
+		delete(self.mutualAckMap, args[3])
+		self.mutualAckMutex.Unlock()
+		self.addSpilled(session, mongo_store.RECORD_MUTUAL_MESSAGE_COLLECTION, args[3])
+		log.Info("spill " + cmd.GetCmdName() + " " + args[3] + " of " + clientID)
+	default:
+		log.Warning("drop " + cmd.GetCmdName() + " of a slow session")
+	}
+}
+
+//记下还在线的会话溢出的消息, 会话关闭时清除
+func (self *MsgServer) addSpilled(session *libnet.Session, collection string, uuid string) {
+	if session.IsClosed() {
+		return
+	}
+	self.spilledMutex.Lock()
+	msgs, ok := self.spilled[session]
+	self.spilled[session] = append(msgs, spilledMessage{collection, uuid})
+	self.spilledMutex.Unlock()
+	if ok {
+		return
+	}
+
+	//关闭回调持有会话的锁, 不能在spilledMutex里注册
+	clear := func() {
+		self.spilledMutex.Lock()
+		delete(self.spilled, session)
+		self.spilledMutex.Unlock()
+	}
+	session.AddCloseCallback(&self.spilled, clear)
+	if session.IsClosed() {
+		clear()
+	}
+}
+
+//发送队列清空后重发溢出的消息, 在发送循环里调用, 读mongo放到goroutine中.
+//再次溢出的消息等下一次队列清空
+func (self *MsgServer) resendSpilled(session *libnet.Session) {
+	self.spilledMutex.Lock()
+	msgs := self.spilled[session]
+	if len(msgs) > 0 {
+		self.spilled[session] = nil
+	}
+	self.spilledMutex.Unlock()
+	if len(msgs) == 0 {
+		return
+	}
+
+	go func() {
+		for _, msg := range msgs {
+			receive := self.readSpilled(session, msg)
+			if receive == nil {
+				continue
+			}
+			if err := session.AsyncSend(receive); err != nil {
+				log.Error(err.Error())
+				return
+			}
+		}
+	}()
+}
+
+//从mongo读出未读的消息重新生成receive命令并等待ack, 已读或已删除时返回nil
+func (self *MsgServer) readSpilled(session *libnet.Session, msg spilledMessage) *protocol.CmdResponse {
+	if session.State == nil {
+		return nil
+	}
+	clientID := session.State.(*base.SessionState).ClientID
+	ack := &base.AckFrequency{Frequency: 1, LastTime: time.Now().Unix()}
+
+	switch msg.Collection {
+	case mongo_store.RECORD_P2P_MESSAGE_COLLECTION:
+		recordData := self.recordReader.ReadP2PRecordMessageFromUuid(mongo_store.DATA_BASE_NAME, msg.Collection, msg.UUID)
+		if recordData == nil {
+			return nil
+		}
+		receive := protocol.NewCmdResponse(NCommendMappedMap[recordData.MsgType].ReceiveCmd)
+		receive.AddArg(recordData.Content)
+		receive.AddArg(recordData.FromID)
+		receive.AddArg(strconv.FormatInt(recordData.Time, 10))
+		receive.AddArg(recordData.UUID)
+		addSequenceArgs(receive, recordData.Seq, recordData.MsTime)
+
+		//先等待ack, 再次溢出时会被去掉
+		self.p2pAckMutex.Lock()
+		self.p2pAckMap[msg.UUID] = ack
+		self.p2pAckMutex.Unlock()
+		return receive
+	case mongo_store.RECORD_TOPIC_MESSAGE_COLLECTION:
+		recordData := self.recordReader.ReadTopicRecordMessageFromUuid(mongo_store.DATA_BASE_NAME, msg.Collection, msg.UUID)
+		if recordData == nil {
+			return nil
+		}
+		for _, v := range recordData.IsRead {
+			if v == clientID {
+				return nil
+			}
+		}
+		receive := protocol.NewCmdResponse(NCommendMappedMap[recordData.MsgType].ReceiveCmd)
+		receive.AddArg(recordData.Content)
+		receive.AddArg(recordData.ToID)
+		receive.AddArg(recordData.FromID)
+		receive.AddArg(strconv.FormatInt(recordData.Time, 10))
+		receive.AddArg(recordData.UUID)
+		addSequenceArgs(receive, recordData.Seq, recordData.MsTime)
+
+		self.topicAckMutex.Lock()
+		self.topicAckMap[clientID+msg.UUID] = ack
+		self.topicAckMutex.Unlock()
+		return receive
+	case mongo_store.RECORD_MUTUAL_MESSAGE_COLLECTION:
+		recordData := self.recordReader.ReadMutualRecordMessageFromUuid(mongo_store.DATA_BASE_NAME, msg.Collection, msg.UUID)
+		if recordData == nil {
+			return nil
+		}
+		receive := protocol.NewCmdResponse(protocol.RECEIVE_ASK_CMD)
+		receive.AddArg(recordData.Type)
+		receive.AddArg(recordData.FromID)
+		receive.AddArg(strconv.FormatInt(recordData.Time, 10))
+		receive.AddArg(recordData.UUID)
+		receive.AddArg(strconv.FormatInt(recordData.Seq, 10))
+
+		self.mutualAckMutex.Lock()
+		self.mutualAckMap[msg.UUID] = ack
+		self.mutualAckMutex.Unlock()
+		return receive
+	}
+	return nil
+}
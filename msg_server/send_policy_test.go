@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"goProject/base"
+	"goProject/libnet"
+	"goProject/protocol"
+	"goProject/storage/mongo_store"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/funny/unitest"
+)
+
+func newTestMsgServer() *MsgServer {
+	return &MsgServer{
+		sessions:     make(base.SessionMap),
+		p2pAckMap:    make(base.AckMap),
+		topicAckMap:  make(base.AckMap),
+		mutualAckMap: make(base.AckMap),
+		spilled:      make(map[*libnet.Session][]spilledMessage),
+	}
+}
+
+func newTestSession(cid string) *libnet.Session {
+	conn, _ := net.Pipe()
+	session := libnet.NewSession(conn, libnet.Json())
+	session.State = base.NewSessionState(cid, 0)
+	return session
+}
+
+func receiveCmd(name string, args ...string) *protocol.CmdResponse {
+	cmd := protocol.NewCmdResponse(name)
+	for _, arg := range args {
+		cmd.AddArg(arg)
+	}
+	return cmd
+}
+
+// Spilled messages stop waiting for an ack and stay unread for the next login.
+func Test_SpillMessage(t *testing.T) {
+	server := newTestMsgServer()
+	session := newTestSession("bb")
+	defer session.Close()
+
+	server.p2pAckMap["u1"] = &base.AckFrequency{Frequency: 1}
+	server.p2pAckMap["u2"] = &base.AckFrequency{Frequency: 1}
+	server.topicAckMap["bbu3"] = &base.AckFrequency{Frequency: 1}
+	server.mutualAckMap["u4"] = &base.AckFrequency{Frequency: 1}
+	server.p2pAckMap["other"] = &base.AckFrequency{Frequency: 1}
+
+	server.spillMessage(session, receiveCmd(protocol.RECEIVE_MESSAGE_P2P_CMD, "hi", "aa", "1", "u1"))
+	server.spillMessage(session, receiveCmd(protocol.RECEIVE_NOTIFY_P2P_CMD, "hi", "aa", "1", "u2"))
+	server.spillMessage(session, receiveCmd(protocol.RECEIVE_MESSAGE_TOPIC_CMD, "hi", "t1", "aa", "1", "u3"))
+	server.spillMessage(session, receiveCmd(protocol.RECEIVE_ASK_CMD, "add_friend", "aa", "1", "u4", "1"))
+
+	unitest.Pass(t, server.p2pAckMap["u1"] == nil)
+	unitest.Pass(t, server.p2pAckMap["u2"] == nil)
+	unitest.Pass(t, server.topicAckMap["bbu3"] == nil)
+	unitest.Pass(t, server.mutualAckMap["u4"] == nil)
+	unitest.Pass(t, server.p2pAckMap["other"] != nil)
+
+	//帧也一样处理
+	server.p2pAckMap["u5"] = &base.AckFrequency{Frequency: 1}
+	frame := libnet.NewFrame(receiveCmd(protocol.RECEIVE_MESSAGE_P2P_CMD, "hi", "aa", "1", "u5"))
+	server.spillMessage(session, frame)
+	unitest.Pass(t, server.p2pAckMap["u5"] == nil)
+
+	//会话关闭后不再等着重发
+	unitest.Pass(t, len(server.spilled[session]) == 5)
+	session.Close()
+	unitest.Pass(t, len(server.spilled) == 0)
+	server.spillMessage(session, receiveCmd(protocol.RECEIVE_MESSAGE_P2P_CMD, "hi", "aa", "1", "u6"))
+	unitest.Pass(t, len(server.spilled) == 0)
+}
+
+//只有p2p消息的recordReader
+type testRecords map[string]*mongo_store.P2PRecordMessageData
+
+func (self testRecords) ReadP2PRecordMessageFromUuid(db string, c string, uuid string) *mongo_store.P2PRecordMessageData {
+	return self[uuid]
+}
+
+func (self testRecords) ReadTopicRecordMessageFromUuid(db string, c string, uuid string) *mongo_store.TopicRecordMessageData {
+	return nil
+}
+
+func (self testRecords) ReadMutualRecordMessageFromUuid(db string, c string, uuid string) *mongo_store.MutualRecordMessageData {
+	return nil
+}
+
+//在线的会话溢出的消息在发送队列清空后送达
+func Test_ResendSpilled(t *testing.T) {
+	InitCommendMapped()
+	server := newTestMsgServer()
+	server.cfg = &MsgServerConfig{}
+	server.cfg.AsyncSend.Policy = "spill"
+	server.cfg.AsyncSend.QueueSize = 1
+	server.recordReader = testRecords{
+		"u2": {MsgType: protocol.SEND_MESSAGE_P2P_CMD, Content: "hi", FromID: "aa", Time: 1, UUID: "u2", Seq: 2, MsTime: 1001},
+	}
+
+	conn1, conn2 := net.Pipe()
+	session := libnet.NewSession(conn1, libnet.Json())
+	session.State = base.NewSessionState("bb", 0)
+	defer session.Close()
+	conn2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	client := json.NewDecoder(conn2)
+	server.enableAsyncSend(session)
+
+	//第一条发送中, 第二条在队列里, 第三条溢出
+	unitest.NotError(t, session.AsyncSend(receiveCmd(protocol.RECEIVE_MESSAGE_P2P_CMD, "hi", "aa", "1", "u0", "0", "1000")))
+	for i := 0; i < 100 && session.SendQueueLen() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	unitest.NotError(t, session.AsyncSend(receiveCmd(protocol.RECEIVE_MESSAGE_P2P_CMD, "hi", "aa", "1", "u1", "1", "1000")))
+	unitest.NotError(t, session.AsyncSend(receiveCmd(protocol.RECEIVE_MESSAGE_P2P_CMD, "hi", "aa", "1", "u2", "2", "1001")))
+	unitest.Pass(t, session.SendStats().Spill == 1)
+
+	var resp protocol.CmdResponse
+	for _, uuid := range []string{"u0", "u1", "u2"} {
+		unitest.NotError(t, client.Decode(&resp))
+		unitest.Pass(t, resp.CmdName == protocol.RECEIVE_MESSAGE_P2P_CMD && resp.Args[3] == uuid)
+	}
+	unitest.Pass(t, resp.Args[0] == "hi" && resp.Args[4] == "2" && resp.Args[5] == "1001")
+
+	//重发后重新等待ack
+	server.p2pAckMutex.Lock()
+	defer server.p2pAckMutex.Unlock()
+	unitest.Pass(t, server.p2pAckMap["u2"] != nil)
+}
+
+func Test_SendPriority(t *testing.T) {
+	unitest.Pass(t, sendPriority(receiveCmd(protocol.RECEIVE_NOTIFY_P2P_CMD)) == 0)
+	unitest.Pass(t, sendPriority(receiveCmd(protocol.RECEIVE_MESSAGE_TOPIC_CMD)) == 1)
+	unitest.Pass(t, sendPriority(libnet.NewFrame(receiveCmd(protocol.RECEIVE_MESSAGE_P2P_CMD))) == 1)
+	unitest.Pass(t, sendPriority(receiveCmd(protocol.RESP_PONG_CMD)) == 2)
+}
+
+func Test_SendLane(t *testing.T) {
+	unitest.Pass(t, sendLane(receiveCmd(protocol.RESP_PONG_CMD)) == libnet.PRIORITY_HIGH)
+	unitest.Pass(t, sendLane(receiveCmd(protocol.SEND_CHANGE_MESSAGE_SERVER_CMD)) == libnet.PRIORITY_HIGH)
+	unitest.Pass(t, sendLane(receiveCmd(protocol.RECEIVE_MESSAGE_P2P_CMD)) == libnet.PRIORITY_NORMAL)
+}
@@ -4,13 +4,16 @@ import (
 	"encoding/json"
 	"flag"
 	"goProject/base"
+	"goProject/dispatcher"
 	"goProject/info"
 	"goProject/libnet"
 	"goProject/log"
 	"goProject/protocol"
 	// "goProject/service_discovery"
 	"goProject/storage/mongo_store"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,12 +22,18 @@ func init() {
 	flag.Set("log_dir", "true")
 }
 
+const (
+	DEFAULT_DRAIN_TIMEOUT         = 30 * time.Second
+	DEFAULT_MESSAGE_DEDUPE_WINDOW = 5 * time.Minute
+)
+
 type MsgServer struct {
 	cfg      *MsgServerConfig
 	sessions base.SessionMap
 	channels base.ChannelMap
 	// topics   protocol.TopicMap
-	server *libnet.Server
+	//每个监听地址一个
+	servers []*libnet.Server
 
 	p2pAckMap        base.AckMap
 	topicAckMap      base.AckMap
@@ -35,24 +44,41 @@ type MsgServer struct {
 	mutualAckMutex   sync.Mutex
 
 	mongoStore *mongo_store.MongoStore
-	// worker     *Worker
+	worker     *Worker
+	dispatcher *dispatcher.Dispatcher
+	msgDedupe  *MsgDedupe
+
+	//还在线的会话溢出的消息, 见spillMessage
+	spilled      map[*libnet.Session][]spilledMessage
+	spilledMutex sync.Mutex
+	recordReader recordReader
+
+	// About drain
+	drainFlag   int32
+	drainChan   chan int
+	handlerWait sync.WaitGroup
 }
 
 func NewMsgServer(cfg *MsgServerConfig) *MsgServer {
 	InitCommendMapped()
 
-	return &MsgServer{
+	ms := &MsgServer{
 		cfg:      cfg,
 		sessions: make(base.SessionMap),
 		channels: make(base.ChannelMap),
 		// topics:       make(protocol.TopicMap),
-		server:       new(libnet.Server),
 		p2pAckMap:    make(base.AckMap),
 		topicAckMap:  make(base.AckMap),
 		mutualAckMap: make(base.AckMap),
+		spilled:      make(map[*libnet.Session][]spilledMessage),
+		drainChan:    make(chan int),
 		mongoStore:   mongo_store.NewMongoStore(cfg.Mongo.Addr, cfg.Mongo.Port, cfg.Mongo.User, cfg.Mongo.Password),
 		// worker:       NewWorker(cfg.LocalIP, cfg.LocalIP, []string{cfg.EtcdServer}),
 	}
+	ms.dispatcher = ms.newDispatcher()
+	ms.recordReader = ms.mongoStore
+	ms.msgDedupe = NewMsgDedupe(cfg.MessageDedupeWindow * time.Second)
+	return ms
 }
 
 func( self *MsgServer) Init() {
@@ -61,6 +87,8 @@ func( self *MsgServer) Init() {
 	 if err != nil {
 		 log.Error("error:", err)
 	 }
+
+	self.loadPendingAcks()
 }
 
 //创建Channels
@@ -85,7 +113,9 @@ func (self *MsgServer) sendMonitorData() error {
 			select {
 			case <-timer.C:
 				temp, err := json.Marshal(protocol.MsgServerMonitorData{
-					SessionNum: (uint64)(len(self.sessions)),
+					SessionNum: (uint64)(self.sessionNum()),
+					SendStats:  libnet.GlobalSendStats(),
+					Traffic:    self.metrics(),
 				})
 				if err != nil {
 					log.Error(err.Error())
@@ -106,44 +136,230 @@ func (self *MsgServer) sendMonitorData() error {
 
 func (self *MsgServer) sendServiceDiscoveryData() {
 	log.Info("sendServiceDiscoveryData")
-	NewWorker(self.cfg.PublicIP, self.cfg.PublicIP, []string{self.cfg.EtcdServer}, self)
+	self.worker = NewWorker(self.cfg.PublicIP, self.cfg.PublicIP, []string{self.cfg.EtcdServer}, self)
 }
 
-// 扫描进程
-func (self *MsgServer) scanDeadSession() {
-	log.Info("scanDeadSession")
-	timer := time.NewTicker(self.cfg.ScanDeadSessionTimeout * time.Second)
-	ttl := time.After(self.cfg.Expire * time.Second)
-	pp := NewProtoProc(self)
+func (self *MsgServer) overloaded() bool {
+	for _, server := range self.servers {
+		if server.Overloaded() {
+			return true
+		}
+	}
+	return false
+}
 
-	for {
-		select {
-		case <-timer.C:
-			// log.Info("scanDeadSession timeout")
-			go func() {
-				for id, s := range self.sessions {
-					if time.Now().Unix() - (s.State).(*base.SessionState).LastPing > 30 {
-						self.scanSessionMutex.Lock()
-						delete(self.sessions, id)
-						self.scanSessionMutex.Unlock()
-
-						changeNum, err := self.mongoStore.UpdateSessionAlive(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, id, self.cfg.LocalIP, false)
-						if err != nil {
-							log.Error(err.Error())
-							continue
-						}
-						// 真得修改成功才发送离线包
-						if changeNum > 0 {
-							pp.broadcastToFriends(s.State.(*base.SessionState).ClientID, s, false)
-						}
-						s.Close()
-					}
+func (self *MsgServer) isDraining() bool {
+	return atomic.LoadInt32(&self.drainFlag) == 1
+}
+
+//排空停机:停止接入,通知用户切换服务器,等待处理完成后保存状态退出
+func (self *MsgServer) drain() {
+	if !atomic.CompareAndSwapInt32(&self.drainFlag, 0, 1) {
+		return
+	}
+	log.Info("drain start")
+	defer close(self.drainChan)
+
+	timeout := self.cfg.DrainTimeout * time.Second
+	if timeout <= 0 {
+		timeout = DEFAULT_DRAIN_TIMEOUT
+	}
+	deadline := time.Now().Add(timeout)
+
+	//停止接入新连接并从服务发现注销
+	for _, server := range self.servers {
+		server.Listener().Close()
+	}
+	if self.worker != nil {
+		self.worker.Stop()
+	}
+
+	//通知在线用户切换到其他msg_server
+	addr := ""
+	if self.worker != nil {
+		if others := self.worker.Others(); len(others) > 0 {
+			target := others[0]
+			for _, v := range others {
+				if v.SessionNum < target.SessionNum {
+					target = v
 				}
-			}()
-		case <-ttl:
-			break
+			}
+			addr = target.IP
+		}
+	}
+	self.scanSessionMutex.Lock()
+	sessions := make([]*libnet.Session, 0, len(self.sessions))
+	for _, s := range self.sessions {
+		sessions = append(sessions, s)
+	}
+	self.scanSessionMutex.Unlock()
+
+	for _, s := range sessions {
+		resp := protocol.NewCmdResponse(protocol.SEND_CHANGE_MESSAGE_SERVER_CMD)
+		resp.AddArg(addr)
+		resp.AddArg(strconv.FormatInt(int64(timeout/time.Second), 10))
+		resp.Time = time.Now().Unix()
+		err := self.sendCmd(s, resp)
+		if err != nil {
+			log.Error(err.Error())
 		}
 	}
+
+	//等待用户断开,超时强制关闭,然后等待正在执行的请求处理完
+	for _, server := range self.servers {
+		if !server.Drain(deadline.Sub(time.Now())) {
+			log.Warning("drain timeout, remaining sessions closed")
+		}
+	}
+	handlerDone := make(chan int)
+	go func() {
+		self.handlerWait.Wait()
+		close(handlerDone)
+	}()
+	select {
+	case <-handlerDone:
+	case <-time.After(deadline.Sub(time.Now())):
+		log.Warning("drain timeout, handlers still running")
+	}
+
+	self.flushPendingAcks()
+
+	err := self.mongoStore.ResetAllAliveToFalse(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, self.cfg.LocalIP)
+	if err != nil {
+		log.Error("error:", err)
+	}
+	log.Info("drain done")
+}
+
+//等待排空完成
+func (self *MsgServer) waitDrain() {
+	if self.isDraining() {
+		<-self.drainChan
+	}
+}
+
+//保存未确认的ack,重启后继续等待重发
+func (self *MsgServer) flushPendingAcks() {
+	self.p2pAckMutex.Lock()
+	p2pKeys := make([]string, 0, len(self.p2pAckMap))
+	for k := range self.p2pAckMap {
+		p2pKeys = append(p2pKeys, k)
+	}
+	self.p2pAckMutex.Unlock()
+
+	self.topicAckMutex.Lock()
+	topicKeys := make([]string, 0, len(self.topicAckMap))
+	for k := range self.topicAckMap {
+		topicKeys = append(topicKeys, k)
+	}
+	self.topicAckMutex.Unlock()
+
+	p2pData := mongo_store.KVData{Type: mongo_store.KV_TYPE_PENDING_P2P_ACK, Key: self.cfg.LocalIP, Value: p2pKeys}
+	err := self.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.KV_COLLECTION, &p2pData)
+	if err != nil {
+		log.Error(err.Error())
+	}
+
+	topicData := mongo_store.KVData{Type: mongo_store.KV_TYPE_PENDING_TOPIC_ACK, Key: self.cfg.LocalIP, Value: topicKeys}
+	err = self.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.KV_COLLECTION, &topicData)
+	if err != nil {
+		log.Error(err.Error())
+	}
+	log.Info("flush pending acks, p2p : ", len(p2pKeys), " topic : ", len(topicKeys))
+}
+
+//读取上次停机时保存的ack
+func (self *MsgServer) loadPendingAcks() {
+	now := time.Now().Unix()
+
+	if data := self.mongoStore.ReadKVData(mongo_store.DATA_BASE_NAME, mongo_store.KV_COLLECTION,
+		mongo_store.KV_TYPE_PENDING_P2P_ACK, self.cfg.LocalIP); data != nil {
+		self.p2pAckMutex.Lock()
+		for _, k := range data.Value {
+			self.p2pAckMap[k] = &base.AckFrequency{LastTime: now, Frequency: 1}
+		}
+		self.p2pAckMutex.Unlock()
+		data.Value = []string{}
+		self.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.KV_COLLECTION, data)
+	}
+
+	if data := self.mongoStore.ReadKVData(mongo_store.DATA_BASE_NAME, mongo_store.KV_COLLECTION,
+		mongo_store.KV_TYPE_PENDING_TOPIC_ACK, self.cfg.LocalIP); data != nil {
+		self.topicAckMutex.Lock()
+		for _, k := range data.Value {
+			self.topicAckMap[k] = &base.AckFrequency{LastTime: now, Frequency: 1}
+		}
+		self.topicAckMutex.Unlock()
+		data.Value = []string{}
+		self.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.KV_COLLECTION, data)
+	}
+}
+
+//读空闲超时, 客户端长时间没有任何数据(包括ping)
+func (self *MsgServer) sessionIdle(session *libnet.Session, idle int) {
+	switch idle {
+	case libnet.IDLE_READ:
+		log.Info(session.Conn().RemoteAddr().String() + " read idle timeout")
+	case libnet.IDLE_WRITE:
+		//写空闲时发送心跳
+		resp := protocol.NewCmdResponse(protocol.RESP_PONG_CMD)
+		resp.Time = time.Now().Unix()
+		self.sendCmd(session, resp)
+	}
+}
+
+//拒绝超过限制的连接,回复第一个请求让客户端重新向gateway请求msg_server
+func (self *MsgServer) rejectSession(session *libnet.Session, reason error) {
+	log.Warning(session.Conn().RemoteAddr().String() + " rejected: " + reason.Error())
+	session.Conn().SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var cmd protocol.CmdSimple
+	if err := session.Receive(&cmd); err != nil {
+		return
+	}
+	respCmd := protocol.RESP_ERROR_CMD
+	switch cmd.GetCmdName() {
+	case protocol.SEND_CLIENT_ID_CMD:
+		respCmd = protocol.RESP_CLIENT_ID_CMD
+	case protocol.SEND_TOKEN_CMD:
+		respCmd = protocol.RESP_TOKEN_CMD
+	}
+	NewProtoProc(self).respCmd(respCmd, session, cmd.GetReport(), info.CODE_SERVER_BUSY)
+}
+
+//在线用户数
+func (self *MsgServer) sessionNum() int {
+	self.scanSessionMutex.Lock()
+	defer self.scanSessionMutex.Unlock()
+	return len(self.sessions)
+}
+
+//连接断开后清理会话,标记下线并通知好友
+func (self *MsgServer) closeSession(session *libnet.Session) {
+	self.dispatcher.Forget(session)
+	if session.State == nil {
+		return
+	}
+	id := session.State.(*base.SessionState).ClientID
+
+	self.scanSessionMutex.Lock()
+	if self.sessions[id] != session {
+		//已退出或在其他连接上重新登录
+		self.scanSessionMutex.Unlock()
+		return
+	}
+	delete(self.sessions, id)
+	self.scanSessionMutex.Unlock()
+
+	changeNum, err := self.mongoStore.UpdateSessionAlive(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, id, self.cfg.LocalIP, false)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	// 真得修改成功才发送离线包
+	if changeNum > 0 {
+		NewProtoProc(self).broadcastToFriends(id, session, false)
+	}
 }
 
 //扫描超时仍未返回的ack,重发消息
@@ -168,205 +384,73 @@ func (self *MsgServer) scanTimeoutAck() {
 	}
 }
 
-//协议解析
-func (self *MsgServer) parseProtocol(cmd protocol.CmdSimple, session *libnet.Session) error {
-	var err error
+//登记各命令的处理函数, 命令的元数据见dispatcher包
+func (self *MsgServer) newDispatcher() *dispatcher.Dispatcher {
 	pp := NewProtoProc(self)
-
-	cmdName := cmd.GetCmdName()
-
-	switch cmdName {
-	//PING
-	case protocol.SEND_PING_CMD:
-		err = pp.procPing(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
+	d := dispatcher.NewDispatcher(
+		func(session interface{}) bool {
+			return session.(*libnet.Session).State != nil
+		},
+		func(session interface{}, cmd protocol.Cmd, respCmd string, code int) {
+			pp.respCmd(respCmd, session.(*libnet.Session), cmd.GetReport(), code)
+		})
+	d.SetRates(self.cfg.CommandRates)
+
+	handle := func(name string, proc func(protocol.Cmd, *libnet.Session) error) {
+		d.Handle(name, func(cmd protocol.Cmd, session interface{}) error {
+			return proc(cmd, session.(*libnet.Session))
+		})
+	}
 	//router订阅
-	case protocol.SUBSCRIBE_CHANNEL_CMD:
-		pp.procSubscribeChannel(&cmd, session)
-
+	handle(protocol.SUBSCRIBE_CHANNEL_CMD, func(cmd protocol.Cmd, session *libnet.Session) error {
+		pp.procSubscribeChannel(cmd, session)
+		return nil
+	})
 	//router过来的信息统一接收端口
-	case protocol.ROUTE_MSG_CMD:
-		err = pp.procRouteMsg(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-	//登陆
-	case protocol.SEND_CLIENT_ID_CMD:
-		err = pp.procClientID(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-	//使用token登陆
-	case protocol.SEND_TOKEN_CMD:
-		err = pp.procToken(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
+	handle(protocol.ROUTE_MSG_CMD, pp.procRouteMsg)
 
-	//退出
-	case protocol.SEND_LOGOUT_CMD:
-		err = pp.procLogout(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
+	//登陆
+	handle(protocol.SEND_CLIENT_ID_CMD, pp.procClientID)
+	handle(protocol.SEND_TOKEN_CMD, pp.procToken)
+	handle(protocol.SEND_PING_CMD, pp.procPing)
+	handle(protocol.SEND_LOGOUT_CMD, pp.procLogout)
 
 	//P2P信息
-	case protocol.SEND_MESSAGE_P2P_CMD:
-		err = pp.procSendMessageP2P(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-	//P2p Notify
-	case protocol.SEND_NOTIFY_P2P_CMD:
-		err = pp.procSendMessageP2P(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	//创建Topic
-	case protocol.SEND_CREATE_TOPIC_CMD:
-		err = pp.procCreateTopic(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-	//加入Topic
-	case protocol.SEND_JOIN_TOPIC_CMD:
-		err = pp.procJoinTopic(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-	case protocol.SEND_INVITE_TOPIC_CMD:
-		err = pp.procInviteTopic(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	//离开Topic
-	case protocol.SEND_LEAVE_TOPIC_CMD:
-		err = pp.procLeaveTopic(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-	//获取群组信息
-	case protocol.SEND_LIST_TOPIC_CMD:
-		err = pp.procListTopic(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-	//获取Topic成员
-	case protocol.SEND_TOPIC_MEMBERS_LIST_CMD:
-		err = pp.procTopicMembersList(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	//Topic信息处理
-	case protocol.SEND_MESSAGE_TOPIC_CMD:
-		err = pp.procSendMessageTopic(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-	//Topic notify信息处理
-	case protocol.SEND_NOTIFY_TOPIC_CMD:
-		err = pp.procSendMessageTopic(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	// p2p ack
-	case protocol.P2P_ACK_CMD:
-		err = pp.procP2pAck(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	// topic ack
-	case protocol.TOPIC_ACK_CMD:
-		err = pp.procTopicAck(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	//view friend list
-	case protocol.SEND_VIEW_FRIENDS_CMD:
-		err = pp.procViewFriends(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	//add friend
-	case protocol.SEND_ADD_FRIEND_CMD:
-		err = pp.procAddFriend(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	//del friend
-	case protocol.SEND_DEL_FRIEND_CMD:
-		err = pp.procDelFriend(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	//请求统一接口
-	case protocol.SEND_ASK_CMD:
-		err = pp.procAsk(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	//接收请求统一接口
-	case protocol.SEND_REACT_CMD:
-		err = pp.procReact(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	//获取好友列表
-	case protocol.SEND_CLIENT_ONLINE_STATUS:
-		err = pp.procClientOnlineStatus(&cmd, session)
-		if err != nil {
-			log.Error("Error:", err)
-			return err
-		}
-
-	//token
-	case protocol.SEND_GET_TOKEN:
-		err = pp.procSendGetToken(&cmd, session)
-		if err != nil {
-			log.Error("Error:", err)
-			return err
-		}
+	handle(protocol.SEND_MESSAGE_P2P_CMD, pp.procSendMessageP2P)
+	handle(protocol.SEND_NOTIFY_P2P_CMD, pp.procSendMessageP2P)
+	handle(protocol.P2P_ACK_CMD, pp.procP2pAck)
+	handle(protocol.SEND_CLIENT_ONLINE_STATUS, pp.procClientOnlineStatus)
+	handle(protocol.SEND_GET_TOKEN, pp.procSendGetToken)
+
+	//Topic
+	handle(protocol.SEND_CREATE_TOPIC_CMD, pp.procCreateTopic)
+	handle(protocol.SEND_JOIN_TOPIC_CMD, pp.procJoinTopic)
+	handle(protocol.SEND_INVITE_TOPIC_CMD, pp.procInviteTopic)
+	handle(protocol.SEND_LEAVE_TOPIC_CMD, pp.procLeaveTopic)
+	handle(protocol.SEND_LIST_TOPIC_CMD, pp.procListTopic)
+	handle(protocol.SEND_TOPIC_MEMBERS_LIST_CMD, pp.procTopicMembersList)
+	handle(protocol.SEND_MESSAGE_TOPIC_CMD, pp.procSendMessageTopic)
+	handle(protocol.SEND_NOTIFY_TOPIC_CMD, pp.procSendMessageTopic)
+	handle(protocol.TOPIC_ACK_CMD, pp.procTopicAck)
+
+	//好友
+	handle(protocol.SEND_VIEW_FRIENDS_CMD, pp.procViewFriends)
+	handle(protocol.SEND_ADD_FRIEND_CMD, pp.procAddFriend)
+	handle(protocol.SEND_DEL_FRIEND_CMD, pp.procDelFriend)
+	handle(protocol.SEND_ASK_CMD, pp.procAsk)
+	handle(protocol.SEND_REACT_CMD, pp.procReact)
+
+	//同步
+	handle(protocol.SEND_SYNC_CMD, pp.procSync)
+
+	return d
+}
 
-	default:
-		log.Info(cmd.GetCmdName())
-		pp.respCmd(protocol.RESP_ERROR_CMD, session, cmd.GetReport(), false, info.ILLEGAL_REQUEST)
+//协议解析
+func (self *MsgServer) parseProtocol(cmd protocol.CmdSimple, session *libnet.Session) error {
+	err := self.dispatcher.Dispatch(&cmd, session)
+	if err != nil {
+		log.Error("error:", err)
 	}
-
 	return err
 }
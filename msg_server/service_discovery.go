@@ -10,10 +10,11 @@ import (
 )
 
 type Worker struct {
-	Name    string
-	IP      string
-	KeysAPI client.KeysAPI
-	Server  *MsgServer
+	Name     string
+	IP       string
+	KeysAPI  client.KeysAPI
+	Server   *MsgServer
+	stopChan chan int
 }
 
 // workerInfo is the service register information to etcd
@@ -22,6 +23,7 @@ type WorkerInfo struct {
 	IP         string
 	CPU        int
 	SessionNum uint64
+	Overload   bool
 }
 
 func NewWorker(name, IP string, endpoints []string, server *MsgServer) *Worker {
@@ -37,10 +39,11 @@ func NewWorker(name, IP string, endpoints []string, server *MsgServer) *Worker {
 	}
 
 	w := &Worker{
-		Name:    name,
-		IP:      IP,
-		KeysAPI: client.NewKeysAPI(etcdClient),
-		Server:  server,
+		Name:     name,
+		IP:       IP,
+		KeysAPI:  client.NewKeysAPI(etcdClient),
+		Server:   server,
+		stopChan: make(chan int),
 	}
 	go w.HeartBeat()
 	return w
@@ -54,7 +57,8 @@ func (w *Worker) HeartBeat() {
 			Name:       w.Name,
 			IP:         w.IP,
 			CPU:        runtime.NumCPU(),
-			SessionNum: (uint64)(len(w.Server.sessions)),
+			SessionNum: (uint64)(w.Server.sessionNum()),
+			Overload:   w.Server.overloaded(),
 		}
 
 		key := "workers/" + w.Name
@@ -66,6 +70,44 @@ func (w *Worker) HeartBeat() {
 		if err != nil {
 			log.Info("Error update workerInfo:", err)
 		}
-		time.Sleep(time.Second * 3)
+
+		select {
+		case <-w.stopChan:
+			return
+		case <-time.After(time.Second * 3):
+		}
+	}
+}
+
+//停止心跳并注销,gateway不再分配用户到本服务器
+func (w *Worker) Stop() {
+	close(w.stopChan)
+
+	_, err := w.KeysAPI.Delete(context.Background(), "workers/"+w.Name, nil)
+	if err != nil {
+		log.Error("Error delete workerInfo:", err)
+	}
+}
+
+//获取其他在线的msg_server
+func (w *Worker) Others() []WorkerInfo {
+	res, err := w.KeysAPI.Get(context.Background(), "workers/", &client.GetOptions{Recursive: true})
+	if err != nil {
+		log.Error("Error get workers:", err)
+		return nil
+	}
+
+	others := make([]WorkerInfo, 0)
+	for _, node := range res.Node.Nodes {
+		info := WorkerInfo{}
+		err := json.Unmarshal([]byte(node.Value), &info)
+		if err != nil {
+			log.Error(err.Error())
+			continue
+		}
+		if info.Name != w.Name {
+			others = append(others, info)
+		}
 	}
+	return others
 }
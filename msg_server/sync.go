@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"goProject/base"
+	"goProject/common"
+	"goProject/info"
+	"goProject/libnet"
+	"goProject/log"
+	"goProject/protocol"
+	"goProject/storage/mongo_store"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_SYNC_PAGE_SIZE = 50
+	MAX_SYNC_PAGE_SIZE     = 200
+	MAX_SYNC_CURSORS       = 500
+)
+
+//需要同步的会话, Cursor为客户端应从其后开始拉取的序号
+type SyncConversation struct {
+	ConversationID string `json:"conversation_id"`
+	Cursor         int64  `json:"cursor"`
+	LastSeq        int64  `json:"last_seq"`
+	Count          int    `json:"count"`
+}
+
+//一页消息, 格式和在线收到的receive_*一样, More为true时用新的Cursor继续拉取
+type SyncPage struct {
+	ConversationID string                  `json:"conversation_id"`
+	Cursor         int64                   `json:"cursor"`
+	More           bool                    `json:"more"`
+	Messages       []*protocol.CmdResponse `json:"messages"`
+}
+
+//按会话游标同步离线消息, 不带conversation_id时返回各会话的消息数, 带时返回该会话的一页消息
+func (self *ProtoProc) procSync(cmd protocol.Cmd, session *libnet.Session) error {
+	log.Info("procSync")
+	if session.State == nil {
+		self.respCmd(protocol.RESP_SYNC_CMD, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
+		return nil
+	}
+	cid := session.State.(*base.SessionState).ClientID
+
+	data, ok := self.payload(cmd, session, protocol.RESP_SYNC_CMD).(*protocol.SyncData)
+	if !ok {
+		return nil
+	}
+
+	var result interface{}
+	var code int
+	if data.ConversationID == "" {
+		result, code = self.syncCounts(cid, data.Cursors)
+	} else {
+		result, code = self.syncPage(cid, data.ConversationID, data.Cursors[data.ConversationID], data.Limit)
+	}
+	if code != info.CODE_OK {
+		self.respCmd(protocol.RESP_SYNC_CMD, session, cmd.GetReport(), code)
+		return nil
+	}
+
+	temp, err := json.Marshal(result)
+	if err != nil {
+		log.Error(err.Error())
+		self.respCmd(protocol.RESP_SYNC_CMD, session, cmd.GetReport(), info.CODE_ENCODE_ERROR)
+		return err
+	}
+
+	resp := protocol.NewCmdResponse(protocol.RESP_SYNC_CMD)
+	resp.Repo = cmd.GetReport()
+	resp.AddArg(string(temp))
+	setCode(resp, session, info.CODE_OK)
+	resp.Time = time.Now().Unix()
+
+	err = self.msgServer.sendCmd(session, resp)
+	if err != nil {
+		log.Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+//会话所在的集合, 并检查用户是否属于该会话
+func (self *ProtoProc) syncCollection(cid string, conversationID string) (string, int) {
+	collection, topicId, code := conversationCollection(cid, conversationID)
+	if code != info.CODE_OK || topicId == "" {
+		return collection, code
+	}
+	topic := self.msgServer.mongoStore.GetTopicFromTopicID(mongo_store.DATA_BASE_NAME, mongo_store.TOPIC_INFO_COLLECTION, topicId)
+	if code = topicMemberCode(topic, cid); code != info.CODE_OK {
+		return "", code
+	}
+	return collection, info.CODE_OK
+}
+
+//按会话ID取集合, 单聊和请求的会话检查用户是其中一方, 群组会话返回群组ID由调用者检查成员
+func conversationCollection(cid string, conversationID string) (string, string, int) {
+	switch {
+	case strings.HasPrefix(conversationID, mongo_store.CONVERSATION_ASK):
+		if conversationID == mongo_store.AskConversationID(cid) {
+			return mongo_store.RECORD_MUTUAL_MESSAGE_COLLECTION, "", info.CODE_OK
+		}
+	case strings.HasPrefix(conversationID, mongo_store.CONVERSATION_P2P):
+		for _, id := range strings.Split(strings.TrimPrefix(conversationID, mongo_store.CONVERSATION_P2P), ":") {
+			if id != cid && mongo_store.P2PConversationID(cid, id) == conversationID {
+				return mongo_store.RECORD_P2P_MESSAGE_COLLECTION, "", info.CODE_OK
+			}
+		}
+	case strings.HasPrefix(conversationID, mongo_store.CONVERSATION_TOPIC):
+		if topicId := strings.TrimPrefix(conversationID, mongo_store.CONVERSATION_TOPIC); topicId != "" {
+			return mongo_store.RECORD_TOPIC_MESSAGE_COLLECTION, topicId, info.CODE_OK
+		}
+	}
+	return "", "", info.CODE_INVALID_ARGUMENTS
+}
+
+func topicMemberCode(topic *mongo_store.TopicStoreData, cid string) int {
+	if topic == nil {
+		return info.CODE_TOPIC_DOES_NOT_EXISTS
+	}
+	if !common.InArray(topic.ClientsID, cid) {
+		return info.CODE_YOU_WERE_NOT_IN_TOPIC
+	}
+	return info.CODE_OK
+}
+
+//各会话需要同步的消息数, 客户端带了游标的按游标统计, 其余的从最早的未读消息开始
+func (self *ProtoProc) syncCounts(cid string, cursors map[string]int64) ([]*SyncConversation, int) {
+	if len(cursors) > MAX_SYNC_CURSORS {
+		return nil, info.CODE_INVALID_ARGUMENTS
+	}
+	store := self.msgServer.mongoStore
+	result := make([]*SyncConversation, 0)
+
+	count := func(collection string, conversationID string, cursor int64) int {
+		data, err := store.CountRecordsAfterSeq(mongo_store.DATA_BASE_NAME, collection, conversationID, cursor)
+		if err != nil {
+			return info.CODE_DATABASE_ERROR
+		}
+		if data != nil {
+			result = append(result, &SyncConversation{
+				ConversationID: conversationID,
+				Cursor:         cursor,
+				LastSeq:        data.MaxSeq,
+				Count:          data.Count,
+			})
+		}
+		return info.CODE_OK
+	}
+
+	for id, cursor := range cursors {
+		//已经不属于的会话跳过
+		collection, code := self.syncCollection(cid, id)
+		if code != info.CODE_OK {
+			continue
+		}
+		if code = count(collection, id, cursor); code != info.CODE_OK {
+			return nil, code
+		}
+	}
+
+	//客户端没有游标的会话
+	unread := func(collection string, data []*mongo_store.SyncCountData, err error) int {
+		if err != nil {
+			return info.CODE_DATABASE_ERROR
+		}
+		for _, v := range data {
+			if _, ok := cursors[v.ConversationID]; ok {
+				continue
+			}
+			if code := count(collection, v.ConversationID, v.MinSeq-1); code != info.CODE_OK {
+				return code
+			}
+		}
+		return info.CODE_OK
+	}
+
+	data, err := store.CountP2PUnreadByConversation(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_P2P_MESSAGE_COLLECTION, cid)
+	if code := unread(mongo_store.RECORD_P2P_MESSAGE_COLLECTION, data, err); code != info.CODE_OK {
+		return nil, code
+	}
+
+	topics := store.GetTopicsFromClientID(mongo_store.DATA_BASE_NAME, mongo_store.TOPIC_INFO_COLLECTION, cid)
+	if len(topics) > 0 {
+		topicsNameArr := make([]string, 0)
+		for _, v := range topics {
+			topicsNameArr = append(topicsNameArr, v.TopicID)
+		}
+		data, err = store.CountTopicUnreadByConversation(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_TOPIC_MESSAGE_COLLECTION, cid, topicsNameArr)
+		if code := unread(mongo_store.RECORD_TOPIC_MESSAGE_COLLECTION, data, err); code != info.CODE_OK {
+			return nil, code
+		}
+	}
+
+	data, err = store.CountMutualUnreadByConversation(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_MUTUAL_MESSAGE_COLLECTION, cid)
+	if code := unread(mongo_store.RECORD_MUTUAL_MESSAGE_COLLECTION, data, err); code != info.CODE_OK {
+		return nil, code
+	}
+
+	sort.Sort(syncConversations(result))
+	return result, info.CODE_OK
+}
+
+type syncConversations []*SyncConversation
+
+func (s syncConversations) Len() int           { return len(s) }
+func (s syncConversations) Less(i, j int) bool { return s[i].ConversationID < s[j].ConversationID }
+func (s syncConversations) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+//会话中cursor之后的一页消息, 拉取过的P2P和群组消息标记为已读
+func (self *ProtoProc) syncPage(cid string, conversationID string, cursor int64, limit int) (*SyncPage, int) {
+	collection, code := self.syncCollection(cid, conversationID)
+	if code != info.CODE_OK {
+		return nil, code
+	}
+	if limit <= 0 {
+		limit = DEFAULT_SYNC_PAGE_SIZE
+	} else if limit > MAX_SYNC_PAGE_SIZE {
+		limit = MAX_SYNC_PAGE_SIZE
+	}
+
+	store := self.msgServer.mongoStore
+	page := &SyncPage{
+		ConversationID: conversationID,
+		Cursor:         cursor,
+		Messages:       make([]*protocol.CmdResponse, 0),
+	}
+
+	//多读一条判断是否还有下一页
+	switch collection {
+	case mongo_store.RECORD_P2P_MESSAGE_COLLECTION:
+		recordData, err := store.ReadP2PRecordMessageAfterSeq(mongo_store.DATA_BASE_NAME, collection, conversationID, cursor, limit+1)
+		if err != nil {
+			return nil, info.CODE_DATABASE_ERROR
+		}
+		if len(recordData) > limit {
+			recordData, page.More = recordData[:limit], true
+		}
+		for _, v := range recordData {
+			receive := protocol.NewCmdResponse(NCommendMappedMap[v.MsgType].ReceiveCmd)
+			receive.AddArg(v.Content)
+			receive.AddArg(v.FromID)
+			receive.AddArg(strconv.FormatInt(v.Time, 10))
+			receive.AddArg(v.UUID)
+			addSequenceArgs(receive, v.Seq, v.MsTime)
+			receive.Time = v.Time
+			page.Messages = append(page.Messages, receive)
+			page.Cursor = v.Seq
+		}
+		if len(recordData) > 0 {
+			store.MarkP2PRecordMessageToSeq(mongo_store.DATA_BASE_NAME, collection, conversationID, cid, page.Cursor)
+		}
+	case mongo_store.RECORD_TOPIC_MESSAGE_COLLECTION:
+		recordData, err := store.ReadTopicRecordMessageAfterSeq(mongo_store.DATA_BASE_NAME, collection, conversationID, cursor, limit+1)
+		if err != nil {
+			return nil, info.CODE_DATABASE_ERROR
+		}
+		if len(recordData) > limit {
+			recordData, page.More = recordData[:limit], true
+		}
+		for _, v := range recordData {
+			receive := protocol.NewCmdResponse(NCommendMappedMap[v.MsgType].ReceiveCmd)
+			receive.AddArg(v.Content)
+			receive.AddArg(v.ToID)
+			receive.AddArg(v.FromID)
+			receive.AddArg(strconv.FormatInt(v.Time, 10))
+			receive.AddArg(v.UUID)
+			addSequenceArgs(receive, v.Seq, v.MsTime)
+			receive.Time = v.Time
+			page.Messages = append(page.Messages, receive)
+			page.Cursor = v.Seq
+		}
+		if len(recordData) > 0 {
+			store.MarkTopicRecordMessageToSeq(mongo_store.DATA_BASE_NAME, collection, conversationID, cid, page.Cursor)
+		}
+	case mongo_store.RECORD_MUTUAL_MESSAGE_COLLECTION:
+		//请求在回应后才算已读
+		recordData, err := store.ReadMutualRecordMessageAfterSeq(mongo_store.DATA_BASE_NAME, collection, conversationID, cursor, limit+1)
+		if err != nil {
+			return nil, info.CODE_DATABASE_ERROR
+		}
+		if len(recordData) > limit {
+			recordData, page.More = recordData[:limit], true
+		}
+		for _, v := range recordData {
+			receive := protocol.NewCmdResponse(protocol.RECEIVE_ASK_CMD)
+			receive.AddArg(v.Type)
+			receive.AddArg(v.FromID)
+			receive.AddArg(strconv.FormatInt(v.Time, 10))
+			receive.AddArg(v.UUID)
+			receive.AddArg(strconv.FormatInt(v.Seq, 10))
+			receive.Time = v.Time
+			page.Messages = append(page.Messages, receive)
+			page.Cursor = v.Seq
+		}
+	}
+
+	return page, info.CODE_OK
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"goProject/info"
+	"goProject/storage/mongo_store"
+	"testing"
+
+	"github.com/funny/unitest"
+)
+
+func Test_ConversationCollection(t *testing.T) {
+	for _, v := range []struct {
+		id         string
+		collection string
+		topicId    string
+		code       int
+	}{
+		{"ask:aa", mongo_store.RECORD_MUTUAL_MESSAGE_COLLECTION, "", info.CODE_OK},
+		{"p2p:aa:bb", mongo_store.RECORD_P2P_MESSAGE_COLLECTION, "", info.CODE_OK},
+		{"p2p:0a:aa", mongo_store.RECORD_P2P_MESSAGE_COLLECTION, "", info.CODE_OK},
+		{"topic:t1", mongo_store.RECORD_TOPIC_MESSAGE_COLLECTION, "t1", info.CODE_OK},
+		//别人的请求和单聊
+		{"ask:bb", "", "", info.CODE_INVALID_ARGUMENTS},
+		{"p2p:bb:cc", "", "", info.CODE_INVALID_ARGUMENTS},
+		{"p2p:aa:aa", "", "", info.CODE_INVALID_ARGUMENTS},
+		//顺序不对或格式不对
+		{"p2p:bb:aa", "", "", info.CODE_INVALID_ARGUMENTS},
+		{"p2p:aa:bb:cc", "", "", info.CODE_INVALID_ARGUMENTS},
+		{"topic:", "", "", info.CODE_INVALID_ARGUMENTS},
+		{"aa", "", "", info.CODE_INVALID_ARGUMENTS},
+		{"", "", "", info.CODE_INVALID_ARGUMENTS},
+	} {
+		collection, topicId, code := conversationCollection("aa", v.id)
+		unitest.Pass(t, collection == v.collection)
+		unitest.Pass(t, topicId == v.topicId)
+		unitest.Pass(t, code == v.code)
+	}
+}
+
+func Test_TopicMemberCode(t *testing.T) {
+	topic := &mongo_store.TopicStoreData{TopicID: "t1", FounderID: "bb", ClientsID: []string{"aa", "bb"}}
+	unitest.Pass(t, topicMemberCode(topic, "aa") == info.CODE_OK)
+	unitest.Pass(t, topicMemberCode(topic, "cc") == info.CODE_YOU_WERE_NOT_IN_TOPIC)
+	unitest.Pass(t, topicMemberCode(nil, "aa") == info.CODE_TOPIC_DOES_NOT_EXISTS)
+}
@@ -31,25 +31,20 @@ func (self *ProtoProc) procSendGetToken(cmd protocol.Cmd, session *libnet.Sessio
 		tk                 *token.Token
 	)
 	if session.State == nil {
-		self.respCmd(protocol.RESP_GET_TOKEN, session, cmd.GetReport(), false, info.YOU_HAVE_NOT_LANDED)
+		self.respCmd(protocol.RESP_GET_TOKEN, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
 		return nil
 	}
 
-	if len(cmd.GetArgs()) < protocol.SEND_GET_TOKEN_ARGS_NUM {
-		log.Info(info.NOT_ENOUGH_ARGUMENTS)
-		self.respCmd(protocol.RESP_GET_TOKEN, session, cmd.GetReport(), false, info.NOT_ENOUGH_ARGUMENTS)
+	req, ok := self.payload(cmd, session, protocol.RESP_GET_TOKEN).(*protocol.GetTokenData)
+	if !ok {
 		return nil
 	}
 
-	if len(cmd.GetArgs()) > 1 {
-		actionType = cmd.GetArgs()[1]
-	} else {
+	actionType = req.ActionType
+	if actionType == "" {
 		actionType = token.TOKEN_ACTION_TYPE_ADD
 	}
-
-	if len(cmd.GetArgs()) > 2 {
-		compressOption = cmd.GetArgs()[2]
-	}
+	compressOption = req.Compress
 
 	clientIdAndAppName = session.State.(*base.SessionState).ClientID
 
@@ -65,7 +60,7 @@ func (self *ProtoProc) procSendGetToken(cmd protocol.Cmd, session *libnet.Sessio
 		appName = "defaultApp"
 	}
 
-	resType = cmd.GetArgs()[0]
+	resType = req.ResType
 	exTime = time.Now().Unix()
 	fileName = common.NewV4().String()[0:8]
 
@@ -0,0 +1,33 @@
+package protocol
+
+import (
+	"strconv"
+)
+
+//---------------------------------------------------------------------------
+// libnet.Session.Call用的协议
+// 请求id以字符串放在repo中,服务器回复时原样带回;repo不是id的是服务器推送的消息
+//---------------------------------------------------------------------------
+type CmdCallProtocol struct{}
+
+func (self CmdCallProtocol) NewMsg() interface{} {
+	return new(CmdResponse)
+}
+
+func (self CmdCallProtocol) SetCallId(req interface{}, id uint64) {
+	switch cmd := req.(type) {
+	case *CmdSimple:
+		cmd.Repo = strconv.FormatUint(id, 10)
+	case *CmdResponse:
+		cmd.Repo = strconv.FormatUint(id, 10)
+	}
+}
+
+func (self CmdCallProtocol) CallId(msg interface{}) (uint64, bool) {
+	repo, ok := msg.(*CmdResponse).Repo.(string)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(repo, 10, 64)
+	return id, err == nil
+}
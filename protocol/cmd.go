@@ -1,5 +1,9 @@
 package protocol
 
+import (
+	"goProject/libnet"
+)
+
 //---------------------------------------------------------------------------
 // General 通用协议
 //---------------------------------------------------------------------------
@@ -55,7 +59,7 @@ const (
 	SUBSCRIBE_CHANNEL_CMD = "subscribe_channel"
 	//SEND_MESSAGE_P2P send2msg send2ID toID
 	SEND_MESSAGE_P2P_CMD = "send_message_p2p"
-	//RESP_MESSAGE_P2P  msg fromID time uuid
+	//RESP_MESSAGE_P2P  uuid time seq msTime
 	RESP_MESSAGE_P2P_CMD = "resp_message_p2p"
 
 	SEND_NOTIFY_P2P_CMD = "send_notify_p2p"
@@ -64,7 +68,7 @@ const (
 	SEND_PUSH_P2P_CMD = "send_push_p2p"
 	RESP_PUSH_P2P_CMD = "resp_push_p2p"
 
-	//RECEIVE_MESSAGE_P2P_CMD
+	//RECEIVE_MESSAGE_P2P_CMD msg fromID time uuid seq msTime, seq为会话内递增的序号
 	RECEIVE_MESSAGE_P2P_CMD = "receive_message_p2p"
 	RECEIVE_NOTIFY_P2P_CMD  = "receive_notify_p2p"
 
@@ -102,13 +106,13 @@ const (
 	//SEND_MESSAGE_TOPIC_CMD send2msg topicId fromId
 
 	SEND_MESSAGE_TOPIC_CMD = "send_message_topic"
-	//RESP_MESSAGE_TOPIC_CMD
+	//RESP_MESSAGE_TOPIC_CMD uuid time seq msTime
 	RESP_MESSAGE_TOPIC_CMD = "resp_message_topic"
 
 	SEND_NOTIFY_TOPIC_CMD = "send_notify_topic"
 	RESP_NOTIFY_TOPIC_CMD = "resp_notify_topic"
 
-	//RECEIVE_MESSAGE_TOPIC_CMD send2Msg topicId fromId time uuid
+	//RECEIVE_MESSAGE_TOPIC_CMD send2Msg topicId fromId time uuid seq msTime
 	RECEIVE_MESSAGE_TOPIC_CMD = "receive_message_topic"
 	RECEIVE_NOTIFY_TOPIC_CMD  = "receive_notify_topic"
 
@@ -135,7 +139,7 @@ const (
 	// RESP_ASK_CMD
 	RESP_ASK_CMD = "resp_ask"
 
-	// RECEIVE_ASK_CMD
+	// RECEIVE_ASK_CMD type fromID time uuid seq
 	RECEIVE_ASK_CMD = "receive_ask"
 
 	//SEND_REACT_CMD type:add_friend,add_topic,invite_topic target
@@ -159,6 +163,11 @@ const (
 	SEND_GET_TOKEN = "send_get_token"
 	//RESP_GET_TOKEN TOKEN FILENAME PATH DOMAIN UPURL
 	RESP_GET_TOKEN = "resp_get_token"
+
+	//SEND_SYNC_CMD cursors conversation_id limit, 不带conversation_id时返回各会话的消息数
+	SEND_SYNC_CMD = "send_sync"
+	//RESP_SYNC_CMD 各会话的消息数或一页消息, 都是JSON
+	RESP_SYNC_CMD = "resp_sync"
 )
 const (
 	SEND_MESSAGE_P2P_CMD_ARGS_NUM           = 2
@@ -208,16 +217,16 @@ const (
 	//CHANGE_MESSAGE_SERVER_CMD cid (由router转发,如果用户在另外一台message_server登陆,就发送断开请求到另外一台服务器)
 	ROUTE_CHANGE_MESSAGE_SERVER_CMD = "route_change_message_server"
 
-	//ROUTE_MESSAGE_P2P_CMD  msg fromID time uuid
+	//ROUTE_MESSAGE_P2P_CMD  msg fromID toID time uuid seq msTime
 	ROUTE_MESSAGE_P2P_CMD = "route_message_p2p"
 	ROUTE_NOTIFY_P2P_CMD  = "route_notify_p2p"
 	ROUTE_PUSH_P2P_CMD = "route_push_p2p"
 
-	//ROUTE_MESSAGE_TOPIC_CMD
+	//ROUTE_MESSAGE_TOPIC_CMD msg topicID fromID time clients uuid seq msTime
 	ROUTE_MESSAGE_TOPIC_CMD = "route_message_topic"
 	ROUTE_NOTIFY_TOPIC_CMD  = "route_notify_topic"
 
-	//ROUTE_ASK_CMD
+	//ROUTE_ASK_CMD type fromID toID time uuid seq
 	ROUTE_ASK_CMD = "route_ask"
 )
 const (
@@ -273,6 +282,10 @@ type CmdSimple struct {
 	CmdName string      `json:"cmd"`
 	Args    []string    `json:"obj"`
 	Repo    interface{} `json:"repo"`
+	Version int         `json:"v,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	//ParsePayload解析出的数据
+	payload interface{}
 }
 
 func NewCmdSimple(cmdName string) *CmdSimple {
@@ -304,7 +317,7 @@ func (self *CmdSimple) ParseCmd(msglist []string) {
 }
 
 func (self *CmdSimple) GetAnyData() interface{} {
-	return nil
+	return self.payload
 }
 
 func (self *CmdSimple) GetReport() interface{} {
@@ -319,6 +332,8 @@ func (self *CmdSimple) GetReport() interface{} {
 type CmdResponse struct {
 	CmdName string      `json:"cmd"`
 	Ok      bool        `json:"ok"`
+	//错误码, 见info包的CODE_*, 0为成功
+	Code    int         `json:"code"`
 	Message string      `json:"msg"`
 	Args    []string    `json:"obj"`
 	Repo    interface{} `json:"repo"`
@@ -373,5 +388,7 @@ func NewCmdMonitor(serverType string, time int64, data string) *CmdMonitor {
 }
 
 type MsgServerMonitorData struct {
-	SessionNum uint64 `json:"session_num"`
+	SessionNum uint64                 `json:"session_num"`
+	SendStats  libnet.SendPolicyStats `json:"send_stats"`
+	Traffic    libnet.Metrics         `json:"traffic"`
 }
@@ -0,0 +1,223 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+)
+
+//---------------------------------------------------------------------------
+// 协议版本
+// 1: obj为按位置排列的字符串数组, 不带版本号的旧客户端
+// 2: 命令的数据放在data中, 每个命令有自己的结构, 登录时用v字段带上版本号
+// {"cmd":"send_message_p2p","v":2,"data":{"msg":"hello","to_id":"uid2"}}
+// 3: 同版本2, 登录后不再推送全部未读消息, 客户端用send_sync按各会话的游标分页拉取
+// 服务器两种格式都支持, 有data时按data解析, 否则按obj解析
+//---------------------------------------------------------------------------
+const (
+	PROTOCOL_VERSION_LEGACY = 1
+	PROTOCOL_VERSION_TYPED  = 2
+	PROTOCOL_VERSION_SYNC   = 3
+	//服务器支持的最高版本
+	PROTOCOL_VERSION = PROTOCOL_VERSION_SYNC
+)
+
+//---------------------------------------------------------------------------
+// 命令数据结构
+// 字段按声明顺序对应旧格式obj中的位置, 最后一个[]string字段取剩下的所有参数,
+// 整数字段在obj中为十进制字符串, map字段为JSON.
+// validate:"required"的字段不能为空
+//---------------------------------------------------------------------------
+
+//登录时可以带上客户端的语言, 如"zh-CN", 错误提示按这个语言返回
+type ClientIDData struct {
+	ClientID string `json:"client_id" validate:"required"`
+	Locale   string `json:"locale"`
+}
+
+type TokenData struct {
+	Token  string `json:"token" validate:"required"`
+	Locale string `json:"locale"`
+}
+
+//客户端可以带上自己的消息ID, 超时重发时服务器按它去重
+type MessageP2PData struct {
+	Msg         string `json:"msg" validate:"required"`
+	ToID        string `json:"to_id" validate:"required"`
+	ClientMsgID string `json:"client_msg_id"`
+}
+
+type MessageTopicData struct {
+	Msg         string `json:"msg" validate:"required"`
+	TopicID     string `json:"topic_id" validate:"required"`
+	ClientMsgID string `json:"client_msg_id"`
+}
+
+type TopicData struct {
+	TopicID string `json:"topic_id" validate:"required"`
+}
+
+type InviteTopicData struct {
+	TopicID string   `json:"topic_id" validate:"required"`
+	Members []string `json:"members" validate:"required"`
+}
+
+type AckData struct {
+	UUID string `json:"uuid" validate:"required"`
+}
+
+type FriendData struct {
+	FriendID string `json:"friend_id" validate:"required"`
+}
+
+type AskData struct {
+	Type   string `json:"type" validate:"required"`
+	Target string `json:"target" validate:"required"`
+}
+
+type ReactData struct {
+	Type string `json:"type" validate:"required"`
+	UUID string `json:"uuid" validate:"required"`
+}
+
+type GetTokenData struct {
+	ResType    string `json:"res_type" validate:"required"`
+	ActionType string `json:"action_type"`
+	Compress   string `json:"compress"`
+}
+
+//cursors为各会话已收到的最大序号, 不带conversation_id时返回各会话的消息数, 带上时拉取该会话游标之后的一页
+type SyncData struct {
+	Cursors        map[string]int64 `json:"cursors"`
+	ConversationID string           `json:"conversation_id"`
+	Limit          int              `json:"limit"`
+}
+
+//命令到数据结构, 没有登记的命令没有数据
+var payloadTypes = map[string]reflect.Type{
+	SEND_CLIENT_ID_CMD:          reflect.TypeOf(ClientIDData{}),
+	SEND_TOKEN_CMD:              reflect.TypeOf(TokenData{}),
+	SEND_MESSAGE_P2P_CMD:        reflect.TypeOf(MessageP2PData{}),
+	SEND_NOTIFY_P2P_CMD:         reflect.TypeOf(MessageP2PData{}),
+	SEND_MESSAGE_TOPIC_CMD:      reflect.TypeOf(MessageTopicData{}),
+	SEND_NOTIFY_TOPIC_CMD:       reflect.TypeOf(MessageTopicData{}),
+	SEND_CREATE_TOPIC_CMD:       reflect.TypeOf(TopicData{}),
+	SEND_JOIN_TOPIC_CMD:         reflect.TypeOf(TopicData{}),
+	SEND_LEAVE_TOPIC_CMD:        reflect.TypeOf(TopicData{}),
+	SEND_TOPIC_MEMBERS_LIST_CMD: reflect.TypeOf(TopicData{}),
+	SEND_INVITE_TOPIC_CMD:       reflect.TypeOf(InviteTopicData{}),
+	P2P_ACK_CMD:                 reflect.TypeOf(AckData{}),
+	TOPIC_ACK_CMD:               reflect.TypeOf(AckData{}),
+	SEND_ADD_FRIEND_CMD:         reflect.TypeOf(FriendData{}),
+	SEND_DEL_FRIEND_CMD:         reflect.TypeOf(FriendData{}),
+	SEND_CLIENT_ONLINE_STATUS:   reflect.TypeOf(FriendData{}),
+	SEND_ASK_CMD:                reflect.TypeOf(AskData{}),
+	SEND_REACT_CMD:              reflect.TypeOf(ReactData{}),
+	SEND_GET_TOKEN:              reflect.TypeOf(GetTokenData{}),
+	SEND_SYNC_CMD:               reflect.TypeOf(SyncData{}),
+}
+
+var (
+	ErrUnsupportedVersion = errors.New("Unsupported protocol version.")
+	ErrInvalidData        = errors.New("Invalid data.")
+)
+
+//缺少必填的字段
+type MissingFieldError struct {
+	Field string
+}
+
+func (self *MissingFieldError) Error() string {
+	return "There is not enough arguments, " + self.Field + " is required."
+}
+
+//不带版本号的是旧客户端
+func (self *CmdSimple) GetVersion() int {
+	if self.Version == 0 {
+		return PROTOCOL_VERSION_LEGACY
+	}
+	return self.Version
+}
+
+//把data或obj解析成命令的数据结构并校验, 之后用GetAnyData取得
+func (self *CmdSimple) ParsePayload() error {
+	if self.GetVersion() > PROTOCOL_VERSION {
+		return ErrUnsupportedVersion
+	}
+	t, ok := payloadTypes[self.CmdName]
+	if !ok {
+		return nil
+	}
+
+	v := reflect.New(t)
+	if self.Data != nil {
+		//JSON和MessagePack解出来的都是map, 转一次JSON得到结构
+		temp, err := json.Marshal(self.Data)
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(temp, v.Interface()); err != nil {
+			return ErrInvalidData
+		}
+	} else if err := payloadFromArgs(v.Elem(), self.Args); err != nil {
+		return err
+	}
+
+	if err := validatePayload(v.Elem()); err != nil {
+		return err
+	}
+	self.payload = v.Interface()
+	return nil
+}
+
+//旧格式按字段顺序取obj中的参数, 缺少的留空由校验报错
+func payloadFromArgs(v reflect.Value, args []string) error {
+	for i := 0; i < v.NumField() && i < len(args); i++ {
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.Slice:
+			field.Set(reflect.ValueOf(append([]string(nil), args[i:]...)))
+			return nil
+		case reflect.String:
+			field.SetString(args[i])
+		case reflect.Int, reflect.Int64:
+			if args[i] == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				return ErrInvalidData
+			}
+			field.SetInt(n)
+		default:
+			if args[i] == "" {
+				continue
+			}
+			if err := json.Unmarshal([]byte(args[i]), field.Addr().Interface()); err != nil {
+				return ErrInvalidData
+			}
+		}
+	}
+	return nil
+}
+
+func validatePayload(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("validate") != "required" {
+			continue
+		}
+		if field := v.Field(i); field.Len() == 0 {
+			return &MissingFieldError{payloadFieldName(t.Field(i))}
+		}
+	}
+	return nil
+}
+
+func payloadFieldName(field reflect.StructField) string {
+	if name := field.Tag.Get("json"); name != "" {
+		return name
+	}
+	return field.Name
+}
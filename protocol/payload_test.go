@@ -0,0 +1,103 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/funny/unitest"
+)
+
+func parseCmd(t *testing.T, text string) (*CmdSimple, error) {
+	var cmd CmdSimple
+	unitest.NotError(t, json.Unmarshal([]byte(text), &cmd))
+	return &cmd, cmd.ParsePayload()
+}
+
+func Test_ParsePayload_Data(t *testing.T) {
+	cmd, err := parseCmd(t, `{"cmd":"send_message_p2p","v":2,"data":{"msg":"hello","to_id":"uid2"}}`)
+	unitest.NotError(t, err)
+	unitest.Pass(t, cmd.GetVersion() == PROTOCOL_VERSION_TYPED)
+	data := cmd.GetAnyData().(*MessageP2PData)
+	unitest.Pass(t, data.Msg == "hello")
+	unitest.Pass(t, data.ToID == "uid2")
+	unitest.Pass(t, data.ClientMsgID == "")
+
+	cmd, err = parseCmd(t, `{"cmd":"send_invite_topic","v":2,"data":{"topic_id":"t1","members":["a","b"]}}`)
+	unitest.NotError(t, err)
+	invite := cmd.GetAnyData().(*InviteTopicData)
+	unitest.Pass(t, invite.TopicID == "t1")
+	unitest.Pass(t, len(invite.Members) == 2 && invite.Members[1] == "b")
+}
+
+func Test_ParsePayload_Args(t *testing.T) {
+	cmd, err := parseCmd(t, `{"cmd":"send_message_p2p","obj":["hello","uid2"]}`)
+	unitest.NotError(t, err)
+	unitest.Pass(t, cmd.GetVersion() == PROTOCOL_VERSION_LEGACY)
+	data := cmd.GetAnyData().(*MessageP2PData)
+	unitest.Pass(t, data.Msg == "hello")
+	unitest.Pass(t, data.ToID == "uid2")
+
+	//最后一个[]string字段取剩下的所有参数
+	cmd, err = parseCmd(t, `{"cmd":"send_invite_topic","obj":["t1","a","b","c"]}`)
+	unitest.NotError(t, err)
+	invite := cmd.GetAnyData().(*InviteTopicData)
+	unitest.Pass(t, invite.TopicID == "t1")
+	unitest.Pass(t, len(invite.Members) == 3 && invite.Members[2] == "c")
+
+	//有data时不看obj
+	cmd, err = parseCmd(t, `{"cmd":"send_client_id","obj":["old"],"v":2,"data":{"client_id":"new"}}`)
+	unitest.NotError(t, err)
+	unitest.Pass(t, cmd.GetAnyData().(*ClientIDData).ClientID == "new")
+}
+
+func Test_ParsePayload_Errors(t *testing.T) {
+	_, err := parseCmd(t, `{"cmd":"send_message_p2p","obj":["hello"]}`)
+	missing, ok := err.(*MissingFieldError)
+	unitest.Pass(t, ok && missing.Field == "to_id")
+
+	_, err = parseCmd(t, `{"cmd":"send_message_p2p","v":2,"data":{"to_id":"uid2"}}`)
+	missing, ok = err.(*MissingFieldError)
+	unitest.Pass(t, ok && missing.Field == "msg")
+
+	_, err = parseCmd(t, `{"cmd":"send_invite_topic","obj":["t1"]}`)
+	missing, ok = err.(*MissingFieldError)
+	unitest.Pass(t, ok && missing.Field == "members")
+
+	_, err = parseCmd(t, `{"cmd":"send_message_p2p","v":2,"data":{"msg":1,"to_id":"uid2"}}`)
+	unitest.Pass(t, err == ErrInvalidData)
+
+	_, err = parseCmd(t, `{"cmd":"send_message_p2p","v":99,"data":{"msg":"hello","to_id":"uid2"}}`)
+	unitest.Pass(t, err == ErrUnsupportedVersion)
+}
+
+//没有登记数据结构的命令不解析
+func Test_ParsePayload_NoPayload(t *testing.T) {
+	cmd, err := parseCmd(t, `{"cmd":"send_ping","obj":[]}`)
+	unitest.NotError(t, err)
+	unitest.Pass(t, cmd.GetAnyData() == nil)
+}
+
+//map字段在obj中为JSON, 整数为十进制字符串, 空的参数不解析
+func Test_ParsePayload_Sync(t *testing.T) {
+	cmd, err := parseCmd(t, `{"cmd":"send_sync","obj":["{\"p2p:aa:bb\":12}","p2p:aa:bb","20"]}`)
+	unitest.NotError(t, err)
+	data := cmd.GetAnyData().(*SyncData)
+	unitest.Pass(t, data.Cursors["p2p:aa:bb"] == 12)
+	unitest.Pass(t, data.ConversationID == "p2p:aa:bb")
+	unitest.Pass(t, data.Limit == 20)
+
+	cmd, err = parseCmd(t, `{"cmd":"send_sync","obj":["","",""]}`)
+	unitest.NotError(t, err)
+	data = cmd.GetAnyData().(*SyncData)
+	unitest.Pass(t, data.Cursors == nil && data.Limit == 0)
+
+	cmd, err = parseCmd(t, `{"cmd":"send_sync","v":3,"data":{"cursors":{"topic:t1":30},"conversation_id":"topic:t1"}}`)
+	unitest.NotError(t, err)
+	data = cmd.GetAnyData().(*SyncData)
+	unitest.Pass(t, data.Cursors["topic:t1"] == 30)
+
+	_, err = parseCmd(t, `{"cmd":"send_sync","obj":["","p2p:aa:bb","many"]}`)
+	unitest.Pass(t, err == ErrInvalidData)
+	_, err = parseCmd(t, `{"cmd":"send_sync","obj":["[1]"]}`)
+	unitest.Pass(t, err == ErrInvalidData)
+}
@@ -55,6 +55,19 @@ func handleSession(rs *Router, session *libnet.Session) {
 	}
 }
 
+func serve(cfg *RouterConfig) (*libnet.Server, error) {
+	codecType := libnet.Packet(libnet.Uint16BE, libnet.Json())
+	if !cfg.TLS.Enable {
+		return libnet.Serve(cfg.TransportProtocols, ":"+cfg.Listen, codecType)
+	}
+
+	tlsConfig, err := cfg.TLS.ServerConfig()
+	if err != nil {
+		return nil, err
+	}
+	return libnet.ServeTLS(cfg.TransportProtocols, ":"+cfg.Listen, tlsConfig, codecType)
+}
+
 func main() {
 	version()
 	fmt.Printf("built on %s\n", BuildTime())
@@ -68,7 +81,7 @@ func main() {
 
 	rs := NewRouter(cfg)
 
-	rs.server, err = libnet.Serve(cfg.TransportProtocols, ":"+cfg.Listen, libnet.Packet(libnet.Uint16BE, libnet.Json()))
+	rs.server, err = serve(cfg)
 	if err != nil {
 		log.Error(err.Error())
 		return
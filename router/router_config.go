@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"goProject/libnet"
 	"goProject/log"
 	"os"
 	"time"
@@ -12,6 +13,7 @@ type RouterConfig struct {
 	TransportProtocols    string
 	LocalIP               string
 	Listen                string
+	TLS                   libnet.TLSConfig
 	LogFile               string
 	ScanDeadServerTimeout time.Duration
 	HeartBeatTime         time.Duration
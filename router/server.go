@@ -41,7 +41,16 @@ func NewRouter(cfg *RouterConfig) *Router {
 
 //连接msgServer
 func (self *Router) connectServer(ms string) (*libnet.Session, error) {
-	client, err := libnet.Connect("tcp", ms, libnet.Packet(libnet.Uint16BE, libnet.Json()))
+	codecType := libnet.Packet(libnet.Uint16BE, libnet.Json())
+	if self.cfg.TLS.Enable {
+		tlsConfig, err := self.cfg.TLS.ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		return libnet.ConnectTLS("tcp", ms, tlsConfig, codecType)
+	}
+
+	client, err := libnet.Connect("tcp", ms, codecType)
 	if err != nil {
 		// log.Error(err.Error())
 		return nil, err
@@ -50,78 +59,89 @@ func (self *Router) connectServer(ms string) (*libnet.Session, error) {
 	return client, err
 }
 
-//连接未连接的MsgServerList
-func (self *Router) connectDisconnectedMsgServerList() {
-	for _, ms := range self.disConnectedMsgServerList {
-		msgServerClient, err := self.connectServer(ms)
-		if err == nil {
-			log.Info(ms, " : connected")
-
-			err = self.connectMsgServerCommands(msgServerClient)
-			if err != nil {
-				log.Error(err.Error())
-			}
-
-			self.msgServerMutex.Lock()
+//连接MsgServer,断开后按退避时间自动重连
+func (self *Router) dialMsgServer(ms string) {
+	dialer := libnet.NewDialer(func() (*libnet.Session, error) {
+		return self.connectServer(ms)
+	}, func(msgServerClient *libnet.Session) error {
+		//每次重连后重新订阅
+		err := self.connectMsgServerCommands(msgServerClient)
+		if err != nil {
+			return err
+		}
 
+		go self.heartBeatWithMsgServer(msgServerClient, ms)
+		go self.receiveFromServer(msgServerClient)
+		return nil
+	})
+	dialer.SetBackoff(time.Second, self.cfg.ScanDeadServerTimeout*time.Second)
+	dialer.OnState(func(dialer *libnet.Dialer, state int, err error) {
+		self.msgServerMutex.Lock()
+		defer self.msgServerMutex.Unlock()
+
+		switch state {
+		case libnet.DIAL_CONNECTED:
+			log.Info(ms, " : connected")
 			self.disConnectedMsgServerList = common.DeleteChild(self.disConnectedMsgServerList, ms)
 			self.connectedMsgServerList = append(self.connectedMsgServerList, ms)
-			self.msgServerClientMap[ms] = msgServerClient
-
-			self.msgServerMutex.Unlock()
-
-			go self.heartBeatWithMsgServer(msgServerClient, ms)
-			go func() {
-				for {
-					var msg protocol.CmdSimple
-					if err := msgServerClient.Receive(&msg); err != nil {
-						break
-					}
-
-					err := self.parseProtocol(msg, msgServerClient)
-					if err != nil {
-						log.Error(err.Error())
-					}
-				}
-			}()
+			self.msgServerClientMap[ms] = dialer.Session()
+		case libnet.DIAL_DISCONNECTED:
+			log.Info(ms, " : disconnect")
+			self.connectedMsgServerList = common.DeleteChild(self.connectedMsgServerList, ms)
+			self.disConnectedMsgServerList = append(self.disConnectedMsgServerList, ms)
+			delete(self.msgServerClientMap, ms)
 		}
-	}
+	})
+	dialer.Start()
 }
 
-//连接未连接的BrotherList
-func (self *Router) connectDisconnectedBrotherServerList() {
-	for _, rs := range self.disConnectedBrotherServerList {
-		brotherServerClient, err := self.connectServer(rs)
-		if err == nil {
-			log.Info(rs, " : connected")
-
-			err = self.connectBrotherServerCommands(brotherServerClient)
-			if err != nil {
-				log.Error(err.Error())
-			}
-
-			self.brotherServerMutex.Lock()
+//连接BrotherServer,断开后按退避时间自动重连
+func (self *Router) dialBrotherServer(rs string) {
+	dialer := libnet.NewDialer(func() (*libnet.Session, error) {
+		return self.connectServer(rs)
+	}, func(brotherServerClient *libnet.Session) error {
+		//每次重连后重新订阅
+		err := self.connectBrotherServerCommands(brotherServerClient)
+		if err != nil {
+			return err
+		}
 
+		go self.heartBeatWithBrotherServer(brotherServerClient, rs)
+		go self.receiveFromServer(brotherServerClient)
+		return nil
+	})
+	dialer.SetBackoff(time.Second, self.cfg.ScanDeadServerTimeout*time.Second)
+	dialer.OnState(func(dialer *libnet.Dialer, state int, err error) {
+		self.brotherServerMutex.Lock()
+		defer self.brotherServerMutex.Unlock()
+
+		switch state {
+		case libnet.DIAL_CONNECTED:
+			log.Info(rs, " : connected")
 			self.disConnectedBrotherServerList = common.DeleteChild(self.disConnectedBrotherServerList, rs)
 			self.connectedBrotherServerList = append(self.connectedBrotherServerList, rs)
-			self.brotherServerClientMap[rs] = brotherServerClient
-
-			self.brotherServerMutex.Unlock()
-
-			go self.heartBeatWithBrotherServer(brotherServerClient, rs)
-			go func() {
-				for {
-					var msg protocol.CmdSimple
-					if err := brotherServerClient.Receive(&msg); err != nil {
-						break
-					}
-
-					err := self.parseProtocol(msg, brotherServerClient)
-					if err != nil {
-						log.Error(err.Error())
-					}
-				}
-			}()
+			self.brotherServerClientMap[rs] = dialer.Session()
+		case libnet.DIAL_DISCONNECTED:
+			log.Info(rs, " : disconnect")
+			self.connectedBrotherServerList = common.DeleteChild(self.connectedBrotherServerList, rs)
+			self.disConnectedBrotherServerList = append(self.disConnectedBrotherServerList, rs)
+			delete(self.brotherServerClientMap, rs)
+		}
+	})
+	dialer.Start()
+}
+
+//接收Server过来的命令,连接断开时返回
+func (self *Router) receiveFromServer(serverClient *libnet.Session) {
+	for {
+		var msg protocol.CmdSimple
+		if err := serverClient.Receive(&msg); err != nil {
+			break
+		}
+
+		err := self.parseProtocol(msg, serverClient)
+		if err != nil {
+			log.Error(err.Error())
 		}
 	}
 }
@@ -143,22 +163,6 @@ func (self *Router) getBrotherManageServers() {
 	}
 }
 
-//扫描没有连接的Server
-func (self *Router) scanDisconnectServer() {
-	log.Info("scanDisconnectServer")
-	timer := time.NewTicker(self.cfg.ScanDeadServerTimeout * time.Second)
-	ttl := time.After(10 * time.Second)
-	for {
-		select {
-		case <-timer.C:
-			go self.connectDisconnectedMsgServerList()
-			go self.connectDisconnectedBrotherServerList()
-		case <-ttl:
-			break
-		}
-	}
-}
-
 //刷新获取连接
 func (self *Router) refreshManageServers() {
 	log.Info("refreshManageServers")
@@ -214,16 +218,7 @@ xf:
 			cmd := protocol.NewCmdSimple(protocol.SEND_PING_CMD)
 			err := msgServerClient.Send(cmd)
 			if err != nil {
-				log.Info(ms, " : disconnect")
-
-				self.msgServerMutex.Lock()
-
-				self.connectedMsgServerList = common.DeleteChild(self.connectedMsgServerList, ms)
-				self.disConnectedMsgServerList = append(self.disConnectedMsgServerList, ms)
-				delete(self.msgServerClientMap, ms)
-
-				self.msgServerMutex.Unlock()
-
+				//连接已关闭,由dialer重连
 				break xf
 			}
 		case <-ttl:
@@ -245,16 +240,7 @@ xe:
 			cmd := protocol.NewCmdSimple(protocol.SEND_PING_CMD)
 			err := brotherServerClient.Send(cmd)
 			if err != nil {
-				log.Info(rs, " : disconnect")
-
-				self.brotherServerMutex.Lock()
-
-				self.connectedBrotherServerList = common.DeleteChild(self.connectedBrotherServerList, rs)
-				self.disConnectedBrotherServerList = append(self.disConnectedBrotherServerList, rs)
-				delete(self.brotherServerClientMap, rs)
-
-				self.brotherServerMutex.Unlock()
-
+				//连接已关闭,由dialer重连
 				break xe
 			}
 		case <-ttl:
@@ -279,11 +265,14 @@ func (self *Router) subscribeChannels() error {
 	self.disConnectedMsgServerList = self.cfg.MsgServerList
 	self.disConnectedBrotherServerList = self.cfg.BrotherServerList
 
-	go self.connectDisconnectedMsgServerList()
-	go self.connectDisconnectedBrotherServerList()
+	for _, ms := range self.cfg.MsgServerList {
+		self.dialMsgServer(ms)
+	}
+	for _, rs := range self.cfg.BrotherServerList {
+		self.dialBrotherServer(rs)
+	}
 	self.getBrotherManageServers()
 
-	go self.scanDisconnectServer()
 	go self.refreshManageServers()
 
 	return err
@@ -21,6 +21,7 @@ type Member struct {
 	Name       string
 	CPU        int
 	SessionNum uint64
+	Overload   bool
 }
 
 func NewMaster(endpoints []string) *Master {
@@ -50,6 +51,7 @@ func (m *Master) AddWorker(info *WorkerInfo) {
 		Name:       info.Name,
 		CPU:        info.CPU,
 		SessionNum: info.SessionNum,
+		Overload:   info.Overload,
 	}
 	m.Members[member.Name] = member
 }
@@ -61,6 +63,7 @@ func (m *Master) UpdateWorker(info *WorkerInfo) {
 		Name:       info.Name,
 		CPU:        info.CPU,
 		SessionNum: info.SessionNum,
+		Overload:   info.Overload,
 	}
 	m.Members[info.Name] = member
 }
@@ -96,7 +99,8 @@ func (m *Master) WatchWorkers() {
 				m.AddWorker(&info)
 			}
 		} else if res.Action == "delete" {
-			delete(m.Members, res.Node.Key)
+			key := common.Substr(res.Node.Key, len("/workers/"), len(res.Node.Key)-len("/workers/"))
+			delete(m.Members, key)
 		}
 	}
 
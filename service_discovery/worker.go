@@ -21,6 +21,7 @@ type WorkerInfo struct {
 	IP         string
 	CPU        int
 	SessionNum uint64
+	Overload   bool
 }
 
 func NewWorker(name, IP string, endpoints []string) *Worker {
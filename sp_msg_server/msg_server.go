@@ -12,6 +12,7 @@ import (
 	"os/signal"
 	"runtime/pprof"
 	"syscall"
+	"time"
 )
 
 /*
@@ -61,6 +62,8 @@ func handleSession(ms *MsgServer, session *libnet.Session) {
 			log.Error(err.Error())
 		}
 	}
+
+	ms.closeSession(session)
 }
 
 func main() {
@@ -103,8 +106,6 @@ func main() {
 
 	ms.createChannels()
 
-	go ms.scanDeadSession()
-
 	go ms.sendMonitorData()
 
 	// go ms.sendServiceDiscoveryData()
@@ -117,6 +118,7 @@ func main() {
 			break
 		}
 
+		session.SetIdleTimeout(cfg.ReadIdleTimeout*time.Second, cfg.WriteIdleTimeout*time.Second, ms.sessionIdle)
 		go handleSession(ms, session)
 	}
 }
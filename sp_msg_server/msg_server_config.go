@@ -15,6 +15,8 @@ type MsgServerConfig struct {
 	LogFile                  string
 	EtcdServer               string
 	ScanDeadSessionTimeout   time.Duration
+	ReadIdleTimeout          time.Duration
+	WriteIdleTimeout         time.Duration
 	ScanTimeoutAck           time.Duration
 	Expire                   time.Duration
 	MonitorBeatTime          time.Duration
@@ -32,6 +34,8 @@ type MsgServerConfig struct {
 		User     string
 		Password string
 	}
+	VerifyTokenServer string
+	VerifyTokenUrl    string
 }
 
 func NewMsgServerConfig(configfile string) *MsgServerConfig {
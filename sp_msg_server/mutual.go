@@ -54,9 +54,13 @@ func (self *ProtoProc) procAsk(cmd protocol.Cmd, session *libnet.Session) error
 	send2Time := time.Now().Unix()
 	uuid := common.NewV4().String()
 
-	//保存消息到mongodb中
-	data := mongo_store.MutualRecordMessageData{clientId, friendId, msgType, send2Time, uuid, false}
-	err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_MUTUAL_MESSAGE_COLLECTION, &data)
+	//保存消息到mongodb中, 和msg_server共用请求序号
+	conversationID := mongo_store.AskConversationID(friendId)
+	seq, err := self.msgServer.mongoStore.NextSequence(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_SEQUENCE_COLLECTION, conversationID)
+	data := mongo_store.MutualRecordMessageData{clientId, friendId, msgType, send2Time, uuid, false, conversationID, seq}
+	if err == nil {
+		err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_MUTUAL_MESSAGE_COLLECTION, &data)
+	}
 	if err != nil {
 		log.Error("error:", err)
 		return err
@@ -10,6 +10,8 @@ import (
 	"goProject/log"
 	"goProject/protocol"
 	"goProject/storage/mongo_store"
+	"io/ioutil"
+	"net/http"
 	// "gopkg.in/mgo.v2/json"
 	"strconv"
 	"sync"
@@ -77,11 +79,7 @@ func (self *ProtoProc) procPing(cmd protocol.Cmd, session *libnet.Session) error
 		return nil
 	}
 
-	self.msgServer.scanSessionMutex.Lock()
-	self.msgServer.sessions[cid].State.(*base.SessionState).Alive = true
-	self.msgServer.scanSessionMutex.Unlock()
-
-	self.msgServer.mongoStore.UpdateSessionAlive(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, cid, true)
+	self.msgServer.mongoStore.UpdateSessionAlive(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, cid, self.msgServer.cfg.LocalIP, true)
 
 	//PONG
 	err := session.Send(resp)
@@ -238,8 +236,11 @@ func (self *ProtoProc) procClientID(cmd protocol.Cmd, session *libnet.Session) e
 	}
 
 	self.msgServer.sessions[ClientID] = session
-	self.msgServer.sessions[ClientID].State = base.NewSessionState(ClientID, true,
-		session.Conn().RemoteAddr().String(), self.msgServer.cfg.LocalIP)
+	state := base.NewSessionState(ClientID, time.Now().Unix())
+	if req, ok := self.payload(cmd, session, "").(*protocol.ClientIDData); ok {
+		state.Locale = info.Locale(req.Locale)
+	}
+	self.msgServer.sessions[ClientID].State = state
 
 	err = session.Send(resp)
 	if err != nil {
@@ -249,6 +250,120 @@ func (self *ProtoProc) procClientID(cmd protocol.Cmd, session *libnet.Session) e
 	return err
 }
 
+//接收用户登录Token
+func (self *ProtoProc) procToken(cmd protocol.Cmd, session *libnet.Session) error {
+	log.Info("procToken")
+	var (
+		err       error
+		tokenData GetTokenTemplate
+		ClientID  string
+		Platform  string
+		resp      *http.Response
+		temp      []byte
+	)
+
+	req, ok := self.payload(cmd, session, protocol.RESP_TOKEN_CMD).(*protocol.TokenData)
+	if !ok {
+		self.clientQuit(session)
+		return nil
+	}
+
+	resp, err = http.Get(self.msgServer.cfg.VerifyTokenServer + self.msgServer.cfg.VerifyTokenUrl + "?IMToken=" + req.Token)
+	if err != nil {
+		log.Error("Error:", err)
+		self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), info.CODE_UNABLE_TO_ACCESS_THE_AUTH_SERVER)
+		self.clientQuit(session)
+		return err
+	}
+
+	defer resp.Body.Close()
+	temp, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Error("Error:", err)
+		self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), info.CODE_FAILED_TO_PARSE_DATA)
+		self.clientQuit(session)
+		return err
+	}
+
+	err = json.Unmarshal(temp, &tokenData)
+	if err != nil {
+		log.Error("Error:", err)
+		self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), info.CODE_FAILED_TO_PARSE_DATA)
+		self.clientQuit(session)
+		return err
+	}
+
+	if tokenData.Status != "0" {
+		self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), info.CODE_INVALID_TOKEN)
+		self.clientQuit(session)
+		return nil
+	}
+	ClientID = tokenData.UserId
+	Platform = tokenData.Platform
+
+	if len(ClientID) < 1 {
+		log.Info(info.NOT_ENOUGH_ARGUMENTS)
+		self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), info.CODE_NOT_ENOUGH_ARGUMENTS)
+		self.clientQuit(session)
+		return nil
+	}
+
+	//查找用户信息
+	friends := []string{}
+	clientInfo, err := self.msgServer.mongoStore.GetClientFromId(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, ClientID)
+	if err != nil {
+		log.Error(err.Error())
+	}
+	if clientInfo != nil {
+		friends = clientInfo.Friends
+		if clientInfo.Alive == true {
+			log.Info("User is logined in.")
+
+			//如果用户已经登陆，就断开其他已经存在的连接
+			if clientInfo.MsgServerAddr != self.msgServer.cfg.LocalIP {
+				routerMsg := protocol.NewCmdResponse(protocol.SEND_CHANGE_MESSAGE_SERVER_CMD)
+				routerMsg.AddArg(ClientID)
+				routerMsg.AddArg(clientInfo.MsgServerAddr)
+				err = self.msgServer.channels[protocol.SYSCTRL_SEND].Channel.Broadcast(routerMsg)
+				if err != nil {
+					log.Error(err.Error())
+					self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), info.CODE_ROUTE_ERROR)
+					return err
+				}
+			} else {
+				if self.msgServer.sessions[ClientID] != nil {
+					sMsg := protocol.NewCmdResponse(protocol.RESP_LOGOUT_CMD)
+					setCode(sMsg, self.msgServer.sessions[ClientID], info.CODE_YOU_HAVE_TO_RE_LOGIN)
+					err = self.msgServer.sessions[ClientID].Send(sMsg)
+					if err != nil {
+						log.Error(err.Error())
+					}
+					self.msgServer.sessions[ClientID].Close()
+					self.deleteWithMutex(self.msgServer.sessions, ClientID, self.msgServer.scanSessionMutex)
+				}
+			}
+		}
+	}
+
+	// update login info
+	sessionStoreData := mongo_store.SessionStoreData{ClientID, session.Conn().RemoteAddr().String(),
+		self.msgServer.cfg.LocalIP, friends, true, Platform}
+	err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, &sessionStoreData)
+	if err != nil {
+		log.Error(err.Error())
+		self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
+		return err
+	}
+
+	self.msgServer.sessions[ClientID] = session
+	state := base.NewSessionState(ClientID, time.Now().Unix())
+	state.Locale = info.Locale(req.Locale)
+	self.msgServer.sessions[ClientID].State = state
+
+	self.respCmd(protocol.RESP_TOKEN_CMD, session, cmd.GetReport(), info.CODE_OK)
+	return nil
+}
+
 //退出登录
 func (self *ProtoProc) procLogout(cmd protocol.Cmd, session *libnet.Session) error {
 	log.Info("procLogout")
@@ -260,7 +375,7 @@ func (self *ProtoProc) procLogout(cmd protocol.Cmd, session *libnet.Session) err
 	clientID := session.State.(*base.SessionState).ClientID
 	if clientID != "" {
 		// 标记用户离线
-		err := self.msgServer.mongoStore.UpdateSessionAlive(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, clientID, false)
+		_, err := self.msgServer.mongoStore.UpdateSessionAlive(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, clientID, self.msgServer.cfg.LocalIP, false)
 		if err != nil {
 			log.Error(err.Error())
 		}
@@ -296,16 +411,22 @@ func (self *ProtoProc) procSendMessageP2P(cmd protocol.Cmd, session *libnet.Sess
 	fromID := cmd.GetArgs()[0]
 	send2Msg := cmd.GetArgs()[1]
 	send2ID := cmd.GetArgs()[2]
-	send2Time := time.Now().Unix()
+	now := time.Now()
+	send2Time := now.Unix()
 	uuid := common.NewV4().String()
 
 	//定义返回用户请求信息
 	resp := protocol.NewCmdResponse(NCommendMappedMap[msgType].RespCmd)
 	resp.Repo = cmd.GetReport()
 
-	//保存消息到mongodb中
-	data := mongo_store.P2PRecordMessageData{msgType, fromID, send2ID, send2Msg, send2Time, uuid, false}
-	err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_P2P_MESSAGE_COLLECTION, &data)
+	//保存消息到mongodb中, 和msg_server共用会话序号
+	conversationID := mongo_store.P2PConversationID(fromID, send2ID)
+	seq, err := self.msgServer.mongoStore.NextSequence(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_SEQUENCE_COLLECTION, conversationID)
+	if err == nil {
+		data := mongo_store.P2PRecordMessageData{msgType, fromID, send2ID, send2Msg, send2Time, uuid, false, "",
+			conversationID, seq, now.UnixNano() / int64(time.Millisecond)}
+		err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_P2P_MESSAGE_COLLECTION, &data)
+	}
 	if err != nil {
 		log.Error(err.Error())
 		resp.Message = info.ERROR
@@ -550,6 +671,95 @@ func (self *ProtoProc) procJoinTopic(cmd protocol.Cmd, session *libnet.Session)
 	return nil
 }
 
+//邀请加入
+func (self *ProtoProc) procInviteTopic(cmd protocol.Cmd, session *libnet.Session) error {
+	log.Info("procInviteTopic")
+	var err error
+
+	if session.State == nil {
+		self.respCmd(protocol.RESP_INVITE_TOPIC_CMD, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
+		return nil
+	}
+	req, ok := self.payload(cmd, session, protocol.RESP_INVITE_TOPIC_CMD).(*protocol.InviteTopicData)
+	if !ok {
+		return nil
+	}
+
+	// resp_invite_topic false Join topic failure.
+
+	//定义返回用户请求信息
+	resp := protocol.NewCmdResponse(protocol.RESP_INVITE_TOPIC_CMD)
+	resp.Time = time.Now().Unix()
+	resp.Repo = cmd.GetReport()
+
+	//群组ID
+	topicId := req.TopicID
+	clientId := session.State.(*base.SessionState).ClientID
+	friendList := req.Members
+
+	//判断群组是否存在
+	result := self.msgServer.mongoStore.GetTopicFromTopicID(mongo_store.DATA_BASE_NAME, mongo_store.TOPIC_INFO_COLLECTION, topicId)
+	if result == nil {
+		log.Error(info.TOPIC_DOES_NOT_EXISTS)
+		self.respCmd(protocol.RESP_INVITE_TOPIC_CMD, session, cmd.GetReport(), info.CODE_TOPIC_DOES_NOT_EXISTS)
+		return err
+	}
+
+	//判断用户是否属于该群组
+	users := result.ClientsID
+	if !common.InArray(users, clientId) {
+		log.Error(info.YOU_WERE_NOT_IN_TOPIC)
+		self.respCmd(protocol.RESP_INVITE_TOPIC_CMD, session, cmd.GetReport(), info.CODE_YOU_WERE_NOT_IN_TOPIC)
+		return err
+	}
+
+	//加入
+	readyToJoinTopic := []string{}
+	for i := 0; i < len(friendList); i++ {
+		if !common.InArray(users, friendList[i]) {
+			users = append(users, friendList[i])
+			readyToJoinTopic = append(readyToJoinTopic, friendList[i])
+		}
+	}
+
+	//执行加入操作
+	TopicStoreData := mongo_store.TopicStoreData{topicId, clientId, users}
+	err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.TOPIC_INFO_COLLECTION, &TopicStoreData)
+	if err != nil {
+		log.Error(err.Error())
+		self.respCmd(protocol.RESP_INVITE_TOPIC_CMD, session, cmd.GetReport(), info.CODE_JOIN_TOPIC_FAILURE)
+		return err
+	}
+
+	if len(readyToJoinTopic) > 0 {
+		for i := 0; i < len(readyToJoinTopic); i++ {
+			resp.AddArg(readyToJoinTopic[i])
+		}
+	} else {
+		setCode(resp, session, info.CODE_JOIN_TOPIC_FAILURE)
+	}
+
+	//返回用户请求
+	err = session.Send(resp)
+	if err != nil {
+		log.Error(err.Error())
+		return err
+	}
+
+	if len(readyToJoinTopic) > 0 {
+		for i := 0; i < len(readyToJoinTopic); i++ {
+			// user string, timeNow int64
+			err = self.msgServer.mongoStore.MarkTopicRecordMessageFromUserAndTime(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_TOPIC_MESSAGE_COLLECTION, readyToJoinTopic[i], time.Now().Unix(), topicId)
+			if err != nil {
+				log.Error(err.Error())
+				return err
+			}
+		}
+	}
+
+	return err
+}
+
 //离开Topic
 func (self *ProtoProc) procLeaveTopic(cmd protocol.Cmd, session *libnet.Session) error {
 	log.Info("procLeaveTopic")
@@ -738,7 +948,8 @@ func (self *ProtoProc) procSendMessageTopic(cmd protocol.Cmd, session *libnet.Se
 	send2Msg := cmd.GetArgs()[1]
 	topicId := cmd.GetArgs()[2]
 
-	send2Time := time.Now().Unix()
+	now := time.Now()
+	send2Time := now.Unix()
 	uuid := common.NewV4().String()
 
 	//定义返回用户请求信息
@@ -793,9 +1004,14 @@ func (self *ProtoProc) procSendMessageTopic(cmd protocol.Cmd, session *libnet.Se
 		onlineUsers = append(onlineUsers, v.ClientID)
 	}
 
-	//保存消息到mongodb中
-	data := mongo_store.TopicRecordMessageData{msgType, fromID, topicId, send2Msg, send2Time, uuid, []string{}}
-	err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_TOPIC_MESSAGE_COLLECTION, &data)
+	//保存消息到mongodb中, 和msg_server共用会话序号
+	conversationID := mongo_store.TopicConversationID(topicId)
+	seq, err := self.msgServer.mongoStore.NextSequence(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_SEQUENCE_COLLECTION, conversationID)
+	if err == nil {
+		data := mongo_store.TopicRecordMessageData{msgType, fromID, topicId, send2Msg, send2Time, uuid, []string{}, "",
+			conversationID, seq, now.UnixNano() / int64(time.Millisecond)}
+		err = self.msgServer.mongoStore.Upsert(mongo_store.DATA_BASE_NAME, mongo_store.RECORD_TOPIC_MESSAGE_COLLECTION, &data)
+	}
 	if err != nil {
 		log.Error(err.Error())
 		//返回用户请求
@@ -1041,3 +1257,114 @@ func (self *ProtoProc) deleteWithMutex(parent interface{}, children string, dMut
 		delete(parent.(base.AckMap), children)
 	}
 }
+
+//获取在线好友信息
+func (self *ProtoProc) procClientOnlineStatus(cmd protocol.Cmd, session *libnet.Session) error {
+	log.Info("procClientOnlineStatus")
+	var err error
+
+	if session.State == nil {
+		self.respCmd(protocol.RESP_CLIENT_ONLINE_STATUS, session, cmd.GetReport(), info.CODE_YOU_HAVE_NOT_LANDED)
+		return nil
+	}
+
+	req, ok := self.payload(cmd, session, protocol.RESP_CLIENT_ONLINE_STATUS).(*protocol.FriendData)
+	if !ok {
+		return nil
+	}
+
+	friendId := req.FriendID
+
+	if friendId != "" {
+		// 标记用户离线
+		clientInfo, err := self.msgServer.mongoStore.GetClientFromId(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, friendId)
+		if err != nil {
+			log.Error(err.Error())
+			self.respCmd(protocol.RESP_CLIENT_ONLINE_STATUS, session, cmd.GetReport(), info.CODE_DATABASE_ERROR)
+			return err
+		}
+
+		var status int
+		if clientInfo.Alive == true {
+			status = protocol.CLIENT_NOTIFY_FRIEND_ONLNE
+		} else {
+			status = protocol.CLIENT_NOTIFY_FRIEND_OFFLINE
+		}
+
+		notifyMsg := protocol.NewClientNotifyMsg(status, friendId)
+
+		msg, err := json.Marshal(notifyMsg)
+		if err != nil {
+			log.Error(err.Error())
+			self.respCmd(protocol.RESP_CLIENT_ONLINE_STATUS, session, cmd.GetReport(), info.CODE_ENCODE_ERROR)
+			return err
+		}
+
+		//定义返回用户请求信息
+		resp := protocol.NewCmdResponse(protocol.RESP_CLIENT_ONLINE_STATUS)
+		resp.Repo = cmd.GetReport()
+		resp.Time = time.Now().Unix()
+		resp.AddArg(string(msg))
+		//返回用户请求
+		err = session.Send(resp)
+		if err != nil {
+			log.Error("report :", err.Error())
+		}
+	} else {
+		self.respCmd(protocol.RESP_CLIENT_ONLINE_STATUS, session, cmd.GetReport(), info.CODE_NOT_ENOUGH_ARGUMENTS)
+	}
+
+	return err
+}
+
+//解析命令的数据, 格式不对或缺少字段时回复respCmd失败并返回nil, ack等没有回复的命令respCmd为空
+func (self *ProtoProc) payload(cmd protocol.Cmd, session *libnet.Session, respCmd string) interface{} {
+	simple, ok := cmd.(*protocol.CmdSimple)
+	if !ok {
+		return nil
+	}
+	if err := simple.ParsePayload(); err != nil {
+		log.Info(err.Error())
+		if respCmd == "" {
+			return nil
+		}
+		if e, ok := err.(*protocol.MissingFieldError); ok {
+			self.respCmd(respCmd, session, cmd.GetReport(), info.CODE_MISSING_ARGUMENT, e.Field)
+		} else if err == protocol.ErrUnsupportedVersion {
+			self.respCmd(respCmd, session, cmd.GetReport(), info.CODE_UNSUPPORTED_VERSION)
+		} else {
+			self.respCmd(respCmd, session, cmd.GetReport(), info.CODE_INVALID_ARGUMENTS)
+		}
+		return nil
+	}
+	return simple.GetAnyData()
+}
+
+//会话登录时带的语言, 没有登录的用默认语言
+func sessionLocale(session *libnet.Session) string {
+	if state, ok := session.State.(*base.SessionState); ok && state.Locale != "" {
+		return state.Locale
+	}
+	return info.DEFAULT_LOCALE
+}
+
+//设置返回的错误码, 提示信息按会话的语言, args为提示信息模板的参数
+func setCode(resp *protocol.CmdResponse, session *libnet.Session, code int, args ...interface{}) {
+	resp.Ok = code == info.CODE_OK
+	resp.Code = code
+	resp.Message = info.Message(sessionLocale(session), code, args...)
+}
+
+func (self *ProtoProc) respCmd(respCmd string, session *libnet.Session, repo interface{}, code int, args ...interface{}) {
+	//定义返回用户请求信息
+	resp := protocol.NewCmdResponse(respCmd)
+	resp.Repo = repo
+	setCode(resp, session, code, args...)
+	resp.Time = time.Now().Unix()
+
+	//返回用户请求
+	err := session.Send(resp)
+	if err != nil {
+		log.Error("report :", err.Error())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"flag"
 	"goProject/base"
+	"goProject/dispatcher"
 	"goProject/libnet"
 	"goProject/log"
 	"goProject/protocol"
@@ -35,12 +36,13 @@ type MsgServer struct {
 
 	mongoStore *mongo_store.MongoStore
 	worker     *service_discovery.Worker
+	dispatcher *dispatcher.Dispatcher
 }
 
 func NewMsgServer(cfg *MsgServerConfig) *MsgServer {
 	InitCommendMapped()
 
-	return &MsgServer{
+	ms := &MsgServer{
 		cfg:      cfg,
 		sessions: make(base.SessionMap),
 		channels: make(base.ChannelMap),
@@ -52,6 +54,8 @@ func NewMsgServer(cfg *MsgServerConfig) *MsgServer {
 		mongoStore:   mongo_store.NewMongoStore(cfg.Mongo.Addr, cfg.Mongo.Port, cfg.Mongo.User, cfg.Mongo.Password),
 		worker:       service_discovery.NewWorker(cfg.LocalIP, cfg.LocalIP, []string{cfg.EtcdServer}),
 	}
+	ms.dispatcher = ms.newDispatcher()
+	return ms
 }
 
 //创建Channels
@@ -98,35 +102,30 @@ func (self *MsgServer) sendMonitorData() error {
 // 	log.Info("sendServiceDiscoveryData")
 // }
 
-// 扫描进程
-func (self *MsgServer) scanDeadSession() {
-	log.Info("scanDeadSession")
-	timer := time.NewTicker(self.cfg.ScanDeadSessionTimeout * time.Second)
-	ttl := time.After(self.cfg.Expire * time.Second)
-	for {
-		select {
-		case <-timer.C:
-			// log.Info("scanDeadSession timeout")
-			go func() {
-				for id, s := range self.sessions {
-
-					if (s.State).(*base.SessionState).Alive == false {
-						log.Info("delete" + id)
+//读空闲超时, 客户端长时间没有任何数据(包括ping)
+func (self *MsgServer) sessionIdle(session *libnet.Session, idle int) {
+	if idle == libnet.IDLE_READ {
+		log.Info(session.Conn().RemoteAddr().String() + " read idle timeout")
+	}
+}
 
-						self.scanSessionMutex.Lock()
-						delete(self.sessions, id)
-						self.scanSessionMutex.Unlock()
-					} else {
-						s.State.(*base.SessionState).Alive = false
-					}
+//连接断开后清理会话
+func (self *MsgServer) closeSession(session *libnet.Session) {
+	if session.State == nil {
+		return
+	}
+	id := session.State.(*base.SessionState).ClientID
 
-					self.mongoStore.UpdateSessionAlive(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, id, false)
-				}
-			}()
-		case <-ttl:
-			break
-		}
+	self.scanSessionMutex.Lock()
+	if self.sessions[id] != session {
+		self.scanSessionMutex.Unlock()
+		return
 	}
+	log.Info("delete" + id)
+	delete(self.sessions, id)
+	self.scanSessionMutex.Unlock()
+
+	self.mongoStore.UpdateSessionAlive(mongo_store.DATA_BASE_NAME, mongo_store.CLIENT_INFO_COLLECTION, id, self.cfg.LocalIP, false)
 }
 
 //扫描超时仍未返回的ack,重发消息
@@ -151,175 +150,69 @@ func (self *MsgServer) scanTimeoutAck() {
 	}
 }
 
-//协议解析
-func (self *MsgServer) parseProtocol(cmd protocol.CmdSimple, session *libnet.Session) error {
-	var err error
+//登记各命令的处理函数, 命令的元数据见dispatcher包.
+func (self *MsgServer) newDispatcher() *dispatcher.Dispatcher {
 	pp := NewProtoProc(self)
-
-	cmdName := cmd.GetCmdName()
-
-	switch cmdName {
-	//PING
-	case protocol.SEND_PING_CMD:
-		err = pp.procPing(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
+	d := dispatcher.NewDispatcher(
+		func(session interface{}) bool {
+			return session.(*libnet.Session).State != nil
+		},
+		func(session interface{}, cmd protocol.Cmd, respCmd string, code int) {
+			pp.respCmd(respCmd, session.(*libnet.Session), cmd.GetReport(), code)
+		})
+
+	handle := func(name string, proc func(protocol.Cmd, *libnet.Session) error) {
+		d.Handle(name, func(cmd protocol.Cmd, session interface{}) error {
+			return proc(cmd, session.(*libnet.Session))
+		})
+	}
 	//router订阅
-	case protocol.SUBSCRIBE_CHANNEL_CMD:
-		pp.procSubscribeChannel(&cmd, session)
-
+	handle(protocol.SUBSCRIBE_CHANNEL_CMD, func(cmd protocol.Cmd, session *libnet.Session) error {
+		pp.procSubscribeChannel(cmd, session)
+		return nil
+	})
 	//router过来的信息统一接收端口
-	case protocol.ROUTE_MSG_CMD:
-		err = pp.procRouteMsg(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-	//登陆
-	case protocol.SEND_CLIENT_ID_CMD:
-		err = pp.procClientID(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
+	handle(protocol.ROUTE_MSG_CMD, pp.procRouteMsg)
 
-	//退出
-	case protocol.SEND_LOGOUT_CMD:
-		err = pp.procLogout(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
+	//登陆
+	handle(protocol.SEND_CLIENT_ID_CMD, pp.procClientID)
+	handle(protocol.SEND_TOKEN_CMD, pp.procToken)
+	handle(protocol.SEND_PING_CMD, pp.procPing)
+	handle(protocol.SEND_LOGOUT_CMD, pp.procLogout)
+	handle(protocol.SEND_CLIENT_ONLINE_STATUS, pp.procClientOnlineStatus)
+	handle(protocol.SEND_GET_TOKEN, pp.procSendGetToken)
 
 	//P2P信息
-	case protocol.SEND_MESSAGE_P2P_CMD:
-		err = pp.procSendMessageP2P(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-	//P2p Notify
-	case protocol.SEND_NOTIFY_P2P_CMD:
-		err = pp.procSendMessageP2P(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	//创建Topic
-	case protocol.SEND_CREATE_TOPIC_CMD:
-		err = pp.procCreateTopic(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-	//加入Topic
-	case protocol.SEND_JOIN_TOPIC_CMD:
-		err = pp.procJoinTopic(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	//离开Topic
-	case protocol.SEND_LEAVE_TOPIC_CMD:
-		err = pp.procLeaveTopic(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-	//获取群组信息
-	case protocol.SEND_LIST_TOPIC_CMD:
-		err = pp.procListTopic(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-	//获取Topic成员
-	case protocol.SEND_TOPIC_MEMBERS_LIST_CMD:
-		err = pp.procTopicMembersList(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	//Topic信息处理
-	case protocol.SEND_MESSAGE_TOPIC_CMD:
-		err = pp.procSendMessageTopic(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-	//Topic notify信息处理
-	case protocol.SEND_NOTIFY_TOPIC_CMD:
-		err = pp.procSendMessageTopic(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	// p2p ack
-	case protocol.P2P_ACK_CMD:
-		err = pp.procP2pAck(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	// topic ack
-	case protocol.TOPIC_ACK_CMD:
-		err = pp.procTopicAck(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	//view friend list
-	case protocol.SEND_VIEW_FRIENDS_CMD:
-		err = pp.procViewFriends(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	//add friend
-	case protocol.SEND_ADD_FRIEND_CMD:
-		err = pp.procAddFriend(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	//del friend
-	case protocol.SEND_DEL_FRIEND_CMD:
-		err = pp.procDelFriend(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	//请求统一接口
-	case protocol.SEND_ASK_CMD:
-		err = pp.procAsk(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	//接收请求统一接口
-	case protocol.SEND_REACT_CMD:
-		err = pp.procReact(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
+	handle(protocol.SEND_MESSAGE_P2P_CMD, pp.procSendMessageP2P)
+	handle(protocol.SEND_NOTIFY_P2P_CMD, pp.procSendMessageP2P)
+	handle(protocol.P2P_ACK_CMD, pp.procP2pAck)
+
+	//Topic
+	handle(protocol.SEND_CREATE_TOPIC_CMD, pp.procCreateTopic)
+	handle(protocol.SEND_JOIN_TOPIC_CMD, pp.procJoinTopic)
+	handle(protocol.SEND_INVITE_TOPIC_CMD, pp.procInviteTopic)
+	handle(protocol.SEND_LEAVE_TOPIC_CMD, pp.procLeaveTopic)
+	handle(protocol.SEND_LIST_TOPIC_CMD, pp.procListTopic)
+	handle(protocol.SEND_TOPIC_MEMBERS_LIST_CMD, pp.procTopicMembersList)
+	handle(protocol.SEND_MESSAGE_TOPIC_CMD, pp.procSendMessageTopic)
+	handle(protocol.SEND_NOTIFY_TOPIC_CMD, pp.procSendMessageTopic)
+	handle(protocol.TOPIC_ACK_CMD, pp.procTopicAck)
+
+	//好友
+	handle(protocol.SEND_VIEW_FRIENDS_CMD, pp.procViewFriends)
+	handle(protocol.SEND_ADD_FRIEND_CMD, pp.procAddFriend)
+	handle(protocol.SEND_DEL_FRIEND_CMD, pp.procDelFriend)
+	handle(protocol.SEND_ASK_CMD, pp.procAsk)
+	handle(protocol.SEND_REACT_CMD, pp.procReact)
+
+	return d
+}
 
-	default:
-		log.Info(cmd.GetCmdName())
+//协议解析
+func (self *MsgServer) parseProtocol(cmd protocol.CmdSimple, session *libnet.Session) error {
+	err := self.dispatcher.Dispatch(&cmd, session)
+	if err != nil {
+		log.Error("error:", err)
 	}
-
 	return err
 }
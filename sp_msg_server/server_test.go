@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"goProject/base"
+	"goProject/info"
+	"goProject/libnet"
+	"goProject/protocol"
+	"net"
+	"testing"
+
+	"github.com/funny/unitest"
+)
+
+func newTestMsgServer() *MsgServer {
+	ms := &MsgServer{
+		sessions:     make(base.SessionMap),
+		channels:     make(base.ChannelMap),
+		p2pAckMap:    make(base.AckMap),
+		topicAckMap:  make(base.AckMap),
+		mutualAckMap: make(base.AckMap),
+	}
+	ms.dispatcher = ms.newDispatcher()
+	return ms
+}
+
+//服务器一端的会话和客户端读取回复的解码器
+func newTestSession() (*libnet.Session, *json.Decoder) {
+	conn1, conn2 := net.Pipe()
+	return libnet.NewSession(conn1, libnet.Json()), json.NewDecoder(conn2)
+}
+
+func dispatch(t *testing.T, ms *MsgServer, session *libnet.Session, client *json.Decoder, name string) *protocol.CmdResponse {
+	go ms.parseProtocol(*protocol.NewCmdSimple(name), session)
+	var resp protocol.CmdResponse
+	unitest.NotError(t, client.Decode(&resp))
+	return &resp
+}
+
+//和msg_server一样处理这些命令, 不再回复不支持
+func Test_Dispatcher_Commands(t *testing.T) {
+	ms := newTestMsgServer()
+	session, client := newTestSession()
+	defer session.Close()
+
+	for name, respCmd := range map[string]string{
+		protocol.SEND_TOKEN_CMD:            protocol.RESP_TOKEN_CMD,
+		protocol.SEND_INVITE_TOPIC_CMD:     protocol.RESP_INVITE_TOPIC_CMD,
+		protocol.SEND_CLIENT_ONLINE_STATUS: protocol.RESP_CLIENT_ONLINE_STATUS,
+		protocol.SEND_GET_TOKEN:            protocol.RESP_GET_TOKEN,
+	} {
+		resp := dispatch(t, ms, session, client, name)
+		unitest.Pass(t, resp.CmdName == respCmd)
+		unitest.Pass(t, resp.Code != info.CODE_UNSUPPORTED_COMMAND)
+	}
+}
+
+//拒绝命令时按会话登录时的语言回复
+func Test_Dispatcher_Locale(t *testing.T) {
+	ms := newTestMsgServer()
+	session, client := newTestSession()
+	defer session.Close()
+
+	resp := dispatch(t, ms, session, client, protocol.SEND_INVITE_TOPIC_CMD)
+	unitest.Pass(t, resp.Code == info.CODE_YOU_HAVE_NOT_LANDED)
+	unitest.Pass(t, resp.Message == info.Message(info.DEFAULT_LOCALE, info.CODE_YOU_HAVE_NOT_LANDED))
+
+	state := base.NewSessionState("aa", 0)
+	state.Locale = info.LOCALE_ZH
+	session.State = state
+	resp = dispatch(t, ms, session, client, protocol.SEND_INVITE_TOPIC_CMD)
+	unitest.Pass(t, resp.Code == info.CODE_NOT_ENOUGH_ARGUMENTS)
+	unitest.Pass(t, resp.Message == info.Message(info.LOCALE_ZH, info.CODE_NOT_ENOUGH_ARGUMENTS))
+}
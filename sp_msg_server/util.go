@@ -144,3 +144,10 @@ func InitCommendMapped() {
 		protocol.ROUTE_NOTIFY_TOPIC_CMD,
 	}
 }
+
+type GetTokenTemplate struct {
+	Status   string `json:"status"`
+	Message  string `json:"message"`
+	UserId   string `json:"userId"`
+	Platform string `json:"platform"`
+}
@@ -8,4 +8,11 @@ const (
 	RECORD_TOPIC_MESSAGE_COLLECTION  = "topic_record_message"  //群组消息记录
 	RECORD_MUTUAL_MESSAGE_COLLECTION = "mutual_record_message" //用户交互消息记录
 	KV_COLLECTION                    = "kvs"                   //kv配置数据
+	RECORD_SEQUENCE_COLLECTION       = "record_sequence"       //会话消息序号
+)
+
+//KV表中的数据类型
+const (
+	KV_TYPE_PENDING_P2P_ACK   = "pendingP2PAck"   //停机时未确认的P2P消息
+	KV_TYPE_PENDING_TOPIC_ACK = "pendingTopicAck" //停机时未确认的Topic消息
 )
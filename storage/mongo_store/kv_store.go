@@ -28,3 +28,20 @@ func (self *MongoStore) ReadRouterManagerMsgServers(db string, c string, routers
 
 	return result
 }
+
+//读取单条KV记录
+func (self *MongoStore) ReadKVData(db string, c string, dType string, key string) *KVData {
+	self.rwMutex.Lock()
+	defer self.rwMutex.Unlock()
+	op := self.session.DB(db).C(c)
+
+	var result *KVData
+	op.Find(bson.M{"Type": dType, "Key": key}).One(&result)
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error(err)
+		}
+	}()
+
+	return result
+}
@@ -0,0 +1,24 @@
+package mongo_store
+
+import (
+	"os"
+	"testing"
+)
+
+const TEST_DATA_BASE_NAME = "im_test"
+
+//需要mongodb的测试, 设置MONGO_TEST_ADDR(如127.0.0.1:27017)时才运行, 用完删除测试库
+func newTestStore(t *testing.T) *MongoStore {
+	addr := os.Getenv("MONGO_TEST_ADDR")
+	if addr == "" {
+		t.Skip("MONGO_TEST_ADDR not set")
+	}
+	store := NewMongoStore(addr, "", "", "")
+	store.session.DB(TEST_DATA_BASE_NAME).DropDatabase()
+	return store
+}
+
+func (self *MongoStore) closeTest() {
+	self.session.DB(TEST_DATA_BASE_NAME).DropDatabase()
+	self.session.Close()
+}
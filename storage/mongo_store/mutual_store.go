@@ -6,12 +6,14 @@ import (
 )
 
 type MutualRecordMessageData struct {
-	FromID string `bson:"FromID"` //来自用户ID
-	ToID   string `bson:"ToID"`   //发送到某人ID
-	Type   string `bson:"Type"`   //发送类型 addFriend,
-	Time   int64  `bson:"Time"`   //时间
-	UUID   string `bson:"UUID"`   //消息唯一标识符
-	IsRead bool   `bson:"IsRead"` //是否已读
+	FromID         string `bson:"FromID"`         //来自用户ID
+	ToID           string `bson:"ToID"`           //发送到某人ID
+	Type           string `bson:"Type"`           //发送类型 addFriend,
+	Time           int64  `bson:"Time"`           //时间
+	UUID           string `bson:"UUID"`           //消息唯一标识符
+	IsRead         bool   `bson:"IsRead"`         //是否已读
+	ConversationID string `bson:"ConversationID"` //会话ID, 见AskConversationID
+	Seq            int64  `bson:"Seq"`            //接收者收到的请求的序号, 旧请求为0
 }
 
 func (self *MongoStore) ReadMutualRecordMessage(db string, c string, cid string) ([]*MutualRecordMessageData, error) {
@@ -2,30 +2,38 @@ package mongo_store
 
 import (
 	"goProject/log"
-	// "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
 //消息记录储存
 type P2PRecordMessageData struct {
-	MsgType string `bson:"MsgType"` //消息类型
-	FromID  string `bson:"FromID"`  //来自用户ID
-	ToID    string `bson:"ToID"`    //发送到某人ID
-	Content string `bson:"Content"` //消息内容
-	Time    int64  `bson:"Time"`    //时间
-	UUID    string `bson:"UUID"`    //消息唯一标识符
-	IsRead  bool   `bson:"IsRead"`  //是否已读
+	MsgType        string `bson:"MsgType"`        //消息类型
+	FromID         string `bson:"FromID"`         //来自用户ID
+	ToID           string `bson:"ToID"`           //发送到某人ID
+	Content        string `bson:"Content"`        //消息内容
+	Time           int64  `bson:"Time"`           //时间, 秒
+	UUID           string `bson:"UUID"`           //消息唯一标识符
+	IsRead         bool   `bson:"IsRead"`         //是否已读
+	ClientMsgID    string `bson:"ClientMsgID"`    //客户端带的消息ID, 用于重发去重
+	ConversationID string `bson:"ConversationID"` //会话ID, 见P2PConversationID
+	Seq            int64  `bson:"Seq"`            //会话内递增的序号, 旧消息为0
+	MsTime         int64  `bson:"MsTime"`         //时间, 毫秒
 }
 
 //群组消息储存
 type TopicRecordMessageData struct {
-	MsgType string   `bson:"MsgType"` //消息类型
-	FromID  string   `bson:"FromID"`  //来自用户ID
-	ToID    string   `bson:"ToID"`    //发送到Topic ID
-	Content string   `bson:"Content"` //消息内容
-	Time    int64    `bson:"Time"`    //时间
-	UUID    string   `bson:"UUID"`    //消息唯一标识符
-	IsRead  []string `bson:"IsRead"`  //是否已读 储存格式 [u1, u2, u3]
+	MsgType        string   `bson:"MsgType"`        //消息类型
+	FromID         string   `bson:"FromID"`         //来自用户ID
+	ToID           string   `bson:"ToID"`           //发送到Topic ID
+	Content        string   `bson:"Content"`        //消息内容
+	Time           int64    `bson:"Time"`           //时间, 秒
+	UUID           string   `bson:"UUID"`           //消息唯一标识符
+	IsRead         []string `bson:"IsRead"`         //是否已读 储存格式 [u1, u2, u3]
+	ClientMsgID    string   `bson:"ClientMsgID"`    //客户端带的消息ID, 用于重发去重
+	ConversationID string   `bson:"ConversationID"` //会话ID, 见TopicConversationID
+	Seq            int64    `bson:"Seq"`            //会话内递增的序号, 旧消息为0
+	MsTime         int64    `bson:"MsTime"`         //时间, 毫秒
 }
 
 //读取未读消息记录
@@ -36,7 +44,7 @@ func (self *MongoStore) ReadP2PRecordMessage(db string, c string, cid string) ([
 	op := self.session.DB(db).C(c)
 
 	var result []*P2PRecordMessageData
-	err = op.Find(bson.M{"ToID": cid, "IsRead": false}).All(&result)
+	err = op.Find(bson.M{"ToID": cid, "IsRead": false}).Sort("Time", "Seq").All(&result)
 
 	if err != nil {
 		log.Error(err.Error())
@@ -66,6 +74,24 @@ func (self *MongoStore) ReadP2PRecordNumber(db string, c string, cid string) int
 	return num
 }
 
+//按发送者和客户端消息ID读取since之后的消息记录, 没有时返回nil
+func (self *MongoStore) ReadP2PRecordMessageFromClientMsgID(db string, c string, fromID string, clientMsgID string, since int64) *P2PRecordMessageData {
+	self.rwMutex.Lock()
+	defer self.rwMutex.Unlock()
+	op := self.session.DB(db).C(c)
+
+	var result *P2PRecordMessageData
+	err := op.Find(bson.M{"FromID": fromID, "ClientMsgID": clientMsgID, "Time": bson.M{"$gte": since}}).One(&result)
+	if err != nil {
+		if err != mgo.ErrNotFound {
+			log.Error(err.Error())
+		}
+		return nil
+	}
+
+	return result
+}
+
 //读取单条未读消息记录
 func (self *MongoStore) ReadP2PRecordMessageFromUuid(db string, c string, uuid string) *P2PRecordMessageData {
 	self.rwMutex.Lock()
@@ -109,7 +135,7 @@ func (self *MongoStore) ReadTopicRecordMessage(db string, c string, cid string,
 	var result []*TopicRecordMessageData
 	//查找IsRead中不包含ClientID的记录
 
-	op.Find(bson.M{"ToID": bson.M{"$in": topicIds}, "IsRead": bson.M{"$ne": cid}}).All(&result)
+	op.Find(bson.M{"ToID": bson.M{"$in": topicIds}, "IsRead": bson.M{"$ne": cid}}).Sort("Time", "Seq").All(&result)
 	defer func() {
 		if err := recover(); err != nil {
 			log.Error(err)
@@ -118,6 +144,24 @@ func (self *MongoStore) ReadTopicRecordMessage(db string, c string, cid string,
 	return result
 }
 
+//按发送者和客户端消息ID读取since之后的群组消息记录, 没有时返回nil
+func (self *MongoStore) ReadTopicRecordMessageFromClientMsgID(db string, c string, fromID string, clientMsgID string, since int64) *TopicRecordMessageData {
+	self.rwMutex.Lock()
+	defer self.rwMutex.Unlock()
+	op := self.session.DB(db).C(c)
+
+	var result *TopicRecordMessageData
+	err := op.Find(bson.M{"FromID": fromID, "ClientMsgID": clientMsgID, "Time": bson.M{"$gte": since}}).One(&result)
+	if err != nil {
+		if err != mgo.ErrNotFound {
+			log.Error(err.Error())
+		}
+		return nil
+	}
+
+	return result
+}
+
 //根据UUID读取群组未读信息
 func (self *MongoStore) ReadTopicRecordMessageFromUuid(db string, c string, uuid string) *TopicRecordMessageData {
 	self.rwMutex.Lock()
@@ -144,7 +188,7 @@ func (self *MongoStore) ReadP2PHistoryFromEndTime(db string, c string, FromID st
 
 	var result []*P2PRecordMessageData
 
-	op.Find(bson.M{"FromID": bson.M{"$in": []string{FromID, ToID}}, "ToID": bson.M{"$in": []string{FromID, ToID}}, "Time": bson.M{"$lte": endTime}}).Sort("-Time").Limit(n).All(&result)
+	op.Find(bson.M{"FromID": bson.M{"$in": []string{FromID, ToID}}, "ToID": bson.M{"$in": []string{FromID, ToID}}, "Time": bson.M{"$lte": endTime}}).Sort("-Time", "-Seq").Limit(n).All(&result)
 	defer func() {
 		if err := recover(); err != nil {
 			log.Error(err)
@@ -163,7 +207,7 @@ func (self *MongoStore) ReadTopicHistoryFromEndTime(db string, c string, topicNa
 
 	var result []*TopicRecordMessageData
 
-	op.Find(bson.M{"ToID": topicName, "Time": bson.M{"$lte": endTime}}).Sort("-Time").Limit(n).All(&result)
+	op.Find(bson.M{"ToID": topicName, "Time": bson.M{"$lte": endTime}}).Sort("-Time", "-Seq").Limit(n).All(&result)
 	defer func() {
 		if err := recover(); err != nil {
 			log.Error(err)
@@ -0,0 +1,58 @@
+package mongo_store
+
+import (
+	"goProject/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+//会话ID的前缀
+const (
+	CONVERSATION_P2P   = "p2p:"
+	CONVERSATION_TOPIC = "topic:"
+	CONVERSATION_ASK   = "ask:"
+)
+
+//会话的消息序号, 每保存一条消息加1
+type SequenceData struct {
+	ConversationID string `bson:"_id"`
+	Seq            int64  `bson:"Seq"`
+}
+
+//单聊的会话ID, 与双方的先后无关
+func P2PConversationID(a string, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return CONVERSATION_P2P + a + ":" + b
+}
+
+//群组的会话ID
+func TopicConversationID(topicID string) string {
+	return CONVERSATION_TOPIC + topicID
+}
+
+//用户收到的好友请求等交互消息, 每个接收者一个会话
+func AskConversationID(cid string) string {
+	return CONVERSATION_ASK + cid
+}
+
+//取会话的下一个序号, 从1开始严格递增, 多个msg_server共用
+func (self *MongoStore) NextSequence(db string, c string, conversationID string) (int64, error) {
+	self.rwMutex.Lock()
+	defer self.rwMutex.Unlock()
+	op := self.session.DB(db).C(c)
+
+	var result SequenceData
+	_, err := op.FindId(conversationID).Apply(mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"Seq": 1}},
+		Upsert:    true,
+		ReturnNew: true,
+	}, &result)
+	if err != nil {
+		log.Error(err.Error())
+		return 0, err
+	}
+
+	return result.Seq, nil
+}
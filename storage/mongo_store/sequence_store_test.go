@@ -0,0 +1,31 @@
+package mongo_store
+
+import (
+	"testing"
+
+	"github.com/funny/unitest"
+)
+
+func Test_ConversationID(t *testing.T) {
+	unitest.Pass(t, P2PConversationID("aa", "bb") == "p2p:aa:bb")
+	unitest.Pass(t, P2PConversationID("bb", "aa") == "p2p:aa:bb")
+	unitest.Pass(t, TopicConversationID("t1") == "topic:t1")
+	unitest.Pass(t, AskConversationID("aa") == "ask:aa")
+}
+
+func Test_NextSequence(t *testing.T) {
+	store := newTestStore(t)
+	defer store.closeTest()
+
+	a := P2PConversationID("aa", "bb")
+	for i := int64(1); i <= 3; i++ {
+		seq, err := store.NextSequence(TEST_DATA_BASE_NAME, RECORD_SEQUENCE_COLLECTION, a)
+		unitest.NotError(t, err)
+		unitest.Pass(t, seq == i)
+	}
+
+	//每个会话分别计数
+	seq, err := store.NextSequence(TEST_DATA_BASE_NAME, RECORD_SEQUENCE_COLLECTION, TopicConversationID("t1"))
+	unitest.NotError(t, err)
+	unitest.Pass(t, seq == 1)
+}
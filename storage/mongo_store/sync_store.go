@@ -0,0 +1,155 @@
+package mongo_store
+
+import (
+	"goProject/log"
+	"gopkg.in/mgo.v2/bson"
+)
+
+//会话中需要同步的消息数和序号范围
+type SyncCountData struct {
+	ConversationID string `bson:"_id"`
+	MinSeq         int64  `bson:"MinSeq"`
+	MaxSeq         int64  `bson:"MaxSeq"`
+	Count          int    `bson:"Count"`
+}
+
+//按会话统计的聚合, 没有序号的旧消息不统计, match中带了Seq条件时用它的
+func countPipeline(match bson.M) []bson.M {
+	filter := bson.M{"Seq": bson.M{"$gt": 0}}
+	for k, v := range match {
+		filter[k] = v
+	}
+	return []bson.M{
+		{"$match": filter},
+		{"$group": bson.M{
+			"_id":    "$ConversationID",
+			"MinSeq": bson.M{"$min": "$Seq"},
+			"MaxSeq": bson.M{"$max": "$Seq"},
+			"Count":  bson.M{"$sum": 1},
+		}},
+	}
+}
+
+//按会话统计符合条件的消息
+func (self *MongoStore) countByConversation(db string, c string, match bson.M) ([]*SyncCountData, error) {
+	self.rwMutex.Lock()
+	defer self.rwMutex.Unlock()
+	op := self.session.DB(db).C(c)
+
+	var result []*SyncCountData
+	err := op.Pipe(countPipeline(match)).All(&result)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+//按会话统计用户未读的P2P消息
+func (self *MongoStore) CountP2PUnreadByConversation(db string, c string, cid string) ([]*SyncCountData, error) {
+	return self.countByConversation(db, c, bson.M{"ToID": cid, "IsRead": false})
+}
+
+//按会话统计用户未读的群组消息
+func (self *MongoStore) CountTopicUnreadByConversation(db string, c string, cid string, topicIds []string) ([]*SyncCountData, error) {
+	return self.countByConversation(db, c, bson.M{"ToID": bson.M{"$in": topicIds}, "IsRead": bson.M{"$ne": cid}})
+}
+
+//统计用户还没有回应的请求
+func (self *MongoStore) CountMutualUnreadByConversation(db string, c string, cid string) ([]*SyncCountData, error) {
+	return self.countByConversation(db, c, bson.M{"ToID": cid, "IsRead": false})
+}
+
+//统计会话中序号在seq之后的消息, 没有时返回nil
+func (self *MongoStore) CountRecordsAfterSeq(db string, c string, conversationID string, seq int64) (*SyncCountData, error) {
+	if seq < 0 {
+		seq = 0
+	}
+	result, err := self.countByConversation(db, c, bson.M{"ConversationID": conversationID, "Seq": bson.M{"$gt": seq}})
+	if err != nil || len(result) == 0 {
+		return nil, err
+	}
+
+	return result[0], nil
+}
+
+//按序号读取会话中seq之后的n条P2P消息
+func (self *MongoStore) ReadP2PRecordMessageAfterSeq(db string, c string, conversationID string, seq int64, n int) ([]*P2PRecordMessageData, error) {
+	self.rwMutex.Lock()
+	defer self.rwMutex.Unlock()
+	op := self.session.DB(db).C(c)
+
+	var result []*P2PRecordMessageData
+	err := op.Find(bson.M{"ConversationID": conversationID, "Seq": bson.M{"$gt": seq}}).Sort("Seq").Limit(n).All(&result)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+//按序号读取会话中seq之后的n条群组消息
+func (self *MongoStore) ReadTopicRecordMessageAfterSeq(db string, c string, conversationID string, seq int64, n int) ([]*TopicRecordMessageData, error) {
+	self.rwMutex.Lock()
+	defer self.rwMutex.Unlock()
+	op := self.session.DB(db).C(c)
+
+	var result []*TopicRecordMessageData
+	err := op.Find(bson.M{"ConversationID": conversationID, "Seq": bson.M{"$gt": seq}}).Sort("Seq").Limit(n).All(&result)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+//按序号读取seq之后的n条请求
+func (self *MongoStore) ReadMutualRecordMessageAfterSeq(db string, c string, conversationID string, seq int64, n int) ([]*MutualRecordMessageData, error) {
+	self.rwMutex.Lock()
+	defer self.rwMutex.Unlock()
+	op := self.session.DB(db).C(c)
+
+	var result []*MutualRecordMessageData
+	err := op.Find(bson.M{"ConversationID": conversationID, "Seq": bson.M{"$gt": seq}}).Sort("Seq").Limit(n).All(&result)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+//标记用户在会话中序号不大于seq的P2P消息为已读
+func (self *MongoStore) MarkP2PRecordMessageToSeq(db string, c string, conversationID string, cid string, seq int64) error {
+	self.rwMutex.Lock()
+	defer self.rwMutex.Unlock()
+	op := self.session.DB(db).C(c)
+
+	_, err := op.UpdateAll(bson.M{"ConversationID": conversationID, "ToID": cid, "Seq": bson.M{"$lte": seq}, "IsRead": false},
+		bson.M{"$set": bson.M{"IsRead": true}})
+	if err != nil {
+		log.Error(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+//标记用户在群组中序号不大于seq的消息为已读
+func (self *MongoStore) MarkTopicRecordMessageToSeq(db string, c string, conversationID string, cid string, seq int64) error {
+	self.rwMutex.Lock()
+	defer self.rwMutex.Unlock()
+	op := self.session.DB(db).C(c)
+
+	_, err := op.UpdateAll(bson.M{"ConversationID": conversationID, "Seq": bson.M{"$lte": seq}},
+		bson.M{"$addToSet": bson.M{"IsRead": cid}})
+	if err != nil {
+		log.Error(err.Error())
+		return err
+	}
+
+	return nil
+}
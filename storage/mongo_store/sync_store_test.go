@@ -0,0 +1,54 @@
+package mongo_store
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/funny/unitest"
+	"gopkg.in/mgo.v2/bson"
+)
+
+//游标的条件不能被没有序号的旧消息的条件覆盖
+func Test_CountPipeline(t *testing.T) {
+	match := bson.M{"ConversationID": "p2p:aa:bb", "Seq": bson.M{"$gt": int64(3)}}
+	filter := countPipeline(match)[0]["$match"].(bson.M)
+	unitest.Pass(t, filter["ConversationID"] == "p2p:aa:bb")
+	unitest.Pass(t, filter["Seq"].(bson.M)["$gt"] == int64(3))
+	unitest.Pass(t, match["Seq"].(bson.M)["$gt"] == int64(3))
+
+	match = bson.M{"ToID": "aa", "IsRead": false}
+	filter = countPipeline(match)[0]["$match"].(bson.M)
+	unitest.Pass(t, filter["Seq"].(bson.M)["$gt"] == 0)
+	unitest.Pass(t, filter["ToID"] == "aa")
+	_, ok := match["Seq"]
+	unitest.Pass(t, !ok)
+}
+
+func Test_CountRecordsAfterSeq(t *testing.T) {
+	store := newTestStore(t)
+	defer store.closeTest()
+
+	conversationID := P2PConversationID("aa", "bb")
+	for seq := int64(1); seq <= 3; seq++ {
+		unitest.NotError(t, store.Upsert(TEST_DATA_BASE_NAME, RECORD_P2P_MESSAGE_COLLECTION, &P2PRecordMessageData{
+			FromID:         "aa",
+			ToID:           "bb",
+			UUID:           "u" + strconv.FormatInt(seq, 10),
+			ConversationID: conversationID,
+			Seq:            seq,
+		}))
+	}
+
+	data, err := store.CountRecordsAfterSeq(TEST_DATA_BASE_NAME, RECORD_P2P_MESSAGE_COLLECTION, conversationID, 1)
+	unitest.NotError(t, err)
+	unitest.Pass(t, data != nil && data.Count == 2 && data.MinSeq == 2 && data.MaxSeq == 3)
+
+	//已经同步到最后
+	data, err = store.CountRecordsAfterSeq(TEST_DATA_BASE_NAME, RECORD_P2P_MESSAGE_COLLECTION, conversationID, 3)
+	unitest.NotError(t, err)
+	unitest.Pass(t, data == nil)
+
+	records, err := store.ReadP2PRecordMessageAfterSeq(TEST_DATA_BASE_NAME, RECORD_P2P_MESSAGE_COLLECTION, conversationID, 1, 1)
+	unitest.NotError(t, err)
+	unitest.Pass(t, len(records) == 1 && records[0].Seq == 2)
+}
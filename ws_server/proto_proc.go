@@ -12,7 +12,7 @@ import (
 	"goProject/storage/mongo_store"
 	// "gopkg.in/mgo.v2/json"
 	// "strconv"
-	// "time"
+	"time"
 )
 
 func init() {
@@ -144,8 +144,14 @@ func (self *ProtoProc) procClientID(cmd protocol.Cmd, session *connection) error
 	}
 
 	self.msgServer.sessions[ClientID] = session
-	self.msgServer.sessions[ClientID].State = base.NewSessionState(ClientID, true,
-		"session.Conn().RemoteAddr().String()", self.msgServer.cfg.LocalIP)
+	state := base.NewSessionState(ClientID, time.Now().Unix())
+	//登录时可以带上客户端的语言
+	if simple, ok := cmd.(*protocol.CmdSimple); ok && simple.ParsePayload() == nil {
+		if req, ok := simple.GetAnyData().(*protocol.ClientIDData); ok {
+			state.Locale = info.Locale(req.Locale)
+		}
+	}
+	self.msgServer.sessions[ClientID].State = state
 
 	tResp, err := json.Marshal(resp)
 	if err != nil {
@@ -1047,3 +1053,11 @@ func (self *ProtoProc) clientQuit(session *connection) {
 	// delete(self.msgServer.sessions, ClientID)
 	close(session.send)
 }
+
+//会话登录时带的语言, 没有登录的用默认语言
+func sessionLocale(session *connection) string {
+	if state, ok := session.State.(*base.SessionState); ok && state.Locale != "" {
+		return state.Locale
+	}
+	return info.DEFAULT_LOCALE
+}
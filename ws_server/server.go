@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"flag"
 	"goProject/base"
+	"goProject/dispatcher"
+	"goProject/info"
 	"goProject/libnet"
 	"goProject/log"
 	"goProject/protocol"
@@ -43,6 +45,7 @@ type MsgServer struct {
 	mutualAckMutex   sync.Mutex
 
 	mongoStore *mongo_store.MongoStore
+	dispatcher *dispatcher.Dispatcher
 }
 
 // func NewMsgServer(cfg *MsgServerConfig) *MsgServer {
@@ -195,164 +198,40 @@ func (self *MsgServer) run() {
 // 	}
 // }
 
-//协议解析
-func (self *MsgServer) parseProtocol(cmd protocol.CmdSimple, session *connection) error {
-	var err error
+//登记各命令的处理函数, 命令的元数据见dispatcher包. 目前只实现了登录, 其他命令回复不支持
+func (self *MsgServer) newDispatcher() *dispatcher.Dispatcher {
 	pp := NewProtoProc(self)
+	d := dispatcher.NewDispatcher(
+		func(session interface{}) bool {
+			return session.(*connection).State != nil
+		},
+		func(session interface{}, cmd protocol.Cmd, respCmd string, code int) {
+			resp := protocol.NewCmdResponse(respCmd)
+			resp.Repo = cmd.GetReport()
+			resp.Ok = false
+			resp.Code = code
+			resp.Message = info.Message(sessionLocale(session.(*connection)), code)
+			tResp, err := json.Marshal(resp)
+			if err != nil {
+				log.Error(err.Error())
+				return
+			}
+			session.(*connection).send <- tResp
+		})
 
-	cmdName := cmd.GetCmdName()
-
-	// log.Info("------------------------")
-	// log.Info(cmd)
-
-	switch cmdName {
-	// //PING
-	// case protocol.SEND_PING_CMD:
-	// 	err = pp.procPing(&cmd, session)
-	// 	if err != nil {
-	// 		log.Error("error:", err)
-	// 		return err
-	// 	}
-
-	//router订阅
-	// case protocol.SUBSCRIBE_CHANNEL_CMD:
-	// 	pp.procSu`bscribeChannel(&cmd, session)
-
-	// //router过来的信息统一接收端口
-	// case protocol.ROUTE_MSG_CMD:
-	// 	err = pp.procRouteMsg(&cmd, session)
-	// 	if err != nil {
-	// 		log.Error("error:", err)
-	// 		return err
-	// 	}
 	//登陆
-	case protocol.SEND_CLIENT_ID_CMD:
-		err = pp.procClientID(&cmd, session)
-		if err != nil {
-			log.Error("error:", err)
-			return err
-		}
-
-	// //退出
-	// case protocol.SEND_LOGOUT_CMD:
-	// 	err = pp.procLogout(&cmd, session)
-	// 	if err != nil {
-	// 		log.Error("error:", err)
-	// 		return err
-	// 	}
-
-	// //P2P信息
-	// case protocol.SEND_MESSAGE_P2P_CMD:
-	// 	err = pp.procSendMessageP2P(&cmd, session)
-	// 	if err != nil {
-	// 		log.Error("error:", err)
-	// 		return err
-	// 	}
-
-	// //创建Topic
-	// case protocol.SEND_CREATE_TOPIC_CMD:
-	// 	err = pp.procCreateTopic(&cmd, session)
-	// 	if err != nil {
-	// 		log.Error("error:", err)
-	// 		return err
-	// 	}
-	// //加入Topic
-	// case protocol.SEND_JOIN_TOPIC_CMD:
-	// 	err = pp.procJoinTopic(&cmd, session)
-	// 	if err != nil {
-	// 		log.Error("error:", err)
-	// 		return err
-	// 	}
+	d.Handle(protocol.SEND_CLIENT_ID_CMD, func(cmd protocol.Cmd, session interface{}) error {
+		return pp.procClientID(cmd, session.(*connection))
+	})
 
-	// //离开Topic
-	// case protocol.SEND_LEAVE_TOPIC_CMD:
-	// 	err = pp.procLeaveTopic(&cmd, session)
-	// 	if err != nil {
-	// 		log.Error("error:", err)
-	// 		return err
-	// 	}
-	// //获取群组信息
-	// case protocol.SEND_LIST_TOPIC_CMD:
-	// 	err = pp.procListTopic(&cmd, session)
-	// 	if err != nil {
-	// 		log.Error("error:", err)
-	// 		return err
-	// 	}
-	// //获取Topic成员
-	// case protocol.SEND_TOPIC_MEMBERS_LIST_CMD:
-	// 	err = pp.procTopicMembersList(&cmd, session)
-	// 	if err != nil {
-	// 		log.Error("error:", err)
-	// 		return err
-	// 	}
-
-	// //Topic信息处理
-	// case protocol.SEND_MESSAGE_TOPIC_CMD:
-	// 	err = pp.procSendMessageTopic(&cmd, session)
-	// 	if err != nil {
-	// 		log.Error("error:", err)
-	// 		return err
-	// 	}
-
-	// // p2p ack
-	// case protocol.P2P_ACK_CMD:
-	// 	err = pp.procP2pAck(&cmd, session)
-	// 	if err != nil {
-	// 		log.Error("error:", err)
-	// 		return err
-	// 	}
-
-	// // topic ack
-	// case protocol.TOPIC_ACK_CMD:
-	// 	err = pp.procTopicAck(&cmd, session)
-	// 	if err != nil {
-	// 		log.Error("error:", err)
-	// 		return err
-	// 	}
-
-	// //view friend list
-	// case protocol.SEND_VIEW_FRIENDS_CMD:
-	// 	err = pp.procViewFriends(&cmd, session)
-	// 	if err != nil {
-	// 		log.Error("error:", err)
-	// 		return err
-	// 	}
-
-	// //add friend
-	// case protocol.SEND_ADD_FRIEND_CMD:
-	// 	err = pp.procAddFriend(&cmd, session)
-	// 	if err != nil {
-	// 		log.Error("error:", err)
-	// 		return err
-	// 	}
-
-	// //del friend
-	// case protocol.SEND_DEL_FRIEND_CMD:
-	// 	err = pp.procDelFriend(&cmd, session)
-	// 	if err != nil {
-	// 		log.Error("error:", err)
-	// 		return err
-	// 	}
-
-	// //请求统一接口
-	// case protocol.SEND_ASK_CMD:
-	// 	err = pp.procAsk(&cmd, session)
-	// 	if err != nil {
-	// 		log.Error("error:", err)
-	// 		return err
-	// 	}
-
-	// //接收请求统一接口
-	// case protocol.SEND_REACT_CMD:
-	// 	err = pp.procReact(&cmd, session)
-	// 	if err != nil {
-	// 		log.Error("error:", err)
-	// 		return err
-	// 	}
+	return d
+}
 
-	default:
-		log.Info(cmd)
+//协议解析
+func (self *MsgServer) parseProtocol(cmd protocol.CmdSimple, session *connection) error {
+	err := self.dispatcher.Dispatch(&cmd, session)
+	if err != nil {
+		log.Error("error:", err)
 	}
-
 	return err
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"goProject/base"
+	"goProject/info"
+	"goProject/protocol"
+	"testing"
+
+	"github.com/funny/unitest"
+)
+
+//拒绝命令时按会话登录时的语言回复
+func Test_Dispatcher_Locale(t *testing.T) {
+	ms := &MsgServer{sessions: make(map[string]*connection)}
+	ms.dispatcher = ms.newDispatcher()
+	session := &connection{send: make(chan []byte, 1)}
+
+	dispatch := func(name string) *protocol.CmdResponse {
+		ms.parseProtocol(*protocol.NewCmdSimple(name), session)
+		var resp protocol.CmdResponse
+		unitest.NotError(t, json.Unmarshal(<-session.send, &resp))
+		return &resp
+	}
+
+	resp := dispatch(protocol.SEND_PING_CMD)
+	unitest.Pass(t, resp.Code == info.CODE_UNSUPPORTED_COMMAND)
+	unitest.Pass(t, resp.Message == info.Message(info.DEFAULT_LOCALE, info.CODE_UNSUPPORTED_COMMAND))
+
+	state := base.NewSessionState("aa", 0)
+	state.Locale = info.LOCALE_ZH
+	session.State = state
+	resp = dispatch(protocol.SEND_PING_CMD)
+	unitest.Pass(t, resp.Message == info.Message(info.LOCALE_ZH, info.CODE_UNSUPPORTED_COMMAND))
+}
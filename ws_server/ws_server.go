@@ -75,6 +75,7 @@ func main() {
 	}
 	wss.cfg = cfg
 	wss.mongoStore = mongo_store.NewMongoStore(cfg.Mongo.Addr, cfg.Mongo.Port, cfg.Mongo.User, cfg.Mongo.Password)
+	wss.dispatcher = wss.newDispatcher()
 
 	// wss := NewMsgServer(cfg)
 